@@ -0,0 +1,174 @@
+package gpkg
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Attributes is a row of an attributes table.
+type Attributes struct {
+	ID         interface{}
+	Properties map[string]interface{}
+}
+
+// CreateAttributesTable creates the non-spatial table described by schema
+// and registers it in gpkg_contents with data_type 'attributes'.
+func (g *GeoPackage) CreateAttributesTable(schema *LayerSchema) error {
+	const updateContentsTableSQL = `
+	INSERT INTO gpkg_contents(
+		table_name,
+		data_type,
+		identifier,
+		description,
+		last_change
+	)
+	VALUES (?,?,?,?,?)
+	ON CONFLICT(table_name) DO NOTHING;
+	`
+	stmt, err := schema.createSQL(nil)
+	if err != nil {
+		return err
+	}
+	if _, err = g.DB.DB().Exec(stmt); err != nil {
+		return err
+	}
+	_, err = g.DB.DB().Exec(updateContentsTableSQL, schema.Name, DataTypeAttributes, schema.Name, schema.Name, time.Now())
+	if err != nil {
+		return err
+	}
+	return g.storeDataColumns(schema)
+}
+
+// StoreAttributes inserts rows into the attributes table table_name in a
+// single transaction. Rows without an ID get the next id. When a row fails
+// the transaction is rolled back and a *FeatureError is returned.
+func (g *GeoPackage) StoreAttributes(table_name string, rows []*Attributes) error {
+	t, err := g.loadFeatureTable(table_name, "", 0)
+	if err != nil {
+		return err
+	}
+
+	tx, err := g.DB.DB().Begin()
+	if err != nil {
+		return err
+	}
+	for i, row := range rows {
+		values := t.values(row.Properties)
+		if row.ID == nil {
+			_, err = tx.Exec(t.insertSQL(false), values...)
+		} else {
+			_, err = tx.Exec(t.insertSQL(true), append([]interface{}{row.ID}, values...)...)
+		}
+		if err != nil {
+			tx.Rollback()
+			return &FeatureError{Index: i, ID: row.ID, Err: err}
+		}
+	}
+	return tx.Commit()
+}
+
+type AttributeReader struct {
+	rows      *sql.Rows
+	key       string
+	columns   []string
+	blobs     []bool
+	values    []interface{}
+	valuePtrs []interface{}
+}
+
+// GetAttributeReader returns a reader over the rows of the attributes table
+// table_name, restricted by opts when given. The BBox option is ignored.
+func (g *GeoPackage) GetAttributeReader(table_name string, opts ...*QueryOptions) (*AttributeReader, error) {
+	var opt *QueryOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	t, err := g.loadFeatureTable(table_name, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	stmt, args, err := g.buildFeatureQuery(table_name, "", opt)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := g.DB.DB().Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	r := &AttributeReader{
+		rows:      rows,
+		key:       t.key,
+		columns:   columns,
+		blobs:     make([]bool, len(columns)),
+		values:    make([]interface{}, len(columns)),
+		valuePtrs: make([]interface{}, len(columns)),
+	}
+	for i := range types {
+		r.blobs[i] = strings.HasPrefix(strings.ToUpper(types[i].DatabaseTypeName()), "BLOB")
+		r.valuePtrs[i] = &r.values[i]
+	}
+	return r, nil
+}
+
+func (r *AttributeReader) Next() bool {
+	return r.rows.Next()
+}
+
+func (r *AttributeReader) Read() (*Attributes, error) {
+	if r.rows == nil {
+		return nil, errors.New("db not open")
+	}
+	if err := r.rows.Scan(r.valuePtrs...); err != nil {
+		return nil, err
+	}
+	row := &Attributes{Properties: map[string]interface{}{}}
+	for i, col := range r.columns {
+		v := r.values[i]
+		if b, ok := v.([]byte); ok && !r.blobs[i] {
+			v = string(b)
+		}
+		if col == r.key || (r.key == "rowid" && (col == ID || col == FID)) {
+			row.ID = v
+		} else {
+			row.Properties[col] = v
+		}
+	}
+	return row, nil
+}
+
+func (r *AttributeReader) Close() error {
+	return r.rows.Close()
+}
+
+// GetAttributes returns the row of the attributes table table_name with the
+// given id, or sql.ErrNoRows if there is none.
+func (g *GeoPackage) GetAttributes(table_name string, id interface{}) (*Attributes, error) {
+	t, err := g.loadFeatureTable(table_name, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	r, err := g.GetAttributeReader(table_name, &QueryOptions{Where: fmt.Sprintf("%s = ?", t.keyColumn()), Args: []interface{}{id}, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if !r.Next() {
+		return nil, sql.ErrNoRows
+	}
+	return r.Read()
+}
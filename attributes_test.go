@@ -0,0 +1,69 @@
+package gpkg
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestAttributesTable(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	schema := &LayerSchema{
+		Name: "owners",
+		Fields: []Field{
+			{Name: "name", Type: FieldTypeText, NotNull: true},
+			{Name: "shares", Type: FieldTypeInt},
+			{Name: "signature", Type: FieldTypeBlob},
+		},
+	}
+	if err := gpkg.CreateAttributesTable(schema); err != nil {
+		t.Fatal(err)
+	}
+
+	dataType := ""
+	gpkg.DB.DB().QueryRow(`SELECT data_type FROM gpkg_contents WHERE table_name = 'owners'`).Scan(&dataType)
+	if dataType != DataTypeAttributes {
+		t.FailNow()
+	}
+
+	err := gpkg.StoreAttributes("owners", []*Attributes{
+		{ID: 10, Properties: map[string]interface{}{"name": "Ann", "shares": 3, "signature": []byte{1, 2}}},
+		{Properties: map[string]interface{}{"name": "Bob", "shares": "5"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := gpkg.GetAttributeReader("owners", &QueryOptions{OrderBy: []OrderBy{{Column: "name"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []*Attributes
+	for r.Next() {
+		row, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+	r.Close()
+
+	if len(rows) != 2 || rows[0].ID != int64(10) || rows[0].Properties["name"] != "Ann" || !bytes.Equal(rows[0].Properties["signature"].([]byte), []byte{1, 2}) {
+		t.FailNow()
+	}
+	if rows[1].ID != int64(11) || rows[1].Properties["shares"] != int64(5) {
+		t.FailNow()
+	}
+
+	if err := gpkg.StoreAttributes("owners", []*Attributes{{ID: 10, Properties: map[string]interface{}{"name": "Ann"}}}); err == nil {
+		t.FailNow()
+	}
+
+	row, err := gpkg.GetAttributes("owners", 11)
+	if err != nil || row.Properties["name"] != "Bob" {
+		t.FailNow()
+	}
+}
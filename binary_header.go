@@ -10,7 +10,6 @@ import (
 
 	"github.com/flywave/go-geom"
 	"github.com/flywave/go-geom/general"
-	"github.com/flywave/go-geom/wkb"
 )
 
 type envelopeType uint8
@@ -287,10 +286,16 @@ func DecodeBinaryHeader(data []byte) (*BinaryHeader, error) {
 	return &bh, nil
 }
 
+// StandardBinary is a GeoPackage geometry blob. For extended geometries
+// (IsStandardGeometry false in the header) Geometry is nil and the
+// extension code and payload following the header are kept as is.
 type StandardBinary struct {
-	Header   *BinaryHeader
-	SRSID    int32
-	Geometry *geom.GeometryData
+	Header        *BinaryHeader
+	SRSID         int32
+	Geometry      *geom.GeometryData
+	Layout        Layout
+	ExtensionCode [4]byte
+	Payload       []byte
 }
 
 func DecodeGeometry(bytes_ []byte) (*StandardBinary, error) {
@@ -298,16 +303,29 @@ func DecodeGeometry(bytes_ []byte) (*StandardBinary, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(bytes_) < h.Size() {
+		return nil, errors.New("not enough bytes to decode geometry")
+	}
+	sb := &StandardBinary{
+		Header: h,
+		SRSID:  h.SRSId(),
+	}
+
+	if !h.IsStandardGeometry() {
+		rest := bytes_[h.Size():]
+		if len(rest) < 4 {
+			return nil, errors.New("not enough bytes to decode extension code")
+		}
+		copy(sb.ExtensionCode[:], rest[:4])
+		sb.Payload = rest[4:]
+		return sb, nil
+	}
 
-	geo, _, err := wkb.DecodeWKB(bytes.NewBuffer(bytes_[h.Size():]))
+	sb.Geometry, sb.Layout, err = DecodeWKB(bytes_[h.Size():])
 	if err != nil {
 		return nil, err
 	}
-	return &StandardBinary{
-		Header:   h,
-		SRSID:    h.SRSId(),
-		Geometry: geo,
-	}, nil
+	return sb, nil
 }
 
 func (sb StandardBinary) Encode() ([]byte, error) {
@@ -316,39 +334,103 @@ func (sb StandardBinary) Encode() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	srsid := uint32(sb.Header.srsid)
-	err = wkb.EncodeWKB(sb.Geometry, &srsid, &data)
-	if err != nil {
+	if !sb.Header.IsStandardGeometry() {
+		data.Write(sb.ExtensionCode[:])
+		data.Write(sb.Payload)
+		return data.Bytes(), nil
+	}
+	if err = EncodeWKB(sb.Geometry, sb.Header.Endian(), sb.Layout, &data); err != nil {
 		return nil, err
 	}
 	return data.Bytes(), nil
 }
 
+// BinaryOptions controls how NewBinaryWithOptions encodes a geometry.
+type BinaryOptions struct {
+	// ByteOrder of the header and WKB, little endian when nil.
+	ByteOrder binary.ByteOrder
+	// Layout of the coordinates, inferred from them by default. XYM must
+	// be given explicitly since it cannot be told apart from XYZ.
+	Layout Layout
+	// NoEnvelope omits the envelope, which the spec allows for points.
+	NoEnvelope bool
+	// EmptyNaNEnvelope writes a NaN envelope for empty geometries instead
+	// of none.
+	EmptyNaNEnvelope bool
+}
+
 func NewBinary(srs int32, geo geom.Geometry) (*StandardBinary, error) {
-	var (
-		emptyGeo = geom.IsGeometryEmpty(geo)
-		err      error
-		extent   = []float64{math.NaN(), math.NaN(), math.NaN(), math.NaN()}
-		h        *BinaryHeader
-	)
-
-	if !emptyGeo {
-		ext, err := general.NewExtentFromGeometry(geo)
-		if err != nil {
-			return nil, err
+	return NewBinaryWithOptions(srs, geo, nil)
+}
+
+// NewBinaryWithOptions encodes geo with an envelope matching its layout,
+// XYZ, XYM or XYZM for 3D and measured geometries.
+func NewBinaryWithOptions(srs int32, geo geom.Geometry, opts *BinaryOptions) (*StandardBinary, error) {
+	var gd *geom.GeometryData
+	if geo != nil {
+		if gd = geom.NewGeometryData(geo); gd == nil {
+			return nil, fmt.Errorf("unsupported geometry %T", geo)
 		}
-		extent = ext[:]
 	}
+	return newBinary(srs, gd, opts)
+}
 
-	h, err = NewBinaryHeaderByGeom(binary.LittleEndian, srs, extent, EnvelopeTypeXY, false, emptyGeo)
+func newBinary(srs int32, gd *geom.GeometryData, opts *BinaryOptions) (*StandardBinary, error) {
+	if opts == nil {
+		opts = &BinaryOptions{}
+	}
+	order := opts.ByteOrder
+	if order == nil {
+		order = binary.LittleEndian
+	}
+	layout := opts.Layout
+	if layout == LayoutDefault {
+		layout = geometryLayout(gd)
+	}
+
+	et := layout.EnvelopeType()
+	envelope := geometryEnvelope(gd, layout)
+	empty := envelope == nil
+	switch {
+	case opts.NoEnvelope:
+		et, envelope = EnvelopeTypeNone, nil
+	case empty && opts.EmptyNaNEnvelope:
+		envelope = make([]float64, et.NumberOfElements())
+		for i := range envelope {
+			envelope[i] = math.NaN()
+		}
+	case empty:
+		et = EnvelopeTypeNone
+	}
+
+	h, err := NewBinaryHeaderByGeom(order, srs, envelope, et, false, empty)
 	if err != nil {
 		return nil, err
 	}
-
 	return &StandardBinary{
 		Header:   h,
 		SRSID:    srs,
-		Geometry: geom.NewGeometryData(geo),
+		Geometry: gd,
+		Layout:   layout,
+	}, nil
+}
+
+// NewExtendedBinary wraps the payload of an extended geometry type, whose
+// encoding is defined by the extension identified by code. The envelope
+// has to be computed by the caller, nil for none.
+func NewExtendedBinary(srs int32, code [4]byte, payload []byte, envelope []float64, et envelopeType) (*StandardBinary, error) {
+	if envelope == nil {
+		et = EnvelopeTypeNone
+	}
+	h, err := NewBinaryHeaderByGeom(binary.LittleEndian, srs, envelope, et, true, len(payload) == 0)
+	if err != nil {
+		return nil, err
+	}
+	return &StandardBinary{
+		Header:        h,
+		SRSID:         srs,
+		ExtensionCode: code,
+		Payload:       payload,
 	}, nil
 }
 
@@ -359,7 +441,7 @@ func (sb *StandardBinary) Extent() *general.Extent {
 	if geom.IsGeometryEmpty(sb.Geometry) {
 		return nil
 	}
-	extent, err := general.NewExtentFromGeometry(sb.Geometry)
+	extent, err := general.NewExtentFromGeometry(general.GeometryDataAsGeometry(sb.Geometry))
 	if err != nil {
 		return nil
 	}
@@ -390,3 +472,27 @@ func (sb *StandardBinary) Scan(value interface{}) error {
 	sb.Geometry = sb1.Geometry
 	return nil
 }
+
+// BinaryExtent returns the XY extent of an encoded GeoPackage geometry,
+// taken from the header envelope when present and computed from the
+// geometry otherwise. Empty geometries have a nil extent.
+func BinaryExtent(data []byte) (*general.Extent, error) {
+	h, err := DecodeBinaryHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if h.IsGeometryEmpty() {
+		return nil, nil
+	}
+	if env := h.Envelope(); len(env) >= 4 && !math.IsNaN(env[0]) {
+		return &general.Extent{env[0], env[2], env[1], env[3]}, nil
+	}
+	sb, err := DecodeGeometry(data)
+	if err != nil {
+		return nil, err
+	}
+	if sb.Geometry == nil || sb.Geometry.IsEmpty() {
+		return nil, nil
+	}
+	return general.NewExtentFromGeometry(general.GeometryDataAsGeometry(sb.Geometry))
+}
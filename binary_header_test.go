@@ -0,0 +1,145 @@
+package gpkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/flywave/go-geom"
+	"github.com/flywave/go-geom/general"
+	"github.com/flywave/go-geom/wkb"
+)
+
+func roundTrip(t *testing.T, sb *StandardBinary) *StandardBinary {
+	data, err := sb.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb2, err := DecodeGeometry(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sb2
+}
+
+func TestBinaryEnvelopeTypes(t *testing.T) {
+	line := [][]float64{{1, 2, 3, 4}, {5, -6, 7, -8}}
+	tests := []struct {
+		layout   Layout
+		et       envelopeType
+		envelope []float64
+	}{
+		{LayoutXY, EnvelopeTypeXY, []float64{1, 5, -6, 2}},
+		{LayoutXYZ, EnvelopeTypeXYZ, []float64{1, 5, -6, 2, 3, 7}},
+		{LayoutXYM, EnvelopeTypeXYM, []float64{1, 5, -6, 2, 3, 7}},
+		{LayoutXYZM, EnvelopeTypeXYZM, []float64{1, 5, -6, 2, 3, 7, -8, 4}},
+	}
+
+	for _, tc := range tests {
+		coords := make([][]float64, len(line))
+		for i := range line {
+			coords[i] = line[i][:tc.layout.Stride()]
+		}
+		gd := geom.NewLineStringGeometryData(coords)
+
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			sb, err := newBinary(4326, gd, &BinaryOptions{ByteOrder: order, Layout: tc.layout})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sb2 := roundTrip(t, sb)
+			if sb2.Header.EnvelopeType() != tc.et || sb2.Header.Endian() != order || sb2.Layout != tc.layout {
+				t.Fatalf("%v %v: got %v %v %v", tc.layout, order, sb2.Header.EnvelopeType(), sb2.Header.Endian(), sb2.Layout)
+			}
+			if !reflect.DeepEqual(sb2.Header.Envelope(), tc.envelope) {
+				t.Fatalf("%v: envelope %v", tc.layout, sb2.Header.Envelope())
+			}
+			if !reflect.DeepEqual(sb2.Geometry.LineString, coords) || sb2.SRSID != 4326 {
+				t.Fatalf("%v: geometry %v", tc.layout, sb2.Geometry.LineString)
+			}
+		}
+	}
+
+	sb, _ := NewBinaryWithOptions(4326, general.NewPoint([]float64{1, 2}), &BinaryOptions{NoEnvelope: true})
+	sb2 := roundTrip(t, sb)
+	if sb2.Header.EnvelopeType() != EnvelopeTypeNone || !reflect.DeepEqual(sb2.Geometry.Point, []float64{1, 2}) {
+		t.FailNow()
+	}
+}
+
+func TestBinaryInferredLayout(t *testing.T) {
+	sb, err := NewBinary(4326, general.NewPolygon([][][]float64{{{0, 0, 1}, {1, 0, 2}, {1, 1, 3}, {0, 0, 1}}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sb.Layout != LayoutXYZ || sb.Header.EnvelopeType() != EnvelopeTypeXYZ {
+		t.FailNow()
+	}
+}
+
+func TestBinaryEmpty(t *testing.T) {
+	for _, gd := range []*geom.GeometryData{
+		{Type: geom.GeometryPoint},
+		{Type: geom.GeometryPolygon},
+		{Type: geom.GeometryCollection},
+	} {
+		sb, err := newBinary(4326, gd, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sb2 := roundTrip(t, sb)
+		if !sb2.Header.IsGeometryEmpty() || sb2.Header.EnvelopeType() != EnvelopeTypeNone || sb2.Geometry.Type != gd.Type {
+			t.Fatalf("%v", gd.Type)
+		}
+		data, _ := sb.Encode()
+		if ext, err := BinaryExtent(data); err != nil || ext != nil {
+			t.FailNow()
+		}
+
+		sb, _ = newBinary(4326, gd, &BinaryOptions{EmptyNaNEnvelope: true})
+		sb2 = roundTrip(t, sb)
+		env := sb2.Header.Envelope()
+		if !sb2.Header.IsGeometryEmpty() || sb2.Header.EnvelopeType() != EnvelopeTypeXY || !math.IsNaN(env[0]) {
+			t.Fatalf("%v", gd.Type)
+		}
+	}
+}
+
+func TestBinaryExtended(t *testing.T) {
+	code := [4]byte{'G', 'P', 'K', 'G'}
+	payload := []byte{1, 2, 3, 4, 5}
+	sb, err := NewExtendedBinary(4326, code, payload, []float64{0, 1, 0, 1}, EnvelopeTypeXY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb2 := roundTrip(t, sb)
+	if sb2.Header.IsStandardGeometry() || sb2.ExtensionCode != code || !bytes.Equal(sb2.Payload, payload) || sb2.Geometry != nil {
+		t.FailNow()
+	}
+	data, _ := sb2.Encode()
+	if ext, err := BinaryExtent(data); err != nil || ext == nil || ext.MaxX() != 1 {
+		t.FailNow()
+	}
+}
+
+func TestBinaryLegacyEWKB(t *testing.T) {
+	gd := geom.NewMultiPolygonGeometryData([][][]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}})
+	h, _ := NewBinaryHeaderByGeom(binary.LittleEndian, 4326, []float64{0, 1, 0, 1}, EnvelopeTypeXY, false, false)
+
+	var data bytes.Buffer
+	h.EncodeTo(&data)
+	srid := uint32(4326)
+	if err := wkb.EncodeWKB(gd, &srid, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	sb, err := DecodeGeometry(data.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sb.Geometry.Type != geom.GeometryMultiPolygon || !reflect.DeepEqual(sb.Geometry.MultiPolygon, gd.MultiPolygon) {
+		t.FailNow()
+	}
+}
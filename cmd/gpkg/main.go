@@ -0,0 +1,87 @@
+// Command gpkg works with GeoPackage files.
+//
+//	gpkg serve [-addr :8080] [-base-url url] file.gpkg
+//	gpkg vectorize [-minzoom 0] [-maxzoom 14] -o table file.gpkg feature_table...
+//
+// serve exposes the tiles tables of the GeoPackage as XYZ tiles, and its
+// feature tables as vector tiles built on demand. vectorize writes the
+// vector tiles of feature tables to a new tiles table, in the web mercator
+// grid.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/flywave/go-geo"
+	gpkg "github.com/flywave/go-gpkg"
+	"github.com/flywave/go-gpkg/server"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: gpkg serve [-addr :8080] [-base-url url] file.gpkg")
+	fmt.Fprintln(os.Stderr, "       gpkg vectorize [-minzoom 0] [-maxzoom 14] -o table file.gpkg feature_table...")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "serve":
+		serve(os.Args[2:])
+	case "vectorize":
+		vectorize(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "address to listen on")
+	baseURL := fs.String("base-url", "", "public url of the server, used in TileJSON documents")
+	fs.Usage = usage
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	g, err := gpkg.Open(fs.Arg(0), nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer g.Close()
+
+	s := server.New(g)
+	s.BaseURL = *baseURL
+	log.Printf("serving %s on %s", fs.Arg(0), *addr)
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
+
+func vectorize(args []string) {
+	fs := flag.NewFlagSet("vectorize", flag.ExitOnError)
+	minZoom := fs.Int("minzoom", 0, "lowest zoom level")
+	maxZoom := fs.Int("maxzoom", 14, "highest zoom level")
+	output := fs.String("o", "", "vector tiles table to create")
+	fs.Usage = usage
+	fs.Parse(args)
+	if fs.NArg() < 2 || *output == "" {
+		usage()
+	}
+
+	g, err := gpkg.Open(fs.Arg(0), &gpkg.OpenOptions{Mode: gpkg.OpenReadWrite})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer g.Close()
+
+	zooms := gpkg.ZoomRange{Min: *minZoom, Max: *maxZoom}
+	if err := g.GenerateVectorTiles(*output, fs.Args()[1:], geo.NewMercTileGrid(), zooms); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -7,9 +7,16 @@ import (
 )
 
 const (
-	DataTypeFeatures   = "features"
-	DataTypeAttributes = "attributes"
-	DataTypeTitles     = "titles"
+	DataTypeFeatures          = "features"
+	DataTypeAttributes        = "attributes"
+	DataTypeTiles             = "tiles"
+	DataType2DGriddedCoverage = "2d-gridded-coverage"
+	DataTypeVectorTiles       = "vector-tiles"
+
+	// Deprecated: misspelling of DataTypeTiles. Tiles tables are registered
+	// with DataTypeTiles, packages written before keep "titles" in
+	// gpkg_contents.
+	DataTypeTitles = "titles"
 )
 
 type Content struct {
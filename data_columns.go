@@ -0,0 +1,368 @@
+package gpkg
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	SchemaExtensionName       = "gpkg_schema"
+	SchemaExtensionDefinition = "http://www.geopackage.org/spec/#extension_schema"
+
+	ConstraintTypeRange = "range"
+	ConstraintTypeEnum  = "enum"
+	ConstraintTypeGlob  = "glob"
+)
+
+// DataColumn describes a column of a feature or attributes table in
+// gpkg_data_columns.
+type DataColumn struct {
+	Table          string `sql:"type:text" gorm:"column:table_name;not null;primary_key"`
+	Column         string `sql:"type:text" gorm:"column:column_name;not null;primary_key"`
+	Name           string `sql:"type:text" gorm:"column:name"`
+	Title          string `sql:"type:text" gorm:"column:title"`
+	Description    string `sql:"type:text" gorm:"column:description"`
+	MimeType       string `sql:"type:text" gorm:"column:mime_type"`
+	ConstraintName string `sql:"type:text" gorm:"column:constraint_name"`
+}
+
+func (DataColumn) TableName() string {
+	return "gpkg_data_columns"
+}
+
+// DataColumnConstraint is a row of gpkg_data_column_constraints. A range
+// constraint uses Min and Max, an enum constraint has one row per allowed
+// Value and a glob constraint has the pattern as Value.
+type DataColumnConstraint struct {
+	ConstraintName string   `sql:"type:text" gorm:"column:constraint_name;not null;unique_index:gdcc_ntv"`
+	ConstraintType string   `sql:"type:text" gorm:"column:constraint_type;not null;unique_index:gdcc_ntv"`
+	Value          string   `sql:"type:text" gorm:"column:value;unique_index:gdcc_ntv"`
+	Min            *float64 `gorm:"column:min"`
+	MinIsInclusive *bool    `gorm:"column:min_is_inclusive"`
+	Max            *float64 `gorm:"column:max"`
+	MaxIsInclusive *bool    `gorm:"column:max_is_inclusive"`
+	Description    string   `sql:"type:text" gorm:"column:description"`
+}
+
+func (DataColumnConstraint) TableName() string {
+	return "gpkg_data_column_constraints"
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func (c *DataColumnConstraint) validate() error {
+	if c.ConstraintName == "" {
+		return errors.New("constraint has no name")
+	}
+	switch c.ConstraintType {
+	case ConstraintTypeRange:
+		if c.Value != "" {
+			return fmt.Errorf("range constraint %v has a value", c.ConstraintName)
+		}
+		if c.Min == nil || c.Max == nil {
+			return fmt.Errorf("range constraint %v has no min or max", c.ConstraintName)
+		}
+		if *c.Min > *c.Max {
+			return fmt.Errorf("range constraint %v has min greater than max", c.ConstraintName)
+		}
+	case ConstraintTypeEnum, ConstraintTypeGlob:
+		if c.Min != nil || c.Max != nil || c.MinIsInclusive != nil || c.MaxIsInclusive != nil {
+			return fmt.Errorf("%v constraint %v has a range", c.ConstraintType, c.ConstraintName)
+		}
+	default:
+		return fmt.Errorf("unknown constraint type %v", c.ConstraintType)
+	}
+	return nil
+}
+
+// registerSchemaExtension creates the schema tables if needed and registers
+// them in gpkg_extensions.
+func (g *GeoPackage) registerSchemaExtension() error {
+	err := g.DB.AutoMigrate(DataColumn{}).Error
+	if err != nil {
+		return errors.Wrap(err, "Error migrating DataColumn")
+	}
+	err = g.DB.AutoMigrate(DataColumnConstraint{}).Error
+	if err != nil {
+		return errors.Wrap(err, "Error migrating DataColumnConstraint")
+	}
+	for _, table := range []string{DataColumn{}.TableName(), DataColumnConstraint{}.TableName()} {
+		err = g.RegisterExtension(Extension{
+			Table:      table,
+			Extension:  SchemaExtensionName,
+			Definition: SchemaExtensionDefinition,
+			Scope:      ExtensionScopeReadWrite,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddDataColumnConstraints stores constraints in
+// gpkg_data_column_constraints, replacing identical rows. A range
+// constraint replaces the range of the same name, whose NULL value keeps
+// the unique index from matching it.
+func (g *GeoPackage) AddDataColumnConstraints(constraints ...DataColumnConstraint) error {
+	const (
+		deleteRangeSQL = `DELETE FROM gpkg_data_column_constraints WHERE constraint_name = ? AND constraint_type = ?`
+		insertSQL      = `
+	INSERT OR REPLACE INTO gpkg_data_column_constraints
+		(constraint_name, constraint_type, value, min, min_is_inclusive, max, max_is_inclusive, description)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	)
+	for i := range constraints {
+		if err := constraints[i].validate(); err != nil {
+			return err
+		}
+	}
+	if err := g.registerSchemaExtension(); err != nil {
+		return err
+	}
+
+	tx, err := g.DB.DB().Begin()
+	if err != nil {
+		return err
+	}
+	for _, c := range constraints {
+		if c.ConstraintType == ConstraintTypeRange {
+			if _, err = tx.Exec(deleteRangeSQL, c.ConstraintName, c.ConstraintType); err != nil {
+				tx.Rollback()
+				return errors.Wrap(err, "Error replacing constraint "+c.ConstraintName)
+			}
+		}
+		_, err = tx.Exec(insertSQL, c.ConstraintName, c.ConstraintType, nullString(c.Value),
+			c.Min, c.MinIsInclusive, c.Max, c.MaxIsInclusive, nullString(c.Description))
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "Error creating constraint "+c.ConstraintName)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetDataColumnConstraints returns the rows of the constraint name.
+func (g *GeoPackage) GetDataColumnConstraints(name string) ([]DataColumnConstraint, error) {
+	constraints := make([]DataColumnConstraint, 0)
+	if !g.TableExist(DataColumnConstraint{}.TableName()) {
+		return constraints, nil
+	}
+	err := g.DB.Where("constraint_name = ?", name).Order("value").Find(&constraints).Error
+	return constraints, err
+}
+
+// AddDataColumn describes a column in gpkg_data_columns, replacing its
+// previous description. The constraint it names must already exist.
+func (g *GeoPackage) AddDataColumn(dc DataColumn) error {
+	const insertSQL = `
+	INSERT OR REPLACE INTO gpkg_data_columns
+		(table_name, column_name, name, title, description, mime_type, constraint_name)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	if dc.Table == "" || dc.Column == "" {
+		return errors.New("data column has no table or column name")
+	}
+	columns, err := g.getTableColumns(dc.Table)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, c := range columns {
+		found = found || c.name == dc.Column
+	}
+	if !found {
+		return fmt.Errorf("unknown column %v of %v", dc.Column, dc.Table)
+	}
+	if dc.ConstraintName != "" {
+		if cs, err := g.GetDataColumnConstraints(dc.ConstraintName); err != nil {
+			return err
+		} else if len(cs) == 0 {
+			return fmt.Errorf("unknown constraint %v", dc.ConstraintName)
+		}
+	}
+	if err = g.registerSchemaExtension(); err != nil {
+		return err
+	}
+
+	_, err = g.DB.DB().Exec(insertSQL, dc.Table, dc.Column, nullString(dc.Name), nullString(dc.Title),
+		nullString(dc.Description), nullString(dc.MimeType), nullString(dc.ConstraintName))
+	if err != nil {
+		return errors.Wrap(err, "Error creating data column "+dc.Table+"."+dc.Column)
+	}
+	return nil
+}
+
+// GetDataColumns returns the column descriptions of table_name.
+func (g *GeoPackage) GetDataColumns(table_name string) ([]DataColumn, error) {
+	columns := make([]DataColumn, 0)
+	if !g.TableExist(DataColumn{}.TableName()) {
+		return columns, nil
+	}
+	err := g.DB.Where("table_name = ?", table_name).Find(&columns).Error
+	return columns, err
+}
+
+// ConstraintError reports a property value that violates the constraint of
+// its column.
+type ConstraintError struct {
+	Index      int
+	ID         interface{}
+	Column     string
+	Constraint string
+	Value      interface{}
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("feature %d (id %v): value %v of column %v violates constraint %v", e.Index, e.ID, e.Value, e.Column, e.Constraint)
+}
+
+// columnConstraint is the constraint of a column, with all its rows.
+type columnConstraint struct {
+	name  string
+	rows  []DataColumnConstraint
+	match func(v interface{}) (bool, error)
+}
+
+// tableConstraints returns the constraints of the columns of table_name.
+func (g *GeoPackage) tableConstraints(table_name string) (map[string]*columnConstraint, error) {
+	dcs, err := g.GetDataColumns(table_name)
+	if err != nil {
+		return nil, err
+	}
+	constraints := map[string]*columnConstraint{}
+	for _, dc := range dcs {
+		if dc.ConstraintName == "" {
+			continue
+		}
+		rows, err := g.GetDataColumnConstraints(dc.ConstraintName)
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		cc := &columnConstraint{name: dc.ConstraintName, rows: rows}
+		switch rows[0].ConstraintType {
+		case ConstraintTypeRange:
+			cc.match = cc.inRange
+		case ConstraintTypeEnum:
+			cc.match = cc.inEnum
+		case ConstraintTypeGlob:
+			cc.match = func(v interface{}) (bool, error) {
+				return g.matchGlob(cc.rows, v)
+			}
+		default:
+			continue
+		}
+		constraints[dc.Column] = cc
+	}
+	return constraints, nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func (c *columnConstraint) inRange(v interface{}) (bool, error) {
+	f, ok := toFloat(v)
+	if !ok {
+		return false, nil
+	}
+	for _, r := range c.rows {
+		if r.Min != nil {
+			if f < *r.Min || (f == *r.Min && r.MinIsInclusive != nil && !*r.MinIsInclusive) {
+				continue
+			}
+		}
+		if r.Max != nil {
+			if f > *r.Max || (f == *r.Max && r.MaxIsInclusive != nil && !*r.MaxIsInclusive) {
+				continue
+			}
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func (c *columnConstraint) inEnum(v interface{}) (bool, error) {
+	s := fmt.Sprint(v)
+	for _, r := range c.rows {
+		if r.Value == s {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchGlob matches v against the patterns of rows with the SQLite GLOB
+// operator, so that the result is the same as in SQL.
+func (g *GeoPackage) matchGlob(rows []DataColumnConstraint, v interface{}) (bool, error) {
+	s := fmt.Sprint(v)
+	for _, r := range rows {
+		var match bool
+		if err := g.DB.DB().QueryRow(`SELECT ? GLOB ?`, s, r.Value).Scan(&match); err != nil {
+			return false, err
+		}
+		if match {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkConstraints returns a *ConstraintError when a non-NULL value of values, in the
+// order of columns, violates the constraint of its column.
+func checkConstraints(constraints map[string]*columnConstraint, columns []column, values []interface{}, index int, id interface{}) error {
+	for i, c := range columns {
+		cc, ok := constraints[c.name]
+		if !ok || i >= len(values) || values[i] == nil {
+			continue
+		}
+		match, err := cc.match(values[i])
+		if err != nil {
+			return err
+		}
+		if !match {
+			return &ConstraintError{Index: index, ID: id, Column: c.name, Constraint: cc.name, Value: values[i]}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package gpkg
+
+import (
+	"os"
+	"testing"
+
+	"github.com/flywave/go-geom"
+	"github.com/flywave/go-geom/general"
+)
+
+func TestDataColumns(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	min, max, yes := 0.0, 100.0, true
+	schema := &LayerSchema{
+		Name: "trees",
+		Fields: []Field{
+			{Name: "height", Type: FieldTypeReal, Title: "Height", Description: "Height in meters", Constraint: "height_range"},
+			{Name: "species", Type: FieldTypeText, Alias: "sp", Constraint: "species_enum"},
+			{Name: "code", Type: FieldTypeText, Constraint: "code_glob"},
+			{Name: "photo", Type: FieldTypeBlob, MimeType: "image/jpeg"},
+		},
+		Constraints: []DataColumnConstraint{
+			{ConstraintName: "height_range", ConstraintType: ConstraintTypeRange, Min: &min, MinIsInclusive: &yes, Max: &max, MaxIsInclusive: &yes},
+			{ConstraintName: "species_enum", ConstraintType: ConstraintTypeEnum, Value: "oak"},
+			{ConstraintName: "species_enum", ConstraintType: ConstraintTypeEnum, Value: "pine"},
+			{ConstraintName: "code_glob", ConstraintType: ConstraintTypeGlob, Value: "T[0-9]*"},
+		},
+	}
+	if err := gpkg.CreateFeatureTable(schema, GeometryColumn{ColumnName: "geom", GeometryType: "POINT", SpatialReferenceSystemId: 4326}); err != nil {
+		t.Fatal(err)
+	}
+
+	dcs, err := gpkg.GetDataColumns("trees")
+	if err != nil || len(dcs) != 4 {
+		t.FailNow()
+	}
+	for _, dc := range dcs {
+		if dc.Column == "height" && (dc.Title != "Height" || dc.ConstraintName != "height_range") {
+			t.FailNow()
+		}
+		if dc.Column == "photo" && (dc.MimeType != "image/jpeg" || dc.ConstraintName != "") {
+			t.FailNow()
+		}
+	}
+	if cs, err := gpkg.GetDataColumnConstraints("species_enum"); err != nil || len(cs) != 2 || cs[0].Value != "oak" {
+		t.FailNow()
+	}
+	if err := gpkg.AddDataColumn(DataColumn{Table: "trees", Column: "height", ConstraintName: "missing"}); err == nil {
+		t.FailNow()
+	}
+	if err := gpkg.AddDataColumnConstraints(DataColumnConstraint{ConstraintName: "bad", ConstraintType: ConstraintTypeRange}); err == nil {
+		t.FailNow()
+	}
+	count, _ := gpkg.QueryInt(`SELECT count(*) FROM gpkg_extensions WHERE extension_name = 'gpkg_schema'`)
+	if count != 2 {
+		t.FailNow()
+	}
+
+	feature := func(id int, height interface{}, species string, code string) *geom.Feature {
+		return &geom.Feature{
+			ID:         id,
+			Properties: map[string]interface{}{"height": height, "species": species, "code": code},
+			Geometry:   general.NewPoint([]float64{1, 2}),
+		}
+	}
+	opts := &StoreOptions{ValidateConstraints: true}
+
+	fc := &geom.FeatureCollection{Features: []*geom.Feature{feature(1, 12.5, "oak", "T12"), feature(2, 100, "pine", "T7")}}
+	if err := gpkg.StoreFeatureCollection("trees", fc, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bad := range []struct {
+		f      *geom.Feature
+		column string
+	}{
+		{feature(3, 120.0, "oak", "T1"), "height"},
+		{feature(4, 3, "birch", "T1"), "species"},
+		{feature(5, 3, "oak", "X1"), "code"},
+	} {
+		fc := &geom.FeatureCollection{Features: []*geom.Feature{feature(6, 1, "oak", "T1"), bad.f}}
+		err := gpkg.StoreFeatureCollection("trees", fc, opts)
+		cerr, ok := err.(*ConstraintError)
+		if !ok || cerr.Index != 1 || cerr.Column != bad.column || cerr.ID != bad.f.ID {
+			t.Fatal(err)
+		}
+	}
+
+	count, _ = gpkg.QueryInt(`SELECT count(*) FROM trees`)
+	if count != 2 {
+		t.FailNow()
+	}
+
+	fc = &geom.FeatureCollection{Features: []*geom.Feature{feature(3, 120.0, "birch", "X")}}
+	if err := gpkg.StoreFeatureCollection("trees", fc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplaceRangeConstraint(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	min, max := 0.0, 100.0
+	if err := gpkg.AddDataColumnConstraints(DataColumnConstraint{ConstraintName: "height_range", ConstraintType: ConstraintTypeRange, Min: &min, Max: &max}); err != nil {
+		t.Fatal(err)
+	}
+	min = 10
+	if err := gpkg.AddDataColumnConstraints(DataColumnConstraint{ConstraintName: "height_range", ConstraintType: ConstraintTypeRange, Min: &min, Max: &max}); err != nil {
+		t.Fatal(err)
+	}
+	cs, err := gpkg.GetDataColumnConstraints("height_range")
+	if err != nil || len(cs) != 1 || *cs[0].Min != 10 {
+		t.Fatal(cs, err)
+	}
+}
@@ -0,0 +1,230 @@
+package gpkg
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+
+	"github.com/flywave/go-geo"
+)
+
+// Interpolation is the method used to sample a gridded coverage between
+// its cells.
+type Interpolation int
+
+const (
+	InterpolationNearest Interpolation = iota
+	InterpolationBilinear
+	InterpolationBicubic
+)
+
+// SampleOptions changes how SampleElevation and SampleElevations read a
+// gridded coverage. Zoom is the zoom level to sample, the most detailed one
+// when nil.
+type SampleOptions struct {
+	Zoom          *int
+	Interpolation Interpolation
+}
+
+// elevationSampler reads the cells of one zoom level of a gridded
+// coverage, decoding each tile once.
+type elevationSampler struct {
+	g        *GeoPackage
+	table    string
+	grid     *geo.TileGrid
+	level    int
+	zoom     int
+	encoding string
+	tiles    map[[2]int]*CoverageGrid
+}
+
+func (g *GeoPackage) newElevationSampler(table_name string, zoom *int) (*elevationSampler, error) {
+	gc, err := g.GetGriddedCoverage(table_name)
+	if err != nil {
+		return nil, err
+	}
+	grid, err := g.GetTileGrid(table_name)
+	if err != nil {
+		return nil, err
+	}
+	if grid == nil {
+		return nil, fmt.Errorf("no tile grid for %v", table_name)
+	}
+	zooms, err := g.GetTileZoomLevels(table_name)
+	if err != nil {
+		return nil, err
+	}
+	if len(zooms) == 0 {
+		return nil, fmt.Errorf("no tile matrix for %v", table_name)
+	}
+
+	// grid levels are sorted by resolution, as the zoom levels are.
+	level := len(zooms) - 1
+	if zoom != nil {
+		level = -1
+		for i, z := range zooms {
+			if z == *zoom {
+				level = i
+			}
+		}
+		if level < 0 {
+			return nil, fmt.Errorf("no tile matrix %v for %v", *zoom, table_name)
+		}
+	}
+	if level >= int(grid.Levels) {
+		return nil, fmt.Errorf("tile grid of %v has %d levels", table_name, grid.Levels)
+	}
+
+	return &elevationSampler{
+		g:        g,
+		table:    table_name,
+		grid:     grid,
+		level:    level,
+		zoom:     zooms[level],
+		encoding: gc.GridCellEncoding,
+		tiles:    map[[2]int]*CoverageGrid{},
+	}, nil
+}
+
+// cell returns the value of the cell at column cx and row cy of the whole
+// zoom level, clamped to its extent, NaN when its tile is missing.
+func (s *elevationSampler) cell(cx int, cy int) (float64, error) {
+	tw, th := int(s.grid.TileSize[0]), int(s.grid.TileSize[1])
+	size := s.grid.GridSizes[s.level]
+	cx = clampInt(cx, 0, int(size[0])*tw-1)
+	cy = clampInt(cy, 0, int(size[1])*th-1)
+
+	key := [2]int{cx / tw, cy / th}
+	tile, ok := s.tiles[key]
+	if !ok {
+		var err error
+		tile, err = s.g.GetCoverageTile(s.table, s.zoom, key[0], key[1])
+		if err == sql.ErrNoRows {
+			tile, err = nil, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		s.tiles[key] = tile
+	}
+	if tile == nil {
+		return math.NaN(), nil
+	}
+	x, y := cx%tw, cy%th
+	if x >= tile.Width || y >= tile.Height {
+		return math.NaN(), nil
+	}
+	return tile.At(x, y), nil
+}
+
+func clampInt(v int, min int, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// cubic is the Catmull-Rom cubic convolution of p0..p3 at t in [0, 1].
+func cubic(p0, p1, p2, p3, t float64) float64 {
+	return p1 + 0.5*t*(p2-p0+t*(2*p0-5*p1+4*p2-p3+t*(3*(p1-p2)+p3-p0)))
+}
+
+// sample returns the value at x, y in the srs of the coverage, NaN outside
+// the coverage or on missing cells.
+func (s *elevationSampler) sample(x float64, y float64, method Interpolation) (float64, error) {
+	bbox := s.grid.BBox
+	if x < bbox.Min[0] || x > bbox.Max[0] || y < bbox.Min[1] || y > bbox.Max[1] {
+		return math.NaN(), nil
+	}
+	res := s.grid.Resolution(s.level)
+
+	// position in cells from the top left corner of the zoom level, with
+	// cell values at cell centers unless they are at their corners.
+	fx, fy := (x-bbox.Min[0])/res, (bbox.Max[1]-y)/res
+	if s.encoding != GridValueIsCorner {
+		fx, fy = fx-0.5, fy-0.5
+	}
+
+	nearest, err := s.cell(int(math.Floor(fx+0.5)), int(math.Floor(fy+0.5)))
+	if err != nil || method == InterpolationNearest {
+		return nearest, err
+	}
+
+	x0, y0 := int(math.Floor(fx)), int(math.Floor(fy))
+	tx, ty := fx-float64(x0), fy-float64(y0)
+
+	n, from := 2, 0
+	if method == InterpolationBicubic {
+		n, from = 4, -1
+	}
+	cells := make([][]float64, n)
+	for j := range cells {
+		cells[j] = make([]float64, n)
+		for i := range cells[j] {
+			v, err := s.cell(x0+from+i, y0+from+j)
+			if err != nil {
+				return 0, err
+			}
+			// the interpolation needs all its cells, fall back to the
+			// nearest one next to missing data.
+			if math.IsNaN(v) {
+				return nearest, nil
+			}
+			cells[j][i] = v
+		}
+	}
+
+	if method == InterpolationBilinear {
+		top := cells[0][0]*(1-tx) + cells[0][1]*tx
+		bottom := cells[1][0]*(1-tx) + cells[1][1]*tx
+		return top*(1-ty) + bottom*ty, nil
+	}
+	var rows [4]float64
+	for j := range rows {
+		rows[j] = cubic(cells[j][0], cells[j][1], cells[j][2], cells[j][3], tx)
+	}
+	return cubic(rows[0], rows[1], rows[2], rows[3], ty), nil
+}
+
+// SampleElevation returns the value of the gridded coverage table_name at
+// x, y in the srs srs_id, or in the srs of the coverage when srs_id is 0.
+// The value is NaN outside the coverage and on missing data.
+func (g *GeoPackage) SampleElevation(table_name string, x float64, y float64, srs_id int, opts ...*SampleOptions) (float64, error) {
+	values, err := g.SampleElevations(table_name, []vec2d.T{{x, y}}, srs_id, opts...)
+	if err != nil {
+		return 0, err
+	}
+	return values[0], nil
+}
+
+// SampleElevations returns the values of the gridded coverage table_name at
+// points, as SampleElevation does. Tiles are read once for all the points.
+func (g *GeoPackage) SampleElevations(table_name string, points []vec2d.T, srs_id int, opts ...*SampleOptions) ([]float64, error) {
+	opt := &SampleOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		opt = opts[0]
+	}
+	s, err := g.newElevationSampler(table_name, opt.Zoom)
+	if err != nil {
+		return nil, err
+	}
+
+	if srs_id != 0 {
+		if srs := geo.NewProj(srs_id); !srs.Eq(s.grid.Srs) {
+			points = srs.TransformTo(s.grid.Srs, points)
+		}
+	}
+
+	values := make([]float64, len(points))
+	for i, p := range points {
+		if values[i], err = s.sample(p[0], p[1], opt.Interpolation); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
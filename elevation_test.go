@@ -0,0 +1,94 @@
+package gpkg
+
+import (
+	"math"
+	"os"
+	"testing"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+
+	"github.com/flywave/go-geo"
+)
+
+func TestSampleElevation(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	grid := newCoverageTestGrid()
+	cov := geo.NewBBoxCoverage(*grid.BBox, grid.Srs, false)
+	if err := gpkg.AddGriddedCoverageTable("dem", grid, cov, &GriddedCoverage{Datatype: GriddedDataTypeFloat}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a plane over the two top tiles of zoom level 1
+	size := int(grid.TileSize[0])
+	plane := func(cx, cy int) float64 { return 100 + 2*float64(cx) - 0.5*float64(cy) }
+	for tx := 0; tx < 2; tx++ {
+		tile := NewCoverageGrid(size, size)
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				tile.Set(x, y, plane(tx*size+x, y))
+			}
+		}
+		if tx == 1 {
+			tile.Set(10, 10, math.NaN())
+		}
+		if err := gpkg.StoreCoverageTile("dem", 1, tx, 0, tile); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tg, err := gpkg.GetTileGrid("dem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := tg.Resolution(1)
+	at := func(fx, fy float64) vec2d.T {
+		return vec2d.T{tg.BBox.Min[0] + fx*res, tg.BBox.Max[1] - fy*res}
+	}
+
+	zoom := 1
+	for _, method := range []Interpolation{InterpolationNearest, InterpolationBilinear, InterpolationBicubic} {
+		opts := &SampleOptions{Zoom: &zoom, Interpolation: method}
+		// cell centers, one on the border between the tiles
+		for _, c := range [][2]int{{5, 7}, {size - 1, 20}, {size, 20}} {
+			p := at(float64(c[0])+0.5, float64(c[1])+0.5)
+			v, err := gpkg.SampleElevation("dem", p[0], p[1], 0, opts)
+			if err != nil || math.Abs(v-plane(c[0], c[1])) > 1e-3 {
+				t.Fatal(method, c, v, err)
+			}
+		}
+	}
+
+	// between cells, across the tile border
+	p := at(float64(size)+0.25, 30.75)
+	want := 100 + 2*(float64(size)-0.25) - 0.5*30.25
+	for _, method := range []Interpolation{InterpolationBilinear, InterpolationBicubic} {
+		v, err := gpkg.SampleElevation("dem", p[0], p[1], 0, &SampleOptions{Interpolation: method})
+		if err != nil || math.Abs(v-want) > 1e-3 {
+			t.Fatal(method, v, err)
+		}
+	}
+
+	// missing cells, missing tiles and points outside the coverage
+	points := []vec2d.T{at(float64(size)+10.5, 10.5), at(10.5, float64(size)+10.5), {tg.BBox.Max[0] * 2, 0}}
+	values, err := gpkg.SampleElevations("dem", points, 0, &SampleOptions{Interpolation: InterpolationBilinear})
+	if err != nil || len(values) != 3 {
+		t.Fatal(err)
+	}
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			t.Fatal(values)
+		}
+	}
+
+	// points in another srs
+	ll := geo.NewProj(4326)
+	p = at(40.5, 60.5)
+	lp := tg.Srs.TransformTo(ll, []vec2d.T{p})[0]
+	v, err := gpkg.SampleElevation("dem", lp[0], lp[1], 4326)
+	if err != nil || math.Abs(v-plane(40, 60)) > 1e-3 {
+		t.Fatal(v, err)
+	}
+}
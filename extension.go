@@ -1,5 +1,17 @@
 package gpkg
 
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ExtensionScopeReadWrite = "read-write"
+	ExtensionScopeWriteOnly = "write-only"
+)
+
 type Extension struct {
 	Table      string  `sql:"type:text" gorm:"column:table_name"`
 	Column     *string `sql:"type:text" gorm:"column:column_name"`
@@ -11,3 +23,29 @@ type Extension struct {
 func (Extension) TableName() string {
 	return "gpkg_extensions"
 }
+
+func (g *GeoPackage) RegisterExtension(extension Extension) error {
+	err := g.DB.AutoMigrate(Extension{}).Error
+	if err != nil {
+		return errors.Wrap(err, "Error migrating Extension")
+	}
+
+	err = g.DB.Where(extension).Assign(extension).FirstOrCreate(&extension).Error
+	if err != nil {
+		return errors.Wrap(err, "Error creating extension "+fmt.Sprint(extension))
+	}
+	return nil
+}
+
+// registerExtensionTx registers extension within tx, so that it is rolled
+// back with the tables it describes. gpkg_extensions must already exist.
+func registerExtensionTx(tx *sql.Tx, extension Extension) error {
+	const insertSQL = `INSERT INTO gpkg_extensions (table_name, column_name, extension_name, definition, scope)
+		SELECT ?, ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM gpkg_extensions WHERE table_name = ? AND column_name IS ? AND extension_name = ?)`
+
+	e := extension
+	if _, err := tx.Exec(insertSQL, e.Table, e.Column, e.Extension, e.Definition, e.Scope, e.Table, e.Column, e.Extension); err != nil {
+		return errors.Wrap(err, "Error creating extension "+fmt.Sprint(extension))
+	}
+	return nil
+}
@@ -1,15 +1,34 @@
 package gpkg
 
 import (
+	"fmt"
+
 	"github.com/flywave/go-geom"
 	"github.com/flywave/go-geom/general"
 )
 
 type FeatureTable struct {
+	id       interface{}
 	geometry geom.Geometry
 	columns  []interface{}
 }
 
+// FeatureError reports the feature that made a write fail, by its index in
+// the written collection and its id.
+type FeatureError struct {
+	Index int
+	ID    interface{}
+	Err   error
+}
+
+func (e *FeatureError) Error() string {
+	return fmt.Sprintf("feature %d (id %v): %v", e.Index, e.ID, e.Err)
+}
+
+func (e *FeatureError) Unwrap() error {
+	return e.Err
+}
+
 func NewFeatureTable(fc *geom.FeatureCollection, tab *table) []FeatureTable {
 	rets := []FeatureTable{}
 
@@ -35,7 +54,7 @@ func NewFeatureTable(fc *geom.FeatureCollection, tab *table) []FeatureTable {
 			}
 		}
 
-		rets = append(rets, FeatureTable{geometry: g, columns: columns})
+		rets = append(rets, FeatureTable{id: f.ID, geometry: g, columns: columns})
 	}
 
 	return rets
@@ -0,0 +1,483 @@
+package gpkg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"math"
+
+	"github.com/flywave/go-geo"
+	"github.com/flywave/go-geom"
+	"github.com/flywave/go-geom/general"
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+// VectorTileOptions changes how vector tiles are built from feature tables.
+// Extent is the size of the tiles in pixels, 4096 when zero. Features are
+// clipped Buffer pixels outside of the tile edges, and lines and rings are
+// simplified with a Douglas-Peucker Tolerance in pixels, not at all when
+// zero. Columns restricts the properties of the features of a table, all
+// the columns are encoded for tables missing from it. Without options tiles
+// are built with a 64 pixel buffer and a 1 pixel tolerance.
+type VectorTileOptions struct {
+	Extent    uint32
+	Buffer    uint32
+	Tolerance float64
+	Columns   map[string][]string
+}
+
+func defaultVectorTileOptions(opts []*VectorTileOptions) *VectorTileOptions {
+	opt := &VectorTileOptions{Buffer: 64, Tolerance: 1}
+	if len(opts) > 0 && opts[0] != nil {
+		o := *opts[0]
+		opt = &o
+	}
+	if opt.Extent == 0 {
+		opt.Extent = mvtDefaultExtent
+	}
+	return opt
+}
+
+// simplifyPath simplifies path with the Douglas-Peucker algorithm, keeping
+// its first and last points.
+func simplifyPath(path [][]float64, tolerance float64) [][]float64 {
+	if tolerance <= 0 || len(path) < 3 {
+		return path
+	}
+	keep := make([]bool, len(path))
+	keep[0], keep[len(path)-1] = true, true
+	stack := [][2]int{{0, len(path) - 1}}
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		a, b := path[s[0]], path[s[1]]
+		dx, dy := b[0]-a[0], b[1]-a[1]
+		l2 := dx*dx + dy*dy
+
+		index, max := -1, tolerance
+		for i := s[0] + 1; i < s[1]; i++ {
+			p := path[i]
+			var d float64
+			if l2 == 0 {
+				d = math.Hypot(p[0]-a[0], p[1]-a[1])
+			} else {
+				t := math.Max(0, math.Min(1, ((p[0]-a[0])*dx+(p[1]-a[1])*dy)/l2))
+				d = math.Hypot(p[0]-a[0]-t*dx, p[1]-a[1]-t*dy)
+			}
+			if d > max {
+				index, max = i, d
+			}
+		}
+		if index >= 0 {
+			keep[index] = true
+			stack = append(stack, [2]int{s[0], index}, [2]int{index, s[1]})
+		}
+	}
+
+	simplified := make([][]float64, 0, len(path))
+	for i, p := range path {
+		if keep[i] {
+			simplified = append(simplified, p)
+		}
+	}
+	return simplified
+}
+
+// clipSegment clips the segment a, b to the square [min, max] with the
+// Liang-Barsky algorithm.
+func clipSegment(a []float64, b []float64, min float64, max float64) ([]float64, []float64, bool) {
+	t0, t1 := 0.0, 1.0
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	for _, e := range [4][2]float64{{-dx, a[0] - min}, {dx, max - a[0]}, {-dy, a[1] - min}, {dy, max - a[1]}} {
+		p, q := e[0], e[1]
+		if p == 0 {
+			if q < 0 {
+				return nil, nil, false
+			}
+			continue
+		}
+		r := q / p
+		if p < 0 {
+			if r > t1 {
+				return nil, nil, false
+			}
+			t0 = math.Max(t0, r)
+		} else {
+			if r < t0 {
+				return nil, nil, false
+			}
+			t1 = math.Min(t1, r)
+		}
+	}
+	ca, cb := a, b
+	if t0 > 0 {
+		ca = []float64{a[0] + t0*dx, a[1] + t0*dy}
+	}
+	if t1 < 1 {
+		cb = []float64{a[0] + t1*dx, a[1] + t1*dy}
+	}
+	return ca, cb, true
+}
+
+// clipLine returns the parts of line inside of the square [min, max].
+func clipLine(line [][]float64, min float64, max float64) [][][]float64 {
+	var parts [][][]float64
+	var part [][]float64
+	for i := 0; i+1 < len(line); i++ {
+		a, b, ok := clipSegment(line[i], line[i+1], min, max)
+		if !ok {
+			if len(part) > 1 {
+				parts = append(parts, part)
+			}
+			part = nil
+			continue
+		}
+		if n := len(part); n == 0 || part[n-1][0] != a[0] || part[n-1][1] != a[1] {
+			if n > 1 {
+				parts = append(parts, part)
+			}
+			part = [][]float64{a}
+		}
+		part = append(part, b)
+	}
+	if len(part) > 1 {
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// clipRing clips a closed ring to the square [min, max] with the
+// Sutherland-Hodgman algorithm. The result is closed, nil when nothing is
+// left.
+func clipRing(ring [][]float64, min float64, max float64) [][]float64 {
+	if n := len(ring); n > 1 && ring[0][0] == ring[n-1][0] && ring[0][1] == ring[n-1][1] {
+		ring = ring[:n-1]
+	}
+	for edge := 0; edge < 4 && len(ring) > 0; edge++ {
+		axis, low := edge/2, edge%2 == 0
+		inside := func(p []float64) bool {
+			if low {
+				return p[axis] >= min
+			}
+			return p[axis] <= max
+		}
+		bound := max
+		if low {
+			bound = min
+		}
+		intersect := func(a []float64, b []float64) []float64 {
+			t := (bound - a[axis]) / (b[axis] - a[axis])
+			return []float64{a[0] + t*(b[0]-a[0]), a[1] + t*(b[1]-a[1])}
+		}
+
+		clipped := make([][]float64, 0, len(ring)+4)
+		for i, b := range ring {
+			a := ring[(i+len(ring)-1)%len(ring)]
+			switch {
+			case inside(b) && inside(a):
+				clipped = append(clipped, b)
+			case inside(b):
+				clipped = append(clipped, intersect(a, b), b)
+			case inside(a):
+				clipped = append(clipped, intersect(a, b))
+			}
+		}
+		ring = clipped
+	}
+	if len(ring) < 3 {
+		return nil
+	}
+	return append(ring, ring[0])
+}
+
+// tileGeometry returns g, whose coordinates are converted by pixel,
+// simplified and clipped to the square [min, max] in pixels, nil when
+// nothing is left.
+func tileGeometry(g geom.Geometry, pixel func([][]float64) [][]float64, tolerance float64, min float64, max float64) geom.Geometry {
+	lines := func(ls [][][]float64) [][][]float64 {
+		var clipped [][][]float64
+		for _, l := range ls {
+			clipped = append(clipped, clipLine(simplifyPath(pixel(l), tolerance), min, max)...)
+		}
+		return clipped
+	}
+	polygons := func(ps [][][][]float64) [][][][]float64 {
+		var clipped [][][][]float64
+		for _, p := range ps {
+			var rings [][][]float64
+			for i, r := range p {
+				ring := simplifyPath(pixel(r), tolerance)
+				if len(ring) >= 4 {
+					ring = clipRing(ring, min, max)
+				} else {
+					ring = nil
+				}
+				if ring == nil {
+					if i == 0 {
+						break
+					}
+					continue
+				}
+				rings = append(rings, ring)
+			}
+			if len(rings) > 0 {
+				clipped = append(clipped, rings)
+			}
+		}
+		return clipped
+	}
+
+	switch g := g.(type) {
+	case geom.Point:
+		p := pixel([][]float64{g.Data()})[0]
+		if p[0] < min || p[0] > max || p[1] < min || p[1] > max {
+			return nil
+		}
+		return general.NewPoint(p)
+	case geom.MultiPoint:
+		var points [][]float64
+		for _, p := range pixel(g.Data()) {
+			if p[0] >= min && p[0] <= max && p[1] >= min && p[1] <= max {
+				points = append(points, p)
+			}
+		}
+		if len(points) == 0 {
+			return nil
+		}
+		return general.NewMultiPoint(points)
+	case geom.LineString:
+		if ls := lines([][][]float64{g.Data()}); len(ls) > 0 {
+			return general.NewMultiLineString(ls)
+		}
+	case geom.MultiLine:
+		if ls := lines(g.Data()); len(ls) > 0 {
+			return general.NewMultiLineString(ls)
+		}
+	case geom.Polygon:
+		if ps := polygons([][][][]float64{g.Data()}); len(ps) > 0 {
+			return general.NewMultiPolygon(ps)
+		}
+	case geom.MultiPolygon:
+		if ps := polygons(g.Data()); len(ps) > 0 {
+			return general.NewMultiPolygon(ps)
+		}
+	}
+	return nil
+}
+
+// featureTileLayer returns the layer of the features of table_name in the
+// tile coord of grid, nil when there is none.
+func (g *GeoPackage) featureTileLayer(table_name string, grid *geo.TileGrid, coord [3]int, opt *VectorTileOptions) (*mvtLayer, error) {
+	srs, err := g.GetGeometryProj(table_name)
+	if err != nil {
+		return nil, err
+	}
+
+	bbox := grid.TileBBox(coord, false)
+	extent := float64(opt.Extent)
+	sx, sy := (bbox.Max[0]-bbox.Min[0])/extent, (bbox.Max[1]-bbox.Min[1])/extent
+	buffer := float64(opt.Buffer)
+	query := vec2d.Rect{
+		Min: vec2d.T{bbox.Min[0] - buffer*sx, bbox.Min[1] - buffer*sy},
+		Max: vec2d.T{bbox.Max[0] + buffer*sx, bbox.Max[1] + buffer*sy},
+	}
+	query = grid.Srs.TransformRectTo(srs, query, 16)
+
+	pixel := func(coords [][]float64) [][]float64 {
+		points := make([]vec2d.T, len(coords))
+		for i, c := range coords {
+			points[i] = vec2d.T{c[0], c[1]}
+		}
+		points = srs.TransformTo(grid.Srs, points)
+		pixels := make([][]float64, len(points))
+		for i, p := range points {
+			pixels[i] = []float64{(p[0] - bbox.Min[0]) / sx, (bbox.Max[1] - p[1]) / sy}
+		}
+		return pixels
+	}
+	round := func(c []float64) [2]int64 {
+		return [2]int64{int64(math.Round(c[0])), int64(math.Round(c[1]))}
+	}
+
+	r, err := g.GetFeatureReader(table_name, &QueryOptions{
+		BBox:    &general.Extent{query.Min[0], query.Min[1], query.Max[0], query.Max[1]},
+		Columns: opt.Columns[table_name],
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	layer := &mvtLayer{Version: mvtVersion, Name: table_name, Extent: opt.Extent}
+	for r.Next() {
+		f, err := r.Read()
+		if err != nil {
+			return nil, err
+		}
+		if f.GeometryData.Type == "" {
+			continue
+		}
+		geometry := tileGeometry(general.GeometryDataAsGeometry(&f.GeometryData), pixel, opt.Tolerance, -buffer, extent+buffer)
+		if geometry == nil {
+			continue
+		}
+		typ, cmds := encodeMVTGeometry(geometry, round)
+		if typ == mvtUnknown {
+			continue
+		}
+		feature := mvtFeature{Type: typ, Geometry: cmds, Properties: f.Properties}
+		if id, ok := f.ID.(int64); ok && id >= 0 {
+			uid := uint64(id)
+			feature.ID = &uid
+		}
+		layer.Features = append(layer.Features, feature)
+	}
+	if len(layer.Features) == 0 {
+		return nil, nil
+	}
+	return layer, nil
+}
+
+// BuildVectorTile builds the gzip compressed Mapbox Vector Tile coord of
+// grid, a level, x and y in the origin of grid, with a layer per feature
+// table of tables named after the table. The features are read through the
+// rtree index of the tables when they have one. It returns nil when the
+// tile has no feature.
+func (g *GeoPackage) BuildVectorTile(tables []string, grid *geo.TileGrid, coord [3]int, opts ...*VectorTileOptions) ([]byte, error) {
+	layers, err := g.featureTileLayers(tables, grid, coord, defaultVectorTileOptions(opts))
+	if err != nil || len(layers) == 0 {
+		return nil, err
+	}
+	return gzipMVT(layers)
+}
+
+// featureTileLayers returns the non empty layers of the tables in the tile
+// coord of grid.
+func (g *GeoPackage) featureTileLayers(tables []string, grid *geo.TileGrid, coord [3]int, opt *VectorTileOptions) ([]*mvtLayer, error) {
+	layers := []*mvtLayer{}
+	for _, table := range tables {
+		l, err := g.featureTileLayer(table, grid, coord, opt)
+		if err != nil {
+			return nil, err
+		}
+		if l != nil {
+			layers = append(layers, l)
+		}
+	}
+	return layers, nil
+}
+
+// gzipMVT encodes layers as a gzip compressed Mapbox Vector Tile.
+func gzipMVT(layers []*mvtLayer) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(encodeMVT(layers)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GenerateVectorTiles creates the vector tiles table dst_table with the
+// grid levels zooms of grid, and stores the tiles built by
+// BuildVectorTile from tables over their extent. Tiles are stored in
+// batches, each in a single transaction with the layers of its features.
+// dst_table is dropped when the generation fails.
+func (g *GeoPackage) GenerateVectorTiles(dst_table string, tables []string, grid *geo.TileGrid, zooms ZoomRange, opts ...*VectorTileOptions) error {
+	if zooms.Min < 0 || zooms.Max >= int(grid.Levels) || zooms.Min > zooms.Max {
+		return fmt.Errorf("invalid levels %d to %d", zooms.Min, zooms.Max)
+	}
+	if g.TableExist(dst_table) {
+		return fmt.Errorf("table %v already exists", dst_table)
+	}
+	if err := g.generateVectorTiles(dst_table, tables, grid, zooms, defaultVectorTileOptions(opts)); err != nil {
+		g.dropTilesTable(dst_table)
+		return err
+	}
+	return nil
+}
+
+func (g *GeoPackage) generateVectorTiles(dst_table string, tables []string, grid *geo.TileGrid, zooms ZoomRange, opt *VectorTileOptions) error {
+	var bbox *vec2d.Rect
+	for _, table := range tables {
+		cov, err := g.GetCoverage(table)
+		if err != nil {
+			return err
+		}
+		b := cov.TransformTo(grid.Srs).GetBBox()
+		if bbox == nil {
+			bbox = &b
+		} else {
+			bbox.Join(&b)
+		}
+	}
+	if bbox == nil {
+		return fmt.Errorf("no feature table")
+	}
+	*bbox = vec2d.Rect{
+		Min: vec2d.T{math.Max(bbox.Min[0], grid.BBox.Min[0]), math.Max(bbox.Min[1], grid.BBox.Min[1])},
+		Max: vec2d.T{math.Min(bbox.Max[0], grid.BBox.Max[0]), math.Min(bbox.Max[1], grid.BBox.Max[1])},
+	}
+
+	levels := []int{}
+	for l := zooms.Min; l <= zooms.Max; l++ {
+		levels = append(levels, l)
+	}
+	if err := g.AddVectorTilesTable(dst_table, grid, geo.NewBBoxCoverage(*bbox, grid.Srs, false), &TilesTableOptions{Levels: levels}); err != nil {
+		return err
+	}
+
+	for _, l := range levels {
+		z, _, top, err := g.GridTileCoord(dst_table, grid, [3]int{0, 0, l})
+		if err != nil {
+			return err
+		}
+		delta := grid.Resolutions[l] / 10
+		x0, y0, _ := grid.Tile(bbox.Min[0]+delta, bbox.Min[1]+delta, l)
+		x1, y1, _ := grid.Tile(bbox.Max[0]-delta, bbox.Max[1]-delta, l)
+		if y0 > y1 {
+			y0, y1 = y1, y0
+		}
+		size := grid.GridSizes[l]
+		x0, x1 = clampInt(x0, 0, int(size[0])-1), clampInt(x1, 0, int(size[0])-1)
+		y0, y1 = clampInt(y0, 0, int(size[1])-1), clampInt(y1, 0, int(size[1])-1)
+
+		var (
+			tiles  []*Tile
+			merged []*mvtLayer
+		)
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				layers, err := g.featureTileLayers(tables, grid, [3]int{x, y, l}, opt)
+				if err != nil {
+					return err
+				}
+				if len(layers) == 0 {
+					continue
+				}
+				data, err := gzipMVT(layers)
+				if err != nil {
+					return err
+				}
+				row := y
+				if !grid.FlippedYAxis {
+					row = top - y
+				}
+				tiles = append(tiles, &Tile{Zoom: z, Column: x, Row: row, Data: data})
+				merged = mergeVectorTileLayers(merged, layers)
+			}
+			if len(tiles) >= overviewBatchSize {
+				if err = g.storeVectorTiles(dst_table, z, tiles, merged); err != nil {
+					return err
+				}
+				tiles, merged = tiles[:0], nil
+			}
+		}
+		if err = g.storeVectorTiles(dst_table, z, tiles, merged); err != nil {
+			return err
+		}
+	}
+	return nil
+}
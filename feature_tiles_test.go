@@ -0,0 +1,159 @@
+package gpkg
+
+import (
+	"math"
+	"os"
+	"testing"
+
+	"github.com/flywave/go-geo"
+	"github.com/flywave/go-geom"
+	"github.com/flywave/go-geom/general"
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+func TestClipRing(t *testing.T) {
+	ring := clipRing([][]float64{{-10, -10}, {10, -10}, {10, 10}, {-10, 10}, {-10, -10}}, 0, 20)
+	if len(ring) != 5 || ring[0][0] != ring[4][0] || ring[0][1] != ring[4][1] {
+		t.Fatal(ring)
+	}
+	for _, p := range ring {
+		if p[0] < 0 || p[0] > 10 || p[1] < 0 || p[1] > 10 {
+			t.Fatal(ring)
+		}
+	}
+	if ring := clipRing([][]float64{{30, 30}, {40, 30}, {40, 40}, {30, 30}}, 0, 20); ring != nil {
+		t.Fatal(ring)
+	}
+
+	parts := clipLine([][]float64{{-5, 5}, {5, 5}, {5, 30}, {15, 30}, {15, 5}}, 0, 20)
+	if len(parts) != 2 || len(parts[0]) != 3 || parts[0][0][0] != 0 || parts[1][1][1] != 5 {
+		t.Fatal(parts)
+	}
+
+	if path := simplifyPath([][]float64{{0, 0}, {5, 0.5}, {10, 0}}, 1); len(path) != 2 {
+		t.Fatal(path)
+	}
+}
+
+func TestGenerateVectorTiles(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	places := &geom.FeatureCollection{Features: []*geom.Feature{
+		{ID: 1, Properties: map[string]interface{}{"name": "a"}, Geometry: general.NewPoint([]float64{10, 10})},
+		{ID: 2, Properties: map[string]interface{}{"name": "b"}, Geometry: general.NewPoint([]float64{-100, 40})},
+	}}
+	parks := &geom.FeatureCollection{Features: []*geom.Feature{
+		{ID: 1, Properties: map[string]interface{}{"name": "c"}, Geometry: general.NewPolygon([][][]float64{{{0, 0}, {20, 0}, {20, 20}, {0, 20}, {0, 0}}})},
+	}}
+	for name, fc := range map[string]*geom.FeatureCollection{"places": places, "parks": parks} {
+		gtype := "Point"
+		if name == "parks" {
+			gtype = "Polygon"
+		}
+		tt := buildGeometryTable(name, fc, "geom", 4326, gtype)
+		gpkg.buildTable(tt)
+		gpkg.writeFeatures(NewFeatureTable(fc, &tt), tt, 1)
+	}
+	if err := gpkg.CreateSpatialIndex("places", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	grid := newCoverageTestGrid()
+	tables := []string{"places", "parks"}
+
+	// Tile 1/1/0 is the top right quarter of the grid.
+	data, err := gpkg.BuildVectorTile(tables, grid, [3]int{1, 0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := decodeVectorTile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 2 || layers[0].Name != "places" || len(layers[0].Features) != 1 || layers[0].Features[0].Properties["name"] != "a" {
+		t.Fatal(layers)
+	}
+	if layers[1].Name != "parks" || len(layers[1].Features) != 1 || layers[1].Features[0].Type != mvtPolygon {
+		t.Fatal(layers[1])
+	}
+
+	if data, err := gpkg.BuildVectorTile(tables, grid, [3]int{0, 3, 2}); err != nil || data != nil {
+		t.Fatal(data, err)
+	}
+
+	if err := gpkg.GenerateVectorTiles("vt", tables, grid, ZoomRange{Min: 0, Max: 2}); err != nil {
+		t.Fatal(err)
+	}
+	count, _ := gpkg.QueryInt(`SELECT count(*) FROM "vt" WHERE zoom_level = 1`)
+	if count != 2 {
+		t.Fatal(count)
+	}
+	vtl, err := gpkg.GetVectorTileLayers("vt")
+	if err != nil || len(vtl) != 2 || *vtl[0].MinZoom != 0 || *vtl[0].MaxZoom != 2 {
+		t.Fatal(vtl, err)
+	}
+
+	fcs, err := gpkg.ReadVectorTile("vt", 1, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc := fcs["places"]
+	if fc == nil || len(fc.Features) != 1 || fc.Features[0].ID != int64(1) {
+		t.Fatal(fcs)
+	}
+	p, ok := fc.Features[0].Geometry.(geom.Point)
+	if !ok {
+		t.Fatal(fc.Features[0].Geometry)
+	}
+	expected := geo.NewProj(4326).TransformTo(grid.Srs, []vec2d.T{{10, 10}})[0]
+	size := (grid.BBox.Max[0] - grid.BBox.Min[0]) / 2
+	if math.Abs(p.X()-expected[0]) > size/4096 || math.Abs(p.Y()-expected[1]) > size/4096 {
+		t.Fatal(p.Data(), expected)
+	}
+
+	if err := gpkg.GenerateVectorTiles("vt", tables, grid, ZoomRange{Min: 0, Max: 2}); err == nil {
+		t.FailNow()
+	}
+}
+
+func TestGenerateVectorTilesReadWrite(t *testing.T) {
+	gpkg, _ := createFeatureTestPackage(t, true)
+	defer os.Remove("./test.gpkg")
+	gpkg.Close()
+
+	grid := newCoverageTestGrid()
+	zooms := ZoomRange{Min: 0, Max: 1}
+
+	gpkg, err := Open("./test.gpkg", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gpkg.GenerateVectorTiles("vt", []string{"test"}, grid, zooms); err == nil {
+		t.Fatal("read only package")
+	}
+	gpkg.Close()
+
+	gpkg, err = Open("./test.gpkg", &OpenOptions{Mode: OpenReadWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gpkg.Close()
+	if gpkg.TableExist("vt") {
+		t.FailNow()
+	}
+	if err := gpkg.GenerateVectorTiles("vt", []string{"test"}, grid, zooms); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := gpkg.QueryInt(`SELECT count(*) FROM "vt" WHERE zoom_level = 0`); count != 1 {
+		t.Fatal(count)
+	}
+	vtl, err := gpkg.GetVectorTileLayers("vt")
+	if err != nil || len(vtl) != 1 || vtl[0].Name != "test" || *vtl[0].MinZoom != 0 || *vtl[0].MaxZoom != 1 {
+		t.Fatal(vtl, err)
+	}
+	if fields, _ := gpkg.GetVectorTileFields(vtl[0].Id); len(fields) == 0 {
+		t.FailNow()
+	}
+}
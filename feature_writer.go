@@ -0,0 +1,209 @@
+package gpkg
+
+import (
+	"database/sql"
+
+	"github.com/flywave/go-geom"
+	"github.com/flywave/go-geom/general"
+	"github.com/pkg/errors"
+)
+
+const DefaultBatchSize = 1000
+
+type FeatureWriterOptions struct {
+	// BatchSize is the number of features written per transaction,
+	// DefaultBatchSize when zero.
+	BatchSize int
+	// Geometry describes the geometry column of the table when it has to
+	// be created, a GEOMETRY column in EPSG:4326 when nil.
+	Geometry *GeometryColumn
+}
+
+// FeatureWriter writes features to a table one at a time, committing them
+// in batches so that memory use does not depend on the number of features.
+type FeatureWriter struct {
+	g         *GeoPackage
+	table     *featureTable
+	batchSize int
+	tx        *sql.Tx
+	insert    *sql.Stmt
+	insertKey *sql.Stmt
+	count     int
+	ext       *general.Extent
+
+	// pending and pendingExt account for the features of the current
+	// batch, they are added to count and ext once it is committed.
+	pending    int
+	pendingExt *general.Extent
+
+	// err is the error that lost a batch, returned by every later call.
+	err error
+}
+
+// NewFeatureWriter returns a writer to table_name, creating the table from
+// the fields of schema and opts.Geometry when it does not exist yet.
+func (g *GeoPackage) NewFeatureWriter(table_name string, schema *LayerSchema, opts *FeatureWriterOptions) (*FeatureWriter, error) {
+	batchSize := DefaultBatchSize
+	if opts != nil && opts.BatchSize > 0 {
+		batchSize = opts.BatchSize
+	}
+
+	if !g.TableExist(table_name) {
+		gc := GeometryColumn{SpatialReferenceSystemId: 4326}
+		if opts != nil && opts.Geometry != nil {
+			gc = *opts.Geometry
+		}
+		s := LayerSchema{Name: table_name}
+		if schema != nil {
+			s.Fields = schema.Fields
+		}
+		if err := g.CreateFeatureTable(&s, gc); err != nil {
+			return nil, err
+		}
+	}
+
+	ft, err := g.getFeatureTable(table_name)
+	if err != nil {
+		return nil, err
+	}
+	return &FeatureWriter{g: g, table: ft, batchSize: batchSize}, nil
+}
+
+func (w *FeatureWriter) begin() error {
+	var err error
+	if w.tx, err = w.g.DB.DB().Begin(); err != nil {
+		return errors.Wrap(err, "Error starting transaction")
+	}
+	if w.insert, err = w.tx.Prepare(w.table.insertSQL(false)); err != nil {
+		w.rollback()
+		return errors.Wrap(err, "Error preparing insert into "+w.table.name)
+	}
+	if w.insertKey, err = w.tx.Prepare(w.table.insertSQL(true)); err != nil {
+		w.rollback()
+		return errors.Wrap(err, "Error preparing insert into "+w.table.name)
+	}
+	return nil
+}
+
+func (w *FeatureWriter) closeStmts() {
+	if w.insert != nil {
+		w.insert.Close()
+		w.insert = nil
+	}
+	if w.insertKey != nil {
+		w.insertKey.Close()
+		w.insertKey = nil
+	}
+}
+
+func (w *FeatureWriter) rollback() {
+	w.closeStmts()
+	w.tx.Rollback()
+	w.tx = nil
+	w.pending, w.pendingExt = 0, nil
+}
+
+func (w *FeatureWriter) commit() error {
+	w.closeStmts()
+	err := w.tx.Commit()
+	w.tx = nil
+	pending, ext := w.pending, w.pendingExt
+	w.pending, w.pendingExt = 0, nil
+	if err != nil {
+		return errors.Wrap(err, "Error committing features of "+w.table.name)
+	}
+
+	w.count += pending
+	if ext != nil {
+		if w.ext == nil {
+			w.ext = ext
+		} else {
+			w.ext.Add(ext)
+		}
+	}
+	return nil
+}
+
+// Write inserts f. Features without an ID get the next fid. When f cannot
+// be written a *FeatureError is returned and only f is discarded, through a
+// savepoint around its insert. If the batch itself is lost, its error is
+// also returned by every later Write and by Close.
+func (w *FeatureWriter) Write(f *geom.Feature) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.tx == nil {
+		if err := w.begin(); err != nil {
+			return err
+		}
+	}
+
+	index := w.count + w.pending
+	data, ext, err := w.table.geometry(f)
+	if err != nil {
+		return &FeatureError{Index: index, ID: f.ID, Err: errors.Wrap(err, "Error encoding geometry")}
+	}
+	if _, err = w.tx.Exec(`SAVEPOINT feature`); err != nil {
+		return w.fail(errors.Wrap(err, "Error writing to "+w.table.name))
+	}
+	values := append(w.table.values(f.Properties), data)
+	if f.ID == nil {
+		_, err = w.insert.Exec(values...)
+	} else {
+		_, err = w.insertKey.Exec(append([]interface{}{f.ID}, values...)...)
+	}
+	if err != nil {
+		if _, uerr := w.tx.Exec(`ROLLBACK TO feature; RELEASE feature`); uerr != nil {
+			return w.fail(errors.Wrap(err, "Error inserting into "+w.table.name))
+		}
+		return &FeatureError{Index: index, ID: f.ID, Err: errors.Wrap(err, "Error inserting into "+w.table.name)}
+	}
+	if _, err = w.tx.Exec(`RELEASE feature`); err != nil {
+		return w.fail(errors.Wrap(err, "Error writing to "+w.table.name))
+	}
+
+	if ext != nil {
+		if w.pendingExt == nil {
+			w.pendingExt = ext
+		} else {
+			w.pendingExt.Add(ext)
+		}
+	}
+	w.pending++
+	if w.pending == w.batchSize {
+		if err := w.commit(); err != nil {
+			w.err = err
+			return err
+		}
+	}
+	return nil
+}
+
+// fail rolls back the current batch and keeps err for the later calls.
+func (w *FeatureWriter) fail(err error) error {
+	w.rollback()
+	w.err = err
+	return err
+}
+
+// Count returns the number of features committed.
+func (w *FeatureWriter) Count() int {
+	return w.count
+}
+
+// Close commits the pending features and grows the extent of the table in
+// gpkg_contents to the committed geometries. It returns the error that
+// lost a batch, if any.
+func (w *FeatureWriter) Close() error {
+	if w.tx != nil {
+		if err := w.commit(); err != nil && w.err == nil {
+			w.err = err
+		}
+	}
+	ext := w.ext
+	w.ext = nil
+	if err := w.g.UpdateGeometryExtent(w.table.name, ext); err != nil {
+		return err
+	}
+	return w.err
+}
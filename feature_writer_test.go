@@ -0,0 +1,102 @@
+package gpkg
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/flywave/go-geom"
+	"github.com/flywave/go-geom/general"
+)
+
+func TestFeatureWriter(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	data, _ := ioutil.ReadFile("./data.json")
+	fcs, _ := general.UnmarshalFeatureCollection(data)
+
+	schema := &LayerSchema{Fields: []Field{{Name: "name", Type: "TEXT"}}}
+	w, err := gpkg.NewFeatureWriter("test", schema, &FeatureWriterOptions{
+		BatchSize: 7,
+		Geometry:  &GeometryColumn{ColumnName: "geom", GeometryType: "MULTIPOLYGON", SpatialReferenceSystemId: 4326},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range fcs.Features {
+		if i == 0 {
+			f.ID = 1000
+		} else {
+			f.ID = nil
+		}
+		if err := w.Write(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	count, _ := gpkg.QueryInt(`SELECT count(*) FROM test`)
+	if count != len(fcs.Features) || w.Count() != count {
+		t.FailNow()
+	}
+	f, err := gpkg.GetFeature("test", 1000)
+	if err != nil || f.Properties["name"] != "Afghanistan" {
+		t.FailNow()
+	}
+
+	var minx, maxx float64
+	gpkg.DB.DB().QueryRow(`SELECT min_x, max_x FROM gpkg_contents WHERE table_name = 'test'`).Scan(&minx, &maxx)
+	if minx > -179 || maxx < 179 {
+		t.FailNow()
+	}
+}
+
+func TestFeatureWriterRollback(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	w, err := gpkg.NewFeatureWriter("test", nil, &FeatureWriterOptions{
+		BatchSize: 2,
+		Geometry:  &GeometryColumn{ColumnName: "geom", GeometryType: "POINT", SpatialReferenceSystemId: 4326},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := func(id int, x float64) *geom.Feature {
+		return &geom.Feature{ID: id, Geometry: general.NewPoint([]float64{x, 0})}
+	}
+	for _, f := range []*geom.Feature{point(1, 0), point(2, 1), point(3, 100)} {
+		if err := w.Write(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The duplicate id only discards itself, feature 3 of the open batch
+	// is kept.
+	err = w.Write(point(1, 0))
+	if fe, ok := err.(*FeatureError); !ok || fe.Index != 3 {
+		t.Fatal(err)
+	}
+	if err := w.Write(point(4, 50)); err != nil {
+		t.Fatal(err)
+	}
+	if w.Count() != 4 {
+		t.Fatal(w.Count())
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if count, _ := gpkg.QueryInt(`SELECT count(*) FROM test`); count != 4 {
+		t.Fatal(count)
+	}
+	var maxx float64
+	gpkg.DB.DB().QueryRow(`SELECT max_x FROM gpkg_contents WHERE table_name = 'test'`).Scan(&maxx)
+	if maxx != 100 {
+		t.Fatal(maxx)
+	}
+}
@@ -0,0 +1,343 @@
+package gpkg
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flywave/go-geom"
+	"github.com/flywave/go-geom/general"
+)
+
+// featureTable describes an existing feature table for the fid keyed
+// feature API.
+type featureTable struct {
+	name    string
+	key     string
+	gcolumn string
+	srs     int
+	columns []column
+	// defaults holds the evaluated default of each column, used for the
+	// properties a feature does not have.
+	defaults []interface{}
+}
+
+func (g *GeoPackage) getFeatureTable(table_name string) (*featureTable, error) {
+	gcolumn, err := g.GetGeomColumn(table_name)
+	if err != nil {
+		return nil, err
+	}
+	srs, err := g.GetGeometrySrsId(table_name)
+	if err != nil {
+		return nil, err
+	}
+	return g.loadFeatureTable(table_name, gcolumn, srs)
+}
+
+// loadFeatureTable reads the columns of table_name, which has no geometry
+// column when gcolumn is empty.
+func (g *GeoPackage) loadFeatureTable(table_name string, gcolumn string, srs int) (*featureTable, error) {
+	columns, err := g.getTableColumns(table_name)
+	if err != nil {
+		return nil, err
+	}
+	ft := &featureTable{name: table_name, key: "rowid", gcolumn: gcolumn, srs: srs}
+	for _, c := range columns {
+		if c.pk == 1 {
+			ft.key = c.name
+			continue
+		}
+		if c.name == gcolumn {
+			continue
+		}
+		var def interface{}
+		if c.dfltValue != nil {
+			if err := g.DB.DB().QueryRow("SELECT " + *c.dfltValue).Scan(&def); err != nil {
+				return nil, err
+			}
+		}
+		ft.columns = append(ft.columns, c)
+		ft.defaults = append(ft.defaults, def)
+	}
+	return ft, nil
+}
+
+func (t *featureTable) keyColumn() string {
+	if t.key == "rowid" {
+		return t.key
+	}
+	return quoteIdentifier(t.key)
+}
+
+// values returns properties in the order of t.columns.
+func (t *featureTable) values(properties map[string]interface{}) []interface{} {
+	values := make([]interface{}, len(t.columns))
+	for i := range t.columns {
+		v, ok := properties[t.columns[i].name]
+		if !ok {
+			values[i] = t.defaults[i]
+			continue
+		}
+		values[i] = t.value(i, v)
+	}
+	return values
+}
+
+// value converts the property v to the type of the column i.
+func (t *featureTable) value(i int, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	if nv := changeColumnValue(v, &t.columns[i]); nv != nil {
+		return nv
+	}
+	return v
+}
+
+// geometry encodes the geometry of f, returning nil for features without
+// geometry, and its extent.
+func (t *featureTable) geometry(f *geom.Feature) ([]byte, *general.Extent, error) {
+	g := f.Geometry
+	if g == nil && f.GeometryData.Type != "" {
+		g = general.GeometryDataAsGeometry(&f.GeometryData)
+	}
+	if g == nil {
+		return nil, nil, nil
+	}
+	sb, err := NewBinary(int32(t.srs), g)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := sb.Encode()
+	if err != nil {
+		return nil, nil, err
+	}
+	if geom.IsGeometryEmpty(g) {
+		return data, nil, nil
+	}
+	ext, err := general.NewExtentFromGeometry(g)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, ext, nil
+}
+
+// update returns the statement and arguments setting the feature f.ID of
+// t to the properties of f and to the geometry data. Columns f has no
+// property for, and the geometry when data is nil, are left as they are.
+func (t *featureTable) update(f *geom.Feature, data []byte) (string, []interface{}) {
+	var (
+		sets []string
+		args []interface{}
+	)
+	for i, c := range t.columns {
+		v, ok := f.Properties[c.name]
+		if !ok {
+			continue
+		}
+		sets = append(sets, quoteIdentifier(c.name)+" = ?")
+		args = append(args, t.value(i, v))
+	}
+	if t.gcolumn != "" && data != nil {
+		sets = append(sets, quoteIdentifier(t.gcolumn)+" = ?")
+		args = append(args, data)
+	}
+	if len(sets) == 0 {
+		// nothing to change, still tell whether the feature exists
+		sets = append(sets, t.keyColumn()+" = "+t.keyColumn())
+	}
+	args = append(args, f.ID)
+	return fmt.Sprintf(`UPDATE %s SET %s WHERE %s = ?`, quoteIdentifier(t.name), strings.Join(sets, ", "), t.keyColumn()), args
+}
+
+func (t *featureTable) insertSQL(withKey bool) string {
+	var names, params []string
+	if withKey {
+		names = append(names, t.keyColumn())
+		params = append(params, "?")
+	}
+	for _, c := range t.columns {
+		names = append(names, quoteIdentifier(c.name))
+		params = append(params, "?")
+	}
+	if t.gcolumn != "" {
+		names = append(names, quoteIdentifier(t.gcolumn))
+		params = append(params, "?")
+	}
+	return fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)`, quoteIdentifier(t.name), strings.Join(names, ", "), strings.Join(params, ", "))
+}
+
+// GetFeature returns the feature of table_name with the given fid, or
+// sql.ErrNoRows if there is none.
+func (g *GeoPackage) GetFeature(table_name string, fid interface{}) (*geom.Feature, error) {
+	ft, err := g.getFeatureTable(table_name)
+	if err != nil {
+		return nil, err
+	}
+	r, err := g.GetFeatureReader(table_name, &QueryOptions{Where: ft.keyColumn() + " = ?", Args: []interface{}{fid}, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if !r.Next() {
+		return nil, sql.ErrNoRows
+	}
+	return r.Read()
+}
+
+// FeatureEditOptions changes how UpdateFeature, DeleteFeature and
+// UpsertFeatures maintain the extent of the table in gpkg_contents. By
+// default it only grows to the written geometries; with ShrinkExtent it is
+// recalculated with CalculateGeometryExtent, shrinking after edits and
+// deletes at the cost of a scan of the table.
+type FeatureEditOptions struct {
+	ShrinkExtent bool
+}
+
+// updateEditedExtent grows the extent of table_name to ext, or recalculates
+// it when opts ask to shrink it.
+func (g *GeoPackage) updateEditedExtent(table_name string, ext *general.Extent, opts []*FeatureEditOptions) error {
+	if len(opts) > 0 && opts[0] != nil && opts[0].ShrinkExtent {
+		return g.RefreshGeometryExtent(table_name)
+	}
+	return g.UpdateGeometryExtent(table_name, ext)
+}
+
+// UpdateFeature sets the properties and geometry of the feature of
+// table_name identified by f.ID. Columns missing from the properties of f,
+// and the geometry when f has none, are left as they are. It returns
+// sql.ErrNoRows if there is no such feature.
+func (g *GeoPackage) UpdateFeature(table_name string, f *geom.Feature, opts ...*FeatureEditOptions) error {
+	if f.ID == nil {
+		return errors.New("feature has no id")
+	}
+	ft, err := g.getFeatureTable(table_name)
+	if err != nil {
+		return err
+	}
+	data, ext, err := ft.geometry(f)
+	if err != nil {
+		return err
+	}
+
+	stmt, args := ft.update(f, data)
+	res, err := g.DB.DB().Exec(stmt, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return g.updateEditedExtent(table_name, ext, opts)
+}
+
+// DeleteFeature deletes the feature of table_name with the given fid. The
+// extent in gpkg_contents is only recalculated with ShrinkExtent.
+func (g *GeoPackage) DeleteFeature(table_name string, fid interface{}, opts ...*FeatureEditOptions) error {
+	ft, err := g.getFeatureTable(table_name)
+	if err != nil {
+		return err
+	}
+	res, err := g.DB.DB().Exec(fmt.Sprintf(`DELETE FROM %s WHERE %s = ?`, quoteIdentifier(table_name), ft.keyColumn()), fid)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return g.updateEditedExtent(table_name, nil, opts)
+}
+
+// UpsertFeatures updates the features of table_name that already exist, as
+// UpdateFeature does, and inserts the others, in a single transaction.
+// Features without an ID are always inserted.
+func (g *GeoPackage) UpsertFeatures(table_name string, features []*geom.Feature, opts ...*FeatureEditOptions) error {
+	ft, err := g.getFeatureTable(table_name)
+	if err != nil {
+		return err
+	}
+
+	tx, err := g.DB.DB().Begin()
+	if err != nil {
+		return err
+	}
+
+	var ext *general.Extent
+	for _, f := range features {
+		data, fext, err := ft.geometry(f)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if fext != nil {
+			if ext == nil {
+				ext = fext
+			} else {
+				ext.Add(fext)
+			}
+		}
+
+		values := append(ft.values(f.Properties), data)
+		if f.ID == nil {
+			if _, err = tx.Exec(ft.insertSQL(false), values...); err != nil {
+				tx.Rollback()
+				return err
+			}
+			continue
+		}
+
+		stmt, args := ft.update(f, data)
+		res, err := tx.Exec(stmt, args...)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			tx.Rollback()
+			return err
+		} else if n > 0 {
+			continue
+		}
+		if _, err = tx.Exec(ft.insertSQL(true), append([]interface{}{f.ID}, values...)...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	return g.updateEditedExtent(table_name, ext, opts)
+}
+
+// RefreshGeometryExtent recalculates the extent of table_name from its
+// geometries and stores it in gpkg_contents. Unlike UpdateGeometryExtent,
+// which only grows the extent, this shrinks it after updates and deletes.
+func (g *GeoPackage) RefreshGeometryExtent(table_name string) error {
+	const updateSQL = `
+	UPDATE gpkg_contents
+	SET
+		min_x = ?,
+		min_y = ?,
+		max_x = ?,
+		max_y = ?
+	WHERE
+		table_name = ?
+	`
+	ext, err := g.CalculateGeometryExtent(table_name)
+	if err != nil {
+		return err
+	}
+	if ext == nil {
+		_, err = g.DB.DB().Exec(updateSQL, nil, nil, nil, nil, table_name)
+		return err
+	}
+	_, err = g.DB.DB().Exec(updateSQL, ext.MinX(), ext.MinY(), ext.MaxX(), ext.MaxY(), table_name)
+	return err
+}
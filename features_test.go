@@ -0,0 +1,146 @@
+package gpkg
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/flywave/go-geom"
+	"github.com/flywave/go-geom/general"
+)
+
+func TestFeatureUpdateDelete(t *testing.T) {
+	gpkg, fcs := createFeatureTestPackage(t, true)
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	f, err := gpkg.GetFeature("test", "AFG")
+	if err != nil || f.Properties["name"] != "Afghanistan" {
+		t.FailNow()
+	}
+
+	square := general.NewPolygon([][][]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {0, 0}}})
+	err = gpkg.UpdateFeature("test", &geom.Feature{ID: "AFG", Properties: map[string]interface{}{"name": "Square"}, Geometry: square})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, _ = gpkg.GetFeature("test", "AFG")
+	if f == nil || f.Properties["name"] != "Square" {
+		t.FailNow()
+	}
+	maxx, _ := gpkg.QueryInt(`SELECT maxx FROM rtree_test_geom WHERE id = (SELECT rowid FROM test WHERE id = 'AFG')`)
+	if maxx != 1 {
+		t.FailNow()
+	}
+
+	if err := gpkg.DeleteFeature("test", "AFG"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gpkg.GetFeature("test", "AFG"); err != sql.ErrNoRows {
+		t.FailNow()
+	}
+	if err := gpkg.DeleteFeature("test", "AFG"); err != sql.ErrNoRows {
+		t.FailNow()
+	}
+
+	err = gpkg.UpsertFeatures("test", []*geom.Feature{
+		{ID: "AGO", Properties: map[string]interface{}{"name": "Angola"}, Geometry: square},
+		{ID: "ZZZ", Properties: map[string]interface{}{"name": "Nowhere"}, Geometry: square},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, _ := gpkg.QueryInt(`SELECT count(*) FROM test`)
+	if count != len(fcs.Features) {
+		t.FailNow()
+	}
+
+	if err := gpkg.RefreshGeometryExtent("test"); err != nil {
+		t.Fatal(err)
+	}
+	ext, err := gpkg.CalculateGeometryExtent("test")
+	if err != nil || ext == nil {
+		t.FailNow()
+	}
+	var minx float64
+	gpkg.DB.DB().QueryRow(`SELECT min_x FROM gpkg_contents WHERE table_name = 'test'`).Scan(&minx)
+	if minx != ext.MinX() {
+		t.FailNow()
+	}
+}
+
+func TestUpdateFeatureKeepsMissingColumns(t *testing.T) {
+	gpkg, _ := createFeatureTestPackage(t, true)
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	if _, err := gpkg.DB.DB().Exec(`ALTER TABLE test ADD COLUMN pop INTEGER DEFAULT 0`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gpkg.DB.DB().Exec(`UPDATE test SET pop = 5 WHERE id = 'AGO'`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gpkg.UpdateFeature("test", &geom.Feature{ID: "AGO", Properties: map[string]interface{}{"name": "Angola"}}); err != nil {
+		t.Fatal(err)
+	}
+	pop, _ := gpkg.QueryInt(`SELECT pop FROM test WHERE id = 'AGO'`)
+	empty, _ := gpkg.QueryInt(`SELECT geom IS NULL FROM test WHERE id = 'AGO'`)
+	if pop != 5 || empty != 0 {
+		t.Fatal(pop, empty)
+	}
+
+	square := general.NewPolygon([][][]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {0, 0}}})
+	if err := gpkg.UpsertFeatures("test", []*geom.Feature{{ID: "AGO", Geometry: square}}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := gpkg.GetFeature("test", "AGO")
+	if err != nil || f.Properties["name"] != "Angola" {
+		t.Fatal(f, err)
+	}
+	if pop, _ := gpkg.QueryInt(`SELECT pop FROM test WHERE id = 'AGO'`); pop != 5 {
+		t.Fatal(pop)
+	}
+	if err := gpkg.UpdateFeature("test", &geom.Feature{ID: "ZZZ"}); err != sql.ErrNoRows {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteFeatureShrinkExtent(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	w, err := gpkg.NewFeatureWriter("points", nil, &FeatureWriterOptions{
+		Geometry: &GeometryColumn{ColumnName: "geom", GeometryType: "POINT", SpatialReferenceSystemId: 4326},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, x := range []float64{0, 1, 100} {
+		if err := w.Write(&geom.Feature{ID: i + 1, Geometry: general.NewPoint([]float64{x, 0})}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	maxX := func() float64 {
+		var maxx float64
+		gpkg.DB.DB().QueryRow(`SELECT max_x FROM gpkg_contents WHERE table_name = 'points'`).Scan(&maxx)
+		return maxx
+	}
+	if err := gpkg.DeleteFeature("points", 3); err != nil {
+		t.Fatal(err)
+	}
+	if maxX() != 100 {
+		t.Fatal(maxX())
+	}
+	if err := gpkg.DeleteFeature("points", 2, &FeatureEditOptions{ShrinkExtent: true}); err != nil {
+		t.Fatal(err)
+	}
+	if maxX() != 0 {
+		t.Fatal(maxX())
+	}
+}
@@ -0,0 +1,225 @@
+package gpkg
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+)
+
+// TIFF tags used by gridded coverage tiles.
+const (
+	tiffImageWidth      = 256
+	tiffImageLength     = 257
+	tiffBitsPerSample   = 258
+	tiffCompression     = 259
+	tiffPhotometric     = 262
+	tiffStripOffsets    = 273
+	tiffSamplesPerPixel = 277
+	tiffRowsPerStrip    = 278
+	tiffStripByteCounts = 279
+	tiffPlanarConfig    = 284
+	tiffPredictor       = 317
+	tiffSampleFormat    = 339
+
+	tiffShort = 3
+	tiffLong  = 4
+
+	tiffCompressionNone       = 1
+	tiffCompressionDeflate    = 8
+	tiffCompressionOldDeflate = 32946
+
+	tiffSampleFormatFloat = 3
+)
+
+// encodeFloatTiff encodes values, width x height in row major order, as an
+// uncompressed single band 32-bit float little endian TIFF.
+func encodeFloatTiff(width int, height int, values []float32) ([]byte, error) {
+	if len(values) != width*height {
+		return nil, fmt.Errorf("%d values for a %dx%d tiff", len(values), width, height)
+	}
+	type entry struct {
+		tag, typ uint16
+		value    uint32
+	}
+	entries := []entry{
+		{tiffImageWidth, tiffLong, uint32(width)},
+		{tiffImageLength, tiffLong, uint32(height)},
+		{tiffBitsPerSample, tiffShort, 32},
+		{tiffCompression, tiffShort, tiffCompressionNone},
+		{tiffPhotometric, tiffShort, 1},
+		{tiffStripOffsets, tiffLong, 0},
+		{tiffSamplesPerPixel, tiffShort, 1},
+		{tiffRowsPerStrip, tiffLong, uint32(height)},
+		{tiffStripByteCounts, tiffLong, uint32(4 * len(values))},
+		{tiffPlanarConfig, tiffShort, 1},
+		{tiffSampleFormat, tiffShort, tiffSampleFormatFloat},
+	}
+	dataOffset := uint32(8 + 2 + 12*len(entries) + 4)
+	entries[5].value = dataOffset
+
+	buf := bytes.NewBuffer(make([]byte, 0, int(dataOffset)+4*len(values)))
+	le := binary.LittleEndian
+	buf.WriteString("II")
+	binary.Write(buf, le, uint16(42))
+	binary.Write(buf, le, uint32(8))
+	binary.Write(buf, le, uint16(len(entries)))
+	for _, e := range entries {
+		binary.Write(buf, le, e.tag)
+		binary.Write(buf, le, e.typ)
+		binary.Write(buf, le, uint32(1))
+		if e.typ == tiffShort {
+			binary.Write(buf, le, uint16(e.value))
+			binary.Write(buf, le, uint16(0))
+		} else {
+			binary.Write(buf, le, e.value)
+		}
+	}
+	binary.Write(buf, le, uint32(0))
+	for _, v := range values {
+		binary.Write(buf, le, math.Float32bits(v))
+	}
+	return buf.Bytes(), nil
+}
+
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func (r *tiffReader) slice(offset uint32, n uint32) ([]byte, error) {
+	end := uint64(offset) + uint64(n)
+	if end > uint64(len(r.data)) {
+		return nil, errors.New("tiff is truncated")
+	}
+	return r.data[offset:end], nil
+}
+
+// values returns the values of an IFD entry of type SHORT or LONG.
+func (r *tiffReader) values(entry []byte) ([]uint32, error) {
+	typ := r.order.Uint16(entry[2:])
+	count := r.order.Uint32(entry[4:])
+	size := uint32(2)
+	if typ == tiffLong {
+		size = 4
+	} else if typ != tiffShort {
+		return nil, fmt.Errorf("unsupported tiff field type %d", typ)
+	}
+	raw := entry[8:12]
+	if count*size > 4 {
+		var err error
+		if raw, err = r.slice(r.order.Uint32(entry[8:]), count*size); err != nil {
+			return nil, err
+		}
+	}
+	values := make([]uint32, count)
+	for i := range values {
+		if size == 2 {
+			values[i] = uint32(r.order.Uint16(raw[2*i:]))
+		} else {
+			values[i] = r.order.Uint32(raw[4*i:])
+		}
+	}
+	return values, nil
+}
+
+// decodeFloatTiff decodes a single band 32-bit float TIFF organized in
+// strips, uncompressed or deflate compressed, as written by
+// encodeFloatTiff and most GIS tools.
+func decodeFloatTiff(data []byte) (int, int, []float32, error) {
+	if len(data) < 8 {
+		return 0, 0, nil, errors.New("tiff is truncated")
+	}
+	r := &tiffReader{data: data}
+	switch string(data[:2]) {
+	case "II":
+		r.order = binary.LittleEndian
+	case "MM":
+		r.order = binary.BigEndian
+	default:
+		return 0, 0, nil, errors.New("not a tiff")
+	}
+	if r.order.Uint16(data[2:]) != 42 {
+		return 0, 0, nil, errors.New("not a classic tiff")
+	}
+	ifd := r.order.Uint32(data[4:])
+	head, err := r.slice(ifd, 2)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	n := uint32(r.order.Uint16(head))
+	entries, err := r.slice(ifd+2, 12*n)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	fields := map[uint16][]uint32{}
+	for i := uint32(0); i < n; i++ {
+		entry := entries[12*i : 12*i+12]
+		tag := r.order.Uint16(entry)
+		switch tag {
+		case tiffImageWidth, tiffImageLength, tiffBitsPerSample, tiffCompression, tiffStripOffsets,
+			tiffSamplesPerPixel, tiffRowsPerStrip, tiffStripByteCounts, tiffPlanarConfig, tiffPredictor, tiffSampleFormat:
+			if fields[tag], err = r.values(entry); err != nil {
+				return 0, 0, nil, err
+			}
+		}
+	}
+	field := func(tag uint16, def uint32) uint32 {
+		if v := fields[tag]; len(v) > 0 {
+			return v[0]
+		}
+		return def
+	}
+
+	width, height := int(field(tiffImageWidth, 0)), int(field(tiffImageLength, 0))
+	if width == 0 || height == 0 {
+		return 0, 0, nil, errors.New("tiff has no size")
+	}
+	if field(tiffBitsPerSample, 1) != 32 || field(tiffSampleFormat, 1) != tiffSampleFormatFloat || field(tiffSamplesPerPixel, 1) != 1 {
+		return 0, 0, nil, errors.New("tiff is not a single band 32-bit float image")
+	}
+	if field(tiffPredictor, 1) != 1 {
+		return 0, 0, nil, errors.New("unsupported tiff predictor")
+	}
+	compression := field(tiffCompression, tiffCompressionNone)
+	offsets, counts := fields[tiffStripOffsets], fields[tiffStripByteCounts]
+	if len(offsets) == 0 || len(offsets) != len(counts) {
+		return 0, 0, nil, errors.New("tiff has no strips")
+	}
+
+	raw := make([]byte, 0, 4*width*height)
+	for i := range offsets {
+		strip, err := r.slice(offsets[i], counts[i])
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		switch compression {
+		case tiffCompressionNone:
+		case tiffCompressionDeflate, tiffCompressionOldDeflate:
+			zr, err := zlib.NewReader(bytes.NewReader(strip))
+			if err != nil {
+				return 0, 0, nil, err
+			}
+			strip, err = ioutil.ReadAll(zr)
+			if err != nil {
+				return 0, 0, nil, err
+			}
+		default:
+			return 0, 0, nil, fmt.Errorf("unsupported tiff compression %d", compression)
+		}
+		raw = append(raw, strip...)
+	}
+	if len(raw) < 4*width*height {
+		return 0, 0, nil, errors.New("tiff is truncated")
+	}
+
+	values := make([]float32, width*height)
+	for i := range values {
+		values[i] = math.Float32frombits(r.order.Uint32(raw[4*i:]))
+	}
+	return width, height, values, nil
+}
@@ -3,7 +3,7 @@ package gpkg
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"math"
 	"os"
 	"strings"
 	"time"
@@ -71,7 +71,7 @@ func (g *GeoPackage) Size() (int64, error) {
 }
 
 func (g *GeoPackage) Init() error {
-	db, err := gorm.Open("sqlite3", g.Uri)
+	db, err := gorm.Open("sqlite3", DriverName, g.Uri)
 	if err != nil {
 		return err
 	}
@@ -92,6 +92,9 @@ func (g *GeoPackage) AutoMigrate() error {
 	if err != nil {
 		return errors.Wrap(err, "Error migrating TileMatrix")
 	}
+	if err = g.migrateTileMatrixSet(); err != nil {
+		return err
+	}
 	err = g.DB.AutoMigrate(TileMatrixSet{}).Error
 	if err != nil {
 		return errors.Wrap(err, "Error migrating TileMatrixSet")
@@ -121,24 +124,22 @@ func (g *GeoPackage) AutoMigrateRelatedTables() error {
 		return errors.Wrap(err, "Error migrating Relation")
 	}
 
-	err = g.DB.AutoMigrate(Extension{}).Error
-	if err != nil {
-		return errors.Wrap(err, "Error migrating Extension")
+	// Earlier versions registered the extension with a placeholder
+	// definition.
+	if g.TableExist(Extension{}.TableName()) {
+		err = g.DB.Model(Extension{}).Where("extension_name = ? AND definition = ?", RelatedTablesExtensionName, "TBD").Update("definition", RelatedTablesExtensionDefinition).Error
+		if err != nil {
+			return errors.Wrap(err, "Error updating extension "+RelatedTablesExtensionName)
+		}
 	}
 
-	extension := Extension{
+	return g.RegisterExtension(Extension{
 		Table:      Relation{}.TableName(),
 		Column:     nil,
-		Extension:  "related_tables",
-		Definition: "TBD",
-		Scope:      "read-write",
-	}
-
-	err = g.DB.Where(extension).Assign(extension).FirstOrCreate(&extension).Error
-	if err != nil {
-		return errors.Wrap(err, "Error creating extension "+fmt.Sprint(extension))
-	}
-	return nil
+		Extension:  RelatedTablesExtensionName,
+		Definition: RelatedTablesExtensionDefinition,
+		Scope:      ExtensionScopeReadWrite,
+	})
 }
 
 func (g *GeoPackage) GetSpatialReferenceSystem(srs_id int) (SpatialReferenceSystem, error) {
@@ -162,6 +163,7 @@ func (g *GeoPackage) QueryInt(stmt string) (int, error) {
 	if err != nil {
 		return result, err
 	}
+	defer rows.Close()
 
 	if rows.Next() {
 		if err := rows.Scan(&result); err != nil {
@@ -188,6 +190,7 @@ func (g *GeoPackage) GetTileSize(table string) (*[2]int, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	if rows.Next() {
 		var width, height int
@@ -204,10 +207,11 @@ func (g *GeoPackage) GetTileSize(table string) (*[2]int, error) {
 func (g *GeoPackage) GetExtent(table_name string) (*general.Extent, error) {
 	extent := general.Extent{}
 
-	rows, err := g.DB.DB().Query(fmt.Sprintf("SELECT min(min_x), max(max_x), min(min_y), max(max_y) FROM gpkg_contents WHERE table_name = \"%s\";", table_name))
+	rows, err := g.DB.DB().Query(fmt.Sprintf("SELECT min(min_x), min(min_y), max(max_x), max(max_y) FROM gpkg_contents WHERE table_name = \"%s\";", table_name))
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	if rows.Next() {
 		var minx, miny, maxx, maxy float64
@@ -231,6 +235,7 @@ func (g *GeoPackage) GetCoverage(table_name string) (geo.Coverage, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	var srscode int
 	if rows.Next() {
 		if err := rows.Scan(&srscode); err != nil {
@@ -248,6 +253,7 @@ func (g *GeoPackage) GetGeometryType(table_name string, column_name string) (str
 	if err != nil {
 		return "", err
 	}
+	defer rows.Close()
 
 	if rows.Next() {
 		if err := rows.Scan(&geometry_type); err != nil {
@@ -266,6 +272,7 @@ func (g *GeoPackage) GetTile(table string, z int, x int, y int) ([]byte, error)
 	if err != nil {
 		return b, err
 	}
+	defer rows.Close()
 
 	if rows.Next() {
 		if err := rows.Scan(&b); err != nil {
@@ -277,7 +284,7 @@ func (g *GeoPackage) GetTile(table string, z int, x int, y int) ([]byte, error)
 }
 
 func (g *GeoPackage) StoreTile(table string, z int, x int, y int, data []byte) error {
-	stmt := fmt.Sprintf("INSERT OR REPLACE INTO [\"%s\"] (zoom_level, tile_column, tile_row, tile_data) VALUES (?,?,?,?)", table)
+	stmt := fmt.Sprintf("INSERT OR REPLACE INTO \"%s\" (zoom_level, tile_column, tile_row, tile_data) VALUES (?,?,?,?)", table)
 
 	_, err := g.DB.DB().Exec(stmt, z, x, y, data)
 	if err != nil {
@@ -298,13 +305,14 @@ func (g *GeoPackage) GetTileSrsId(table string) (int, error) {
 }
 
 func (g *GeoPackage) GetTileZoomLevels(table string) ([]int, error) {
-	stmt := "SELECT zoom_level FROM gpkg_tile_matrix WHERE table_name = \"%s\";"
+	stmt := "SELECT zoom_level FROM gpkg_tile_matrix WHERE table_name = \"%s\" ORDER BY zoom_level;"
 	levels := make([]int, 0)
 
-	rows, err := g.DB.DB().Query(stmt, table)
+	rows, err := g.DB.DB().Query(fmt.Sprintf(stmt, table))
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		level := 0
@@ -318,13 +326,14 @@ func (g *GeoPackage) GetTileZoomLevels(table string) ([]int, error) {
 }
 
 func (g *GeoPackage) GetTileResolutions(table string) ([]float64, error) {
-	stmt := "SELECT pixel_x_size FROM gpkg_tile_matrix WHERE table_name = \"%s\";"
+	stmt := "SELECT pixel_x_size FROM gpkg_tile_matrix WHERE table_name = \"%s\" ORDER BY zoom_level;"
 	resolutions := make([]float64, 0)
 
 	rows, err := g.DB.DB().Query(fmt.Sprintf(stmt, table))
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		res := float64(0)
@@ -337,11 +346,23 @@ func (g *GeoPackage) GetTileResolutions(table string) ([]float64, error) {
 	return resolutions, nil
 }
 
+// GetTileGrid returns the tile grid of the tile matrices of table. A tile
+// grid has square pixels, tables whose pixel_y_size differs from their
+// pixel_x_size are rejected, see AddTileMatrixSet.
 func (g *GeoPackage) GetTileGrid(table string) (*geo.TileGrid, error) {
 	res, err := g.GetTileResolutions(table)
 	if err != nil {
 		return nil, err
 	}
+	matrices := []TileMatrix{}
+	if err := g.DB.Where("table_name = ?", table).Find(&matrices).Error; err != nil {
+		return nil, errors.Wrap(err, "Error reading tile matrices of "+table)
+	}
+	for _, tm := range matrices {
+		if math.Abs(tm.PixelYSize-tm.PixelXSize) > tm.PixelXSize*1e-9 {
+			return nil, fmt.Errorf("tile matrix %d of %v has no square pixels", tm.ZoomLevel, table)
+		}
+	}
 	tileSize, err := g.GetTileSize(table)
 	if err != nil {
 		return nil, err
@@ -358,6 +379,13 @@ func (g *GeoPackage) GetTileGrid(table string) (*geo.TileGrid, error) {
 	conf[geo.TILEGRID_TILE_SIZE] = []uint32{uint32(tileSize[0]), uint32(tileSize[1])}
 	conf[geo.TILEGRID_ORIGIN] = geo.ORIGIN_UL
 
+	// The bbox of the tile matrix set is the origin of the tiles, packages
+	// written before the table_name column was fixed use the srs bbox.
+	tms := TileMatrixSet{}
+	if err := g.DB.Where("table_name = ?", table).First(&tms).Error; err == nil && tms.MinX != nil && tms.MinY != nil && tms.MaxX != nil && tms.MaxY != nil {
+		conf[geo.TILEGRID_BBOX] = &vec2d.Rect{Min: vec2d.T{*tms.MinX, *tms.MinY}, Max: vec2d.T{*tms.MaxX, *tms.MaxY}}
+	}
+
 	return geo.NewTileGrid(conf), nil
 }
 
@@ -368,19 +396,25 @@ type GeoPackageReader struct {
 	columns    []string
 	values     []interface{}
 	valuePtrs  []interface{}
+	geomColumn string
 }
 
 func newGeoPackageReader(rows *sql.Rows, table_name string, g *GeoPackage) *GeoPackageReader {
 	columns, _ := rows.Columns()
 	values := make([]interface{}, len(columns))
 	valuePtrs := make([]interface{}, len(columns))
-	return &GeoPackageReader{rows: rows, table_name: table_name, columns: columns, values: values, valuePtrs: valuePtrs, g: g}
+	geomColumn, _ := g.GetGeomColumn(table_name)
+	return &GeoPackageReader{rows: rows, table_name: table_name, columns: columns, values: values, valuePtrs: valuePtrs, g: g, geomColumn: geomColumn}
 }
 
 func (r *GeoPackageReader) Next() bool {
 	return r.rows.Next()
 }
 
+func (r *GeoPackageReader) Close() error {
+	return r.rows.Close()
+}
+
 func (r *GeoPackageReader) Read() (*geom.Feature, error) {
 	if r.rows == nil {
 		return nil, errors.New("db not open")
@@ -405,11 +439,7 @@ func (r *GeoPackageReader) Read() (*geom.Feature, error) {
 		} else {
 			switch r.values[i].(type) {
 			case []byte:
-				geometryType, err := r.g.GetGeometryType(r.table_name, col)
-				if err != nil {
-					return nil, err
-				}
-				if len(geometryType) > 0 {
+				if col == r.geomColumn {
 					v := r.values[i].([]byte)
 					g, err := DecodeGeometry(v)
 					if err != nil {
@@ -425,24 +455,49 @@ func (r *GeoPackageReader) Read() (*geom.Feature, error) {
 			}
 		}
 	}
-	return &geom.Feature{ID: featureId, Properties: featureProperties, GeometryData: *featureGeometry}, nil
+	feature := &geom.Feature{ID: featureId, Properties: featureProperties}
+	if featureGeometry != nil {
+		feature.GeometryData = *featureGeometry
+	}
+	return feature, nil
 }
 
-func (g *GeoPackage) GetFeatureReader(table_name string) (*GeoPackageReader, error) {
-	stmt := "SELECT * FROM %s;"
-	rows, err := g.DB.DB().Query(fmt.Sprintf(stmt, table_name))
+// GetFeatureReader returns a reader over the features of table_name,
+// restricted by opts when given.
+func (g *GeoPackage) GetFeatureReader(table_name string, opts ...*QueryOptions) (*GeoPackageReader, error) {
+	var opt *QueryOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	geomColumn, _ := g.GetGeomColumn(table_name)
+	stmt, args, err := g.buildFeatureQuery(table_name, geomColumn, opt)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := g.DB.DB().Query(stmt, args...)
 	if err != nil {
 		return nil, err
 	}
 	return newGeoPackageReader(rows, table_name, g), nil
 }
 
+// GetFeatureReaderInBBox returns a reader over the features of table_name
+// whose envelope intersects extent. The rtree index is used to select the
+// candidate rows when the table has one.
+func (g *GeoPackage) GetFeatureReaderInBBox(table_name string, extent *general.Extent) (*GeoPackageReader, error) {
+	if _, err := g.GetGeomColumn(table_name); err != nil {
+		return nil, err
+	}
+	return g.GetFeatureReader(table_name, &QueryOptions{BBox: extent})
+}
+
 func (g *GeoPackage) GetFeatureCollection(table_name string) (*geom.FeatureCollection, error) {
 	stmt := "SELECT * FROM %s;"
 	rows, err := g.DB.DB().Query(fmt.Sprintf(stmt, table_name))
 	if err != nil {
 		return &geom.FeatureCollection{}, err
 	}
+	defer rows.Close()
 
 	columns, _ := rows.Columns()
 	values := make([]interface{}, len(columns))
@@ -504,6 +559,7 @@ func (g *GeoPackage) GetVectorLayers() ([]VectorLayer, error) {
 	if err != nil {
 		return vectorLayers, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		layerName := ""
@@ -528,6 +584,16 @@ func (g *GeoPackage) GetVectorLayersAsList() (*VectorLayerList, error) {
 	return &VectorLayerList{vectorLayers: vectorLayers}, nil
 }
 
+// GetTileMatrixSet returns the tile matrix set of the tiles table
+// table_name.
+func (g *GeoPackage) GetTileMatrixSet(table_name string) (*TileMatrixSet, error) {
+	tms := &TileMatrixSet{}
+	if err := g.DB.Where("table_name = ?", table_name).First(tms).Error; err != nil {
+		return nil, errors.Wrap(err, "Error reading tile matrix set of "+table_name)
+	}
+	return tms, nil
+}
+
 func (g *GeoPackage) GetTileMatrixSets() ([]TileMatrixSet, error) {
 	tileMatrixSets := make([]TileMatrixSet, 0)
 	err := g.DB.Find(&tileMatrixSets).Error
@@ -561,6 +627,7 @@ func (g *GeoPackage) TableExist(table_name string) bool {
 	if err != nil {
 		return false
 	}
+	defer rows.Close()
 
 	if rows.Next() {
 		if err := rows.Scan(&table_type); err != nil {
@@ -579,6 +646,7 @@ func (g *GeoPackage) GetTileFormat(table_name string) (TileFormat, error) {
 	if err != nil {
 		return UNKNOWN, err
 	}
+	defer rows.Close()
 
 	if rows.Next() {
 		if err := rows.Scan(&b); err != nil {
@@ -589,7 +657,40 @@ func (g *GeoPackage) GetTileFormat(table_name string) (TileFormat, error) {
 	return detectTileFormat(&b)
 }
 
-func (g *GeoPackage) AddTilesTable(table_name string, grid *geo.TileGrid, cov geo.Coverage) error {
+// AddTilesTable creates the tiles table table_name with a tile matrix per
+// level of grid, see TilesTableOptions, and sets its extent to cov when
+// given.
+func (g *GeoPackage) AddTilesTable(table_name string, grid *geo.TileGrid, cov geo.Coverage, opts ...*TilesTableOptions) error {
+	var opt *TilesTableOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	return g.addTilesTable(table_name, DataTypeTiles, grid, cov, opt)
+}
+
+func (g *GeoPackage) addTilesTable(table_name string, data_type string, grid *geo.TileGrid, cov geo.Coverage, opts *TilesTableOptions) error {
+	matrices, err := newGridTileMatrices(table_name, grid, opts)
+	if err != nil {
+		return err
+	}
+	tms, err := newGridTileMatrixSet(table_name, grid, matrices)
+	if err != nil {
+		return err
+	}
+	return g.addTileMatrixSet(table_name, data_type, grid.Srs, tms, matrices, cov)
+}
+
+// AddTileMatrixSet creates the tiles table table_name for an arbitrary tile
+// matrix set, such as one read from WMTS capabilities. The bbox of tms is
+// the top left corner of every matrix. The extent is set to cov when given.
+// Matrices whose pixel_y_size differs from their pixel_x_size have no tile
+// grid: their tiles are only read through GetTile, TileIterator and
+// DeleteTiles, not by the consumers of GetTileGrid.
+func (g *GeoPackage) AddTileMatrixSet(table_name string, tms *TileMatrixSet, matrices []TileMatrix, cov geo.Coverage) error {
+	return g.addTileMatrixSet(table_name, DataTypeTiles, geo.NewProj(tms.GetSpatialReferenceSystemId()), tms, matrices, cov)
+}
+
+func (g *GeoPackage) addTileMatrixSet(table_name string, data_type string, srs geo.Proj, tms *TileMatrixSet, matrices []TileMatrix, cov geo.Coverage) error {
 	const (
 		validateSRSSQL = `
 		SELECT Count(*) 
@@ -619,13 +720,17 @@ func (g *GeoPackage) AddTilesTable(table_name string, grid *geo.TileGrid, cov ge
 		 UNIQUE (zoom_level, tile_column, tile_row))
 		 `
 	)
-	if grid.Origin != geo.ORIGIN_UL {
-		return fmt.Errorf("only support origin ul")
+	if err := validateTileMatrixSet(tms, matrices); err != nil {
+		return err
+	}
+	tms.Name = table_name
+	for i := range matrices {
+		matrices[i].Name = table_name
 	}
 
 	var count int
 
-	srs_id := geo.GetEpsgNum(grid.Srs.GetSrsCode())
+	srs_id := tms.GetSpatialReferenceSystemId()
 
 	err := g.DB.DB().QueryRow(validateSRSSQL, srs_id).Scan(&count)
 	if err != nil {
@@ -640,7 +745,7 @@ func (g *GeoPackage) AddTilesTable(table_name string, grid *geo.TileGrid, cov ge
 			return err
 		}
 	}
-	_, err = g.DB.DB().Exec(updateContentsTableSQL, table_name, DataTypeTitles, table_name, table_name, srs_id, time.Now())
+	_, err = g.DB.DB().Exec(updateContentsTableSQL, table_name, data_type, table_name, table_name, srs_id, time.Now())
 	if err != nil {
 		return err
 	}
@@ -650,7 +755,7 @@ func (g *GeoPackage) AddTilesTable(table_name string, grid *geo.TileGrid, cov ge
 	}
 
 	if cov != nil {
-		cov = cov.TransformTo(grid.Srs)
+		cov = cov.TransformTo(srs)
 		bbox := cov.GetBBox()
 		err := g.UpdateGeometryExtent(table_name, &general.Extent{bbox.Min[0], bbox.Min[1], bbox.Max[0], bbox.Max[1]})
 		if err != nil {
@@ -658,7 +763,7 @@ func (g *GeoPackage) AddTilesTable(table_name string, grid *geo.TileGrid, cov ge
 		}
 	}
 
-	return g.saveTileMatrixSet(NewTileMatrixSet(table_name, grid), NewTileMatrixs(table_name, grid))
+	return g.saveTileMatrixSet(tms, matrices)
 }
 
 func (g *GeoPackage) AddGeometryColumn(table GeometryColumn) error {
@@ -775,27 +880,24 @@ func (g *GeoPackage) UpdateSRS(srss ...SpatialReferenceSystem) error {
 	return err
 }
 
-func (g *GeoPackage) getTableColumns(table string) []column {
+func (g *GeoPackage) getTableColumns(table string) ([]column, error) {
 	var columns []column
 	query := `PRAGMA table_info('%v');`
 	rows, err := g.DB.DB().Query(fmt.Sprintf(query, table))
-
 	if err != nil {
-		log.Fatalf("err during closing rows: %v - %v", query, err)
-		return nil
+		return nil, errors.Wrap(err, "Error reading the columns of "+table)
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var column column
 		err := rows.Scan(&column.cid, &column.name, &column.ctype, &column.notnull, &column.dfltValue, &column.pk)
 		if err != nil {
-			log.Fatalf("error getting the column information: %s", err)
-			return nil
+			return nil, errors.Wrap(err, "Error reading the columns of "+table)
 		}
 		columns = append(columns, column)
 	}
-	defer rows.Close()
-	return columns
+	return columns, rows.Err()
 }
 
 func (g *GeoPackage) UpdateGeometryExtent(tablename string, extent *general.Extent) error {
@@ -909,7 +1011,6 @@ func (g *GeoPackage) CalculateGeometryExtent(tablename string) (*general.Extent,
 		ext        *general.Extent
 		err        error
 		rows       *sql.Rows
-		sb         StandardBinary
 	)
 
 	if err = g.DB.DB().QueryRow(selectGeomColSQL, tablename).Scan(&columnName); err != nil {
@@ -921,27 +1022,33 @@ func (g *GeoPackage) CalculateGeometryExtent(tablename string) (*general.Extent,
 	defer rows.Close()
 
 	for rows.Next() {
-		rows.Scan(&sb)
-		if geom.IsGeometryEmpty(sb.Geometry) {
+		var data []byte
+		if err = rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+		gext, err := BinaryExtent(data)
+		if err != nil {
+			return nil, err
+		}
+		if gext == nil {
 			continue
 		}
 		if ext == nil {
-			ext, err = general.NewExtentFromGeometry(sb.Geometry)
-			if err != nil {
-				ext = nil
-			}
+			ext = gext
 			continue
 		}
-		ext.AddGeometry(sb.Geometry)
+		ext.Add(gext)
 	}
-	return ext, nil
+	return ext, rows.Err()
 }
 
 func (g *GeoPackage) buildTable(t table) error {
-	sql := t.createSQL()
-	_, err := g.DB.DB().Exec(sql)
+	_, err := g.DB.DB().Exec(t.createSQL())
 	if err != nil {
-		log.Fatalf("error building table in target GeoPackage: %s", err)
+		return errors.Wrap(err, "Error creating table "+t.name)
 	}
 
 	err = g.AddGeometryColumn(GeometryColumn{
@@ -953,74 +1060,86 @@ func (g *GeoPackage) buildTable(t table) error {
 		M:                        0,
 	})
 	if err != nil {
-		log.Println("error adding geometry table in target GeoPackage:", err)
-		return err
+		return errors.Wrap(err, "Error adding geometry column of "+t.name)
 	}
 	return nil
 }
 
+// writeFeatures inserts datas into t, committing every p features. When a
+// feature fails the open transaction is rolled back and a *FeatureError is
+// returned, the batches before it stay committed.
 func (g *GeoPackage) writeFeatures(datas []FeatureTable, t table, p int) error {
 	var ext *general.Extent
 
-	var features [][]interface{}
-
-	for i := range datas {
-		feature := datas[i]
+	if p <= 0 {
+		p = len(datas)
+	}
 
-		sb, err := NewBinary(int32(t.srs), feature.geometry)
-		if err != nil {
-			log.Fatalf("Could not create a binary geometry: %s", err)
+	for start := 0; start < len(datas); start += p {
+		end := start + p
+		if end > len(datas) {
+			end = len(datas)
 		}
 
-		data := feature.columns
-		raw, _ := sb.Encode()
-		data = append(data, raw)
-		features = append(features, data)
-
-		if len(features)%p == 0 {
-			writeFeaturesArray(features, g, t)
-			features = nil
-		}
+		var features [][]interface{}
+		for i := start; i < end; i++ {
+			feature := datas[i]
 
-		if ext == nil {
-			ext, err = general.NewExtentFromGeometry(feature.geometry)
+			sb, err := NewBinary(int32(t.srs), feature.geometry)
 			if err != nil {
-				ext = nil
-				log.Println("Failed to create new extent:", err)
+				return &FeatureError{Index: i, ID: feature.id, Err: errors.Wrap(err, "Error encoding geometry")}
+			}
+			raw, err := sb.Encode()
+			if err != nil {
+				return &FeatureError{Index: i, ID: feature.id, Err: errors.Wrap(err, "Error encoding geometry")}
+			}
+			features = append(features, append(feature.columns, raw))
+
+			if geom.IsGeometryEmpty(feature.geometry) {
 				continue
 			}
-		} else {
-			ext.AddGeometry(feature.geometry)
+			fext, err := general.NewExtentFromGeometry(feature.geometry)
+			if err != nil {
+				return &FeatureError{Index: i, ID: feature.id, Err: errors.Wrap(err, "Error calculating extent")}
+			}
+			if ext == nil {
+				ext = fext
+			} else {
+				ext.Add(fext)
+			}
 		}
 
-		if i == len(datas)-1 {
-			writeFeaturesArray(features, g, t)
-			features = nil
+		if err := writeFeaturesArray(features, g, t, datas[start:end], start); err != nil {
+			return err
 		}
 	}
 	return g.UpdateGeometryExtent(t.name, ext)
 }
 
-func writeFeaturesArray(features [][]interface{}, g *GeoPackage, t table) {
+func writeFeaturesArray(features [][]interface{}, g *GeoPackage, t table, datas []FeatureTable, offset int) error {
 	tx, err := g.DB.DB().Begin()
 	if err != nil {
-		log.Fatalf("Could not start a transaction: %s", err)
+		return errors.Wrap(err, "Error starting transaction")
 	}
 
 	stmt, err := tx.Prepare(t.insertSQL())
 	if err != nil {
-		log.Fatalf("Could not prepare a statement: %s", err)
+		tx.Rollback()
+		return errors.Wrap(err, "Error preparing insert into "+t.name)
 	}
+	defer stmt.Close()
 
-	for _, f := range features {
-		_, err = stmt.Exec(f...)
-		if err != nil {
-			log.Fatalf("Could not get a result summary from the prepared statement: %s", err)
+	for i, f := range features {
+		if _, err = stmt.Exec(f...); err != nil {
+			tx.Rollback()
+			return &FeatureError{Index: offset + i, ID: datas[i].id, Err: errors.Wrap(err, "Error inserting into "+t.name)}
 		}
 	}
 
-	stmt.Close()
-	tx.Commit()
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "Error committing features of "+t.name)
+	}
+	return nil
 }
 
 func (g *GeoPackage) saveTileMatrixSet(tms *TileMatrixSet, ts []TileMatrix) error {
@@ -1041,7 +1160,15 @@ func (g *GeoPackage) saveTileMatrixSet(tms *TileMatrixSet, ts []TileMatrix) erro
 	return nil
 }
 
-func (g *GeoPackage) StoreFeatureCollection(table_name string, fc *geom.FeatureCollection) error {
+// StoreOptions changes how StoreFeatureCollection writes features. With
+// ValidateConstraints the properties are checked against the constraints
+// of gpkg_data_columns before anything is written, and a *ConstraintError
+// is returned for the first violation.
+type StoreOptions struct {
+	ValidateConstraints bool
+}
+
+func (g *GeoPackage) StoreFeatureCollection(table_name string, fc *geom.FeatureCollection, opts ...*StoreOptions) error {
 	selectGeomColSQL := `
 	SELECT 
 		column_name,
@@ -1057,14 +1184,22 @@ func (g *GeoPackage) StoreFeatureCollection(table_name string, fc *geom.FeatureC
 	var srs int
 
 	if err := g.DB.DB().QueryRow(selectGeomColSQL, table_name).Scan(&gcolumn, &gtype, &srs); err != nil {
-		return err
+		return errors.Wrap(err, "Error reading geometry column of "+table_name)
 	}
 
 	var tab table
-	columns := g.getTableColumns(table_name)
+	columns, err := g.getTableColumns(table_name)
+	if err != nil {
+		return err
+	}
 
 	if len(columns) != 0 {
-		tab = table{name: table_name, columns: columns, gcolumn: gcolumn, srs: srs, gtype: gtype}
+		tab = table{name: table_name, gcolumn: gcolumn, srs: srs, gtype: gtype}
+		for _, c := range columns {
+			if c.name != gcolumn {
+				tab.columns = append(tab.columns, c)
+			}
+		}
 	} else {
 		tab = buildGeometryTable(table_name, fc, gcolumn, srs, gtype)
 		err := g.buildTable(tab)
@@ -1075,5 +1210,20 @@ func (g *GeoPackage) StoreFeatureCollection(table_name string, fc *geom.FeatureC
 
 	ftables := NewFeatureTable(fc, &tab)
 
-	return g.writeFeatures(ftables, tab, 20)
+	if len(opts) > 0 && opts[0] != nil && opts[0].ValidateConstraints {
+		constraints, err := g.tableConstraints(table_name)
+		if err != nil {
+			return err
+		}
+		for i, f := range ftables {
+			if err := checkConstraints(constraints, tab.columns, f.columns, i, f.id); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = g.writeFeatures(ftables, tab, 20); err != nil {
+		return errors.Wrap(err, "Error storing features in "+table_name)
+	}
+	return nil
 }
@@ -1,11 +1,13 @@
 package gpkg
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"testing"
 
 	"github.com/flywave/go-geo"
+	"github.com/flywave/go-geom"
 	"github.com/flywave/go-geom/general"
 )
 
@@ -20,7 +22,18 @@ func TestWriteGPKGTile(t *testing.T) {
 
 	gpkg.AddTilesTable("test", grid, geo.NewBBoxCoverage(*grid.BBox, grid.Srs, false))
 
-	gpkg.StoreTile("test", 0, 0, 0, []byte("test"))
+	if err := gpkg.StoreTile("test", 0, 0, 0, []byte("test")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := gpkg.GetTile("test", 0, 0, 0); err != nil || string(data) != "test" {
+		t.Fatal(data, err)
+	}
+
+	var dataType string
+	gpkg.DB.DB().QueryRow(`SELECT data_type FROM gpkg_contents WHERE table_name = 'test'`).Scan(&dataType)
+	if dataType != DataTypeTiles {
+		t.FailNow()
+	}
 
 	cov, err := gpkg.GetCoverage("test")
 
@@ -76,3 +89,83 @@ func TestWriteGPKGGeom(t *testing.T) {
 	gpkg.Close()
 	os.Remove("./test.gpkg")
 }
+
+func TestStoreFeatureCollectionError(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	data, _ := ioutil.ReadFile("./data.json")
+	fcs, _ := general.UnmarshalFeatureCollection(data)
+
+	tt := buildGeometryTable("test", fcs, "geom", 4326, "MultiPolygon")
+	if err := gpkg.buildTable(tt); err != nil {
+		t.Fatal(err)
+	}
+	if err := gpkg.StoreFeatureCollection("test", fcs); err != nil {
+		t.Fatal(err)
+	}
+
+	err := gpkg.StoreFeatureCollection("test", fcs)
+	var ferr *FeatureError
+	if !errors.As(err, &ferr) || ferr.Index != 0 || ferr.ID != "AFG" {
+		t.FailNow()
+	}
+
+	count, _ := gpkg.QueryInt(`SELECT count(*) FROM test`)
+	if count != len(fcs.Features) {
+		t.FailNow()
+	}
+}
+
+func TestGetExtent(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	if _, err := gpkg.DB.DB().Exec(`INSERT INTO gpkg_contents (table_name, data_type, identifier, last_change, min_x, min_y, max_x, max_y) VALUES ('test', 'features', 'test', '2020-01-01T00:00:00Z', 1, 2, 3, 4)`); err != nil {
+		t.Fatal(err)
+	}
+	ext, err := gpkg.GetExtent("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ext.MinX() != 1 || ext.MinY() != 2 || ext.MaxX() != 3 || ext.MaxY() != 4 {
+		t.Fatal(ext)
+	}
+}
+
+// createFeatureTestPackage creates ./test.gpkg with the countries of
+// data.json in the MultiPolygon table test, whose spatial index is created
+// before the features are written when indexed.
+func createFeatureTestPackage(t *testing.T, indexed bool) (*GeoPackage, *geom.FeatureCollection) {
+	data, err := ioutil.ReadFile("./data.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcs, err := general.UnmarshalFeatureCollection(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gpkg, err := Open("./test.gpkg", &OpenOptions{Mode: OpenCreate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt := buildGeometryTable("test", fcs, "geom", 4326, "MultiPolygon")
+	if err := gpkg.buildTable(tt); err != nil {
+		gpkg.Close()
+		t.Fatal(err)
+	}
+	if indexed {
+		if err := gpkg.CreateSpatialIndex("test", "geom"); err != nil {
+			gpkg.Close()
+			t.Fatal(err)
+		}
+	}
+	if err := gpkg.writeFeatures(NewFeatureTable(fcs, &tt), tt, 20); err != nil {
+		gpkg.Close()
+		t.Fatal(err)
+	}
+	return gpkg, fcs
+}
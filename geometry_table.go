@@ -14,8 +14,32 @@ const (
 	ID  = "id"
 )
 
+// columnAffinity maps a declared column type, including the GeoPackage
+// data types, to the SQLite type its values are converted to.
+func columnAffinity(ctype string) string {
+	t := strings.ToLower(ctype)
+	if i := strings.IndexByte(t, '('); i >= 0 {
+		t = strings.TrimSpace(t[:i])
+	}
+	switch t {
+	case "boolean", "tinyint", "smallint", "mediumint", "int", "integer":
+		return "integer"
+	case "float", "double", "real":
+		return "real"
+	case "blob":
+		return "blob"
+	case "text", "date", "datetime":
+		return "text"
+	}
+	if strings.Contains(t, "char") {
+		return "varchar"
+	}
+	return t
+}
+
 func changeColumnValue(val interface{}, c *column) interface{} {
-	if strings.Contains(strings.ToLower(c.ctype), "varchar") {
+	affinity := columnAffinity(c.ctype)
+	if affinity == "varchar" {
 		switch v := val.(type) {
 		case string:
 			return v
@@ -35,7 +59,7 @@ func changeColumnValue(val interface{}, c *column) interface{} {
 			data, _ := json.Marshal(val)
 			return string(data)
 		}
-	} else if strings.ToLower(c.ctype) == "integer" {
+	} else if affinity == "integer" {
 		switch v := val.(type) {
 		case string:
 			i, _ := strconv.Atoi(v)
@@ -57,7 +81,7 @@ func changeColumnValue(val interface{}, c *column) interface{} {
 		case float64:
 			return int(v)
 		}
-	} else if strings.ToLower(c.ctype) == "real" {
+	} else if affinity == "real" {
 		switch v := val.(type) {
 		case string:
 			i, _ := strconv.ParseFloat(v, 64)
@@ -77,7 +101,7 @@ func changeColumnValue(val interface{}, c *column) interface{} {
 		case float64:
 			return v
 		}
-	} else if strings.ToLower(c.ctype) == "blob" {
+	} else if affinity == "blob" {
 		switch v := val.(type) {
 		case string:
 			return []byte(v)
@@ -97,7 +121,7 @@ func changeColumnValue(val interface{}, c *column) interface{} {
 			data, _ := json.Marshal(val)
 			return data
 		}
-	} else if strings.ToLower(c.ctype) == "text" {
+	} else if affinity == "text" {
 		switch v := val.(type) {
 		case string:
 			return v
@@ -127,13 +151,7 @@ func newPKColumn(name string, val interface{}) *column {
 		switch val.(type) {
 		case string:
 			return &column{name: name, ctype: "varchar(255)", notnull: 1, pk: 1}
-		case int:
-		case int64:
-		case int32:
-		case uint64:
-		case uint32:
-		case float32:
-		case float64:
+		case int, int64, int32, uint64, uint32, float32, float64:
 			return &column{name: name, ctype: "integer", notnull: 1, pk: 1}
 		}
 	}
@@ -146,20 +164,13 @@ func newValueColumn(name string, val interface{}) *column {
 		return &column{name: name, ctype: "text", notnull: 0, pk: 0}
 	case []byte:
 		return &column{name: name, ctype: "blob", notnull: 0, pk: 0}
-	case bool:
-	case int:
-	case int64:
-	case int32:
-	case uint64:
-	case uint32:
+	case bool, int, int64, int32, uint64, uint32:
 		return &column{name: name, ctype: "integer", notnull: 0, pk: 0}
-	case float32:
-	case float64:
+	case float32, float64:
 		return &column{name: name, ctype: "real", notnull: 0, pk: 0}
 	default:
 		return &column{name: name, ctype: "text", notnull: 0, pk: 0}
 	}
-	return nil
 }
 
 type column struct {
@@ -167,7 +178,7 @@ type column struct {
 	name      string
 	ctype     string
 	notnull   int
-	dfltValue *int
+	dfltValue *string
 	pk        int
 }
 
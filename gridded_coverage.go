@@ -0,0 +1,427 @@
+package gpkg
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+
+	"github.com/flywave/go-geo"
+	"github.com/pkg/errors"
+)
+
+const (
+	GriddedCoverageExtensionName       = "gpkg_2d_gridded_coverage"
+	GriddedCoverageExtensionDefinition = "http://docs.opengeospatial.org/is/17-066r1/17-066r1.html"
+
+	GriddedDataTypeInteger = "integer"
+	GriddedDataTypeFloat   = "float"
+
+	GridValueIsCenter = "grid-value-is-center"
+	GridValueIsArea   = "grid-value-is-area"
+	GridValueIsCorner = "grid-value-is-corner"
+)
+
+// GriddedCoverage describes a tiled gridded coverage, in
+// gpkg_2d_gridded_coverage_ancillary. Integer coverages are stored as
+// 16-bit PNG tiles whose values are scaled by Scale and Offset, float
+// coverages as 32-bit float TIFF tiles. DataNull is the stored value of
+// missing cells.
+type GriddedCoverage struct {
+	Id                 int      `gorm:"column:id;primary_key;AUTO_INCREMENT"`
+	TileMatrixSetName  string   `sql:"type:text" gorm:"column:tile_matrix_set_name;not null;unique"`
+	Datatype           string   `sql:"type:text" gorm:"column:datatype;not null;default:'integer'"`
+	Scale              float64  `gorm:"column:scale;not null;default:1.0"`
+	Offset             float64  `gorm:"column:offset;not null;default:0.0"`
+	Precision          *float64 `gorm:"column:precision;default:1.0"`
+	DataNull           *float64 `gorm:"column:data_null"`
+	GridCellEncoding   string   `sql:"type:text" gorm:"column:grid_cell_encoding;default:'grid-value-is-center'"`
+	Uom                string   `sql:"type:text" gorm:"column:uom"`
+	FieldName          string   `sql:"type:text" gorm:"column:field_name;default:'Height'"`
+	QuantityDefinition string   `sql:"type:text" gorm:"column:quantity_definition;default:'Height'"`
+}
+
+func (GriddedCoverage) TableName() string {
+	return "gpkg_2d_gridded_coverage_ancillary"
+}
+
+// GriddedTile holds the scale, offset and statistics of a coverage tile,
+// in gpkg_2d_gridded_tile_ancillary. The statistics are computed on the
+// coverage values, NULL for tiles without values.
+type GriddedTile struct {
+	Id        int      `gorm:"column:id;primary_key;AUTO_INCREMENT"`
+	TpudtName string   `sql:"type:text" gorm:"column:tpudt_name;not null;unique_index:gta_tpudt"`
+	TpudtId   int64    `gorm:"column:tpudt_id;not null;unique_index:gta_tpudt"`
+	Scale     float64  `gorm:"column:scale;not null;default:1.0"`
+	Offset    float64  `gorm:"column:offset;not null;default:0.0"`
+	Min       *float64 `gorm:"column:min"`
+	Max       *float64 `gorm:"column:max"`
+	Mean      *float64 `gorm:"column:mean"`
+	StdDev    *float64 `gorm:"column:std_dev"`
+}
+
+func (GriddedTile) TableName() string {
+	return "gpkg_2d_gridded_tile_ancillary"
+}
+
+// CoverageGrid is the grid of a coverage tile, Width x Height values in row
+// major order from the top left cell. Missing values are NaN.
+type CoverageGrid struct {
+	Width  int
+	Height int
+	Values []float64
+}
+
+func NewCoverageGrid(width int, height int) *CoverageGrid {
+	return &CoverageGrid{Width: width, Height: height, Values: make([]float64, width*height)}
+}
+
+func (c *CoverageGrid) At(x int, y int) float64 {
+	return c.Values[y*c.Width+x]
+}
+
+func (c *CoverageGrid) Set(x int, y int, v float64) {
+	c.Values[y*c.Width+x] = v
+}
+
+// AddGriddedCoverageTable creates the tiles table of a gridded coverage
+// described by gc, whose TileMatrixSetName is set to table_name, and
+// registers the gridded coverage extension.
+func (g *GeoPackage) AddGriddedCoverageTable(table_name string, grid *geo.TileGrid, cov geo.Coverage, gc *GriddedCoverage) error {
+	switch gc.Datatype {
+	case "":
+		gc.Datatype = GriddedDataTypeInteger
+	case GriddedDataTypeInteger:
+	case GriddedDataTypeFloat:
+		if (gc.Scale != 0 && gc.Scale != 1) || gc.Offset != 0 {
+			return errors.New("float coverages cannot have a scale or an offset")
+		}
+	default:
+		return fmt.Errorf("unknown gridded coverage datatype %v", gc.Datatype)
+	}
+	if gc.Datatype == GriddedDataTypeInteger && gc.DataNull != nil && !isIntegerPixel(*gc.DataNull) {
+		return fmt.Errorf("data_null %v of an integer coverage is not a 16-bit unsigned integer", *gc.DataNull)
+	}
+	if gc.Scale == 0 {
+		gc.Scale = 1
+	}
+	switch gc.GridCellEncoding {
+	case "", GridValueIsCenter, GridValueIsArea, GridValueIsCorner:
+	default:
+		return fmt.Errorf("unknown grid cell encoding %v", gc.GridCellEncoding)
+	}
+
+	if err := g.addTilesTable(table_name, DataType2DGriddedCoverage, grid, cov, nil); err != nil {
+		return err
+	}
+	if err := g.DB.AutoMigrate(GriddedCoverage{}).Error; err != nil {
+		return errors.Wrap(err, "Error migrating GriddedCoverage")
+	}
+	if err := g.DB.AutoMigrate(GriddedTile{}).Error; err != nil {
+		return errors.Wrap(err, "Error migrating GriddedTile")
+	}
+
+	gc.Id = 0
+	gc.TileMatrixSetName = table_name
+	if err := g.DB.Create(gc).Error; err != nil {
+		return errors.Wrap(err, "Error creating gridded coverage "+table_name)
+	}
+
+	tileData := "tile_data"
+	for _, ext := range []Extension{
+		{Table: GriddedCoverage{}.TableName()},
+		{Table: GriddedTile{}.TableName()},
+		{Table: table_name, Column: &tileData},
+	} {
+		ext.Extension = GriddedCoverageExtensionName
+		ext.Definition = GriddedCoverageExtensionDefinition
+		ext.Scope = ExtensionScopeReadWrite
+		if err := g.RegisterExtension(ext); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetGriddedCoverage returns the gridded coverage of table_name.
+func (g *GeoPackage) GetGriddedCoverage(table_name string) (*GriddedCoverage, error) {
+	gc := &GriddedCoverage{}
+	if err := g.DB.Where("tile_matrix_set_name = ?", table_name).First(gc).Error; err != nil {
+		return nil, errors.Wrap(err, "Error reading gridded coverage "+table_name)
+	}
+	return gc, nil
+}
+
+func (g *GeoPackage) getTileMatrix(table_name string, z int) (*TileMatrix, error) {
+	tm := &TileMatrix{}
+	if err := g.DB.Where("table_name = ? AND zoom_level = ?", table_name, z).First(tm).Error; err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error reading tile matrix %v of %v", z, table_name))
+	}
+	return tm, nil
+}
+
+// tileStatistics sets the statistics of t from the non NaN values.
+func tileStatistics(values []float64, t *GriddedTile) {
+	var n, sum, min, max float64
+	for _, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		if n == 0 || v < min {
+			min = v
+		}
+		if n == 0 || v > max {
+			max = v
+		}
+		n++
+		sum += v
+	}
+	if n == 0 {
+		return
+	}
+	mean := sum / n
+	var sq float64
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			sq += (v - mean) * (v - mean)
+		}
+	}
+	stddev := math.Sqrt(sq / n)
+	t.Min, t.Max, t.Mean, t.StdDev = &min, &max, &mean, &stddev
+}
+
+// isIntegerPixel reports whether p is a value of a 16-bit unsigned pixel.
+func isIntegerPixel(p float64) bool {
+	return p == math.Round(p) && p >= 0 && p <= 65535
+}
+
+// encodeIntegerTile quantizes values, in coverage units, to 16-bit
+// integers, setting the scale and offset of t when they do not fit as is.
+func encodeIntegerTile(grid *CoverageGrid, values []float64, dataNull *float64, t *GriddedTile) ([]byte, error) {
+	lo, hi := 0.0, 65535.0
+	if dataNull != nil {
+		if !isIntegerPixel(*dataNull) {
+			return nil, fmt.Errorf("data_null %v of an integer coverage is not a 16-bit unsigned integer", *dataNull)
+		}
+		if *dataNull == lo {
+			lo++
+		} else if *dataNull == hi {
+			hi--
+		}
+	}
+
+	integral := true
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, u := range values {
+		if math.IsNaN(u) {
+			continue
+		}
+		min, max = math.Min(min, u), math.Max(max, u)
+		integral = integral && u == math.Round(u) && u >= lo && u <= hi && (dataNull == nil || u != *dataNull)
+	}
+
+	t.Scale, t.Offset = 1, 0
+	if !integral {
+		if max > min {
+			t.Scale = (max - min) / (hi - lo)
+		}
+		t.Offset = min - lo*t.Scale
+	}
+
+	img := image.NewGray16(image.Rect(0, 0, grid.Width, grid.Height))
+	for i, u := range values {
+		var p float64
+		if math.IsNaN(u) {
+			p = *dataNull
+		} else {
+			p = math.Max(lo, math.Min(hi, math.Round((u-t.Offset)/t.Scale)))
+			if dataNull != nil && p == *dataNull {
+				if p < hi {
+					p++
+				} else {
+					p--
+				}
+			}
+		}
+		img.Pix[2*i] = uint8(uint16(p) >> 8)
+		img.Pix[2*i+1] = uint8(uint16(p))
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// StoreCoverageTile encodes grid according to the gridded coverage of
+// table_name and stores it as the tile z/x/y, with its scale, offset and
+// statistics. NaN values are stored as the data_null of the coverage.
+func (g *GeoPackage) StoreCoverageTile(table_name string, z int, x int, y int, grid *CoverageGrid) error {
+	const (
+		selectTileSQL    = `SELECT id FROM "%v" WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?`
+		deleteTileAncSQL = `DELETE FROM gpkg_2d_gridded_tile_ancillary WHERE tpudt_name = ? AND tpudt_id = ?`
+		insertTileSQL    = `INSERT OR REPLACE INTO "%v" (zoom_level, tile_column, tile_row, tile_data) VALUES (?, ?, ?, ?)`
+		insertTileAncSQL = `INSERT INTO gpkg_2d_gridded_tile_ancillary (tpudt_name, tpudt_id, scale, "offset", min, max, mean, std_dev) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	)
+	gc, err := g.GetGriddedCoverage(table_name)
+	if err != nil {
+		return err
+	}
+	tm, err := g.getTileMatrix(table_name, z)
+	if err != nil {
+		return err
+	}
+	if grid.Width != int(tm.TileWidth) || grid.Height != int(tm.TileHeight) || len(grid.Values) != grid.Width*grid.Height {
+		return fmt.Errorf("grid of %dx%d values for tiles of %dx%d", grid.Width, grid.Height, tm.TileWidth, tm.TileHeight)
+	}
+
+	t := &GriddedTile{TpudtName: table_name, Scale: 1}
+	tileStatistics(grid.Values, t)
+
+	var data []byte
+	values := make([]float64, len(grid.Values))
+	for i, v := range grid.Values {
+		if math.IsNaN(v) && gc.DataNull == nil && gc.Datatype == GriddedDataTypeInteger {
+			return errors.New("grid has missing values but the coverage has no data_null")
+		}
+		values[i] = (v - gc.Offset) / gc.Scale
+	}
+	if gc.Datatype == GriddedDataTypeFloat {
+		pixels := make([]float32, len(values))
+		for i, v := range values {
+			if math.IsNaN(v) && gc.DataNull != nil {
+				v = *gc.DataNull
+			}
+			pixels[i] = float32(v)
+		}
+		if data, err = encodeFloatTiff(grid.Width, grid.Height, pixels); err != nil {
+			return err
+		}
+	} else if data, err = encodeIntegerTile(grid, values, gc.DataNull, t); err != nil {
+		return err
+	}
+
+	tx, err := g.DB.DB().Begin()
+	if err != nil {
+		return err
+	}
+	var old int64
+	err = tx.QueryRow(fmt.Sprintf(selectTileSQL, table_name), z, x, y).Scan(&old)
+	if err == nil {
+		_, err = tx.Exec(deleteTileAncSQL, table_name, old)
+	} else if err == sql.ErrNoRows {
+		err = nil
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	res, err := tx.Exec(fmt.Sprintf(insertTileSQL, table_name), z, x, y, data)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if t.TpudtId, err = res.LastInsertId(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err = tx.Exec(insertTileAncSQL, t.TpudtName, t.TpudtId, t.Scale, t.Offset, t.Min, t.Max, t.Mean, t.StdDev); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "Error creating gridded tile")
+	}
+	return tx.Commit()
+}
+
+// GetGriddedTile returns the scale, offset and statistics of the tile
+// z/x/y, or sql.ErrNoRows if there is no such tile. Tiles without
+// ancillary data get a scale of 1 and an offset of 0.
+func (g *GeoPackage) GetGriddedTile(table_name string, z int, x int, y int) (*GriddedTile, error) {
+	const selectSQL = `
+	SELECT t.id, a.id, a.scale, a."offset", a.min, a.max, a.mean, a.std_dev
+	FROM "%v" AS t LEFT JOIN gpkg_2d_gridded_tile_ancillary AS a ON a.tpudt_name = ? AND a.tpudt_id = t.id
+	WHERE t.zoom_level = ? AND t.tile_column = ? AND t.tile_row = ?
+	`
+	var (
+		id            sql.NullInt64
+		scale, offset sql.NullFloat64
+	)
+	t := &GriddedTile{TpudtName: table_name}
+	err := g.DB.DB().QueryRow(fmt.Sprintf(selectSQL, table_name), table_name, z, x, y).Scan(&t.TpudtId, &id, &scale, &offset, &t.Min, &t.Max, &t.Mean, &t.StdDev)
+	if err != nil {
+		return nil, err
+	}
+	t.Id, t.Scale, t.Offset = int(id.Int64), 1, 0
+	if scale.Valid {
+		t.Scale = scale.Float64
+	}
+	if offset.Valid {
+		t.Offset = offset.Float64
+	}
+	return t, nil
+}
+
+// GetCoverageTile decodes the tile z/x/y of the gridded coverage table_name
+// into its values, or returns sql.ErrNoRows if there is no such tile.
+func (g *GeoPackage) GetCoverageTile(table_name string, z int, x int, y int) (*CoverageGrid, error) {
+	gc, err := g.GetGriddedCoverage(table_name)
+	if err != nil {
+		return nil, err
+	}
+	t, err := g.GetGriddedTile(table_name, z, x, y)
+	if err != nil {
+		return nil, err
+	}
+	data, err := g.GetTile(table_name, z, x, y)
+	if err != nil {
+		return nil, err
+	}
+
+	isNull := func(p float64) bool {
+		return math.IsNaN(p) || (gc.DataNull != nil && p == *gc.DataNull)
+	}
+
+	var grid *CoverageGrid
+	if gc.Datatype == GriddedDataTypeFloat {
+		width, height, pixels, err := decodeFloatTiff(data)
+		if err != nil {
+			return nil, err
+		}
+		grid = NewCoverageGrid(width, height)
+		for i, p := range pixels {
+			grid.Values[i] = float64(p)
+		}
+	} else {
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		b := img.Bounds()
+		grid = NewCoverageGrid(b.Dx(), b.Dy())
+		for y := 0; y < grid.Height; y++ {
+			for x := 0; x < grid.Width; x++ {
+				px, py := b.Min.X+x, b.Min.Y+y
+				switch img := img.(type) {
+				case *image.Gray16:
+					grid.Set(x, y, float64(img.Gray16At(px, py).Y))
+				case *image.Gray:
+					grid.Set(x, y, float64(img.GrayAt(px, py).Y))
+				default:
+					grid.Set(x, y, float64(color.Gray16Model.Convert(img.At(px, py)).(color.Gray16).Y))
+				}
+			}
+		}
+	}
+
+	for i, p := range grid.Values {
+		if isNull(p) {
+			grid.Values[i] = math.NaN()
+			continue
+		}
+		grid.Values[i] = (p*t.Scale+t.Offset)*gc.Scale + gc.Offset
+	}
+	return grid, nil
+}
@@ -0,0 +1,158 @@
+package gpkg
+
+import (
+	"database/sql"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/flywave/go-geo"
+)
+
+func newCoverageTestGrid() *geo.TileGrid {
+	conf := geo.DefaultTileGridOptions()
+	conf[geo.TILEGRID_SRS] = geo.NewProj("EPSG:900913")
+	conf[geo.TILEGRID_ORIGIN] = geo.ORIGIN_UL
+	return geo.NewTileGrid(conf)
+}
+
+func TestGriddedCoverage(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	grid := newCoverageTestGrid()
+	cov := geo.NewBBoxCoverage(*grid.BBox, grid.Srs, false)
+	null := 65535.0
+	if err := gpkg.AddGriddedCoverageTable("dem", grid, cov, &GriddedCoverage{Scale: 0.1, Offset: -100, DataNull: &null, Uom: "m"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gpkg.AddGriddedCoverageTable("dem_float", grid, cov, &GriddedCoverage{Datatype: GriddedDataTypeFloat}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gpkg.AddGriddedCoverageTable("bad", grid, cov, &GriddedCoverage{Datatype: GriddedDataTypeFloat, Scale: 2}); err == nil {
+		t.FailNow()
+	}
+
+	dataType := ""
+	gpkg.DB.DB().QueryRow(`SELECT data_type FROM gpkg_contents WHERE table_name = 'dem'`).Scan(&dataType)
+	if dataType != DataType2DGriddedCoverage {
+		t.FailNow()
+	}
+	count, _ := gpkg.QueryInt(`SELECT count(*) FROM gpkg_extensions WHERE extension_name = 'gpkg_2d_gridded_coverage'`)
+	if count != 4 {
+		t.FailNow()
+	}
+
+	size := int(grid.TileSize[0])
+	elevation := NewCoverageGrid(size, size)
+	for i := range elevation.Values {
+		elevation.Values[i] = 1000 + float64(i%size)*0.5 + float64(i/size)*0.25
+	}
+	elevation.Set(3, 4, math.NaN())
+
+	for _, table := range []string{"dem", "dem_float"} {
+		if err := gpkg.StoreCoverageTile(table, 1, 0, 1, elevation); err != nil {
+			t.Fatal(err)
+		}
+		// storing again replaces the tile and its ancillary data
+		if err := gpkg.StoreCoverageTile(table, 1, 0, 1, elevation); err != nil {
+			t.Fatal(err)
+		}
+		tiles, _ := gpkg.QueryInt(`SELECT count(*) FROM gpkg_2d_gridded_tile_ancillary WHERE tpudt_name = '` + table + `'`)
+		if tiles != 1 {
+			t.FailNow()
+		}
+
+		res, err := gpkg.GetCoverageTile(table, 1, 0, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Width != size || res.Height != size || !math.IsNaN(res.At(3, 4)) {
+			t.FailNow()
+		}
+		for i, v := range elevation.Values {
+			if !math.IsNaN(v) && math.Abs(res.Values[i]-v) > 0.05 {
+				t.Fatal(table, i, v, res.Values[i])
+			}
+		}
+
+		tile, err := gpkg.GetGriddedTile(table, 1, 0, 1)
+		if err != nil || tile.Min == nil || *tile.Min != 1000 || *tile.Max != elevation.At(size-1, size-1) {
+			t.FailNow()
+		}
+	}
+
+	if _, err := gpkg.GetCoverageTile("dem", 1, 1, 1); err != sql.ErrNoRows {
+		t.FailNow()
+	}
+	if err := gpkg.StoreCoverageTile("dem", 1, 0, 0, NewCoverageGrid(2, 2)); err == nil {
+		t.FailNow()
+	}
+}
+
+func TestFloatTiff(t *testing.T) {
+	values := []float32{1.5, -2, float32(math.NaN()), 1e6, 0, 3.25}
+	data, err := encodeFloatTiff(3, 2, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, _ := detectTileFormat(&data); f != TIFF {
+		t.FailNow()
+	}
+	w, h, res, err := decodeFloatTiff(data)
+	if err != nil || w != 3 || h != 2 {
+		t.Fatal(err)
+	}
+	for i := range values {
+		if res[i] != values[i] && !(math.IsNaN(float64(res[i])) && math.IsNaN(float64(values[i]))) {
+			t.FailNow()
+		}
+	}
+}
+
+func TestIntegerCoverageDataNull(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	grid := newCoverageTestGrid()
+	for _, null := range []float64{-9999, 12.5, 65536} {
+		null := null
+		if err := gpkg.AddGriddedCoverageTable("bad", grid, nil, &GriddedCoverage{DataNull: &null}); err == nil {
+			t.Fatal(null)
+		}
+	}
+
+	null := 0.0
+	if err := gpkg.AddGriddedCoverageTable("dem", grid, nil, &GriddedCoverage{DataNull: &null}); err != nil {
+		t.Fatal(err)
+	}
+	size := int(grid.TileSize[0])
+	elevation := NewCoverageGrid(size, size)
+	for i := range elevation.Values {
+		elevation.Values[i] = float64(i%size) - 100
+	}
+	elevation.Set(0, 0, math.NaN())
+	elevation.Set(5, 7, math.NaN())
+	if err := gpkg.StoreCoverageTile("dem", 0, 0, 0, elevation); err != nil {
+		t.Fatal(err)
+	}
+	res, err := gpkg.GetCoverageTile("dem", 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range elevation.Values {
+		if math.IsNaN(v) != math.IsNaN(res.Values[i]) || (!math.IsNaN(v) && math.Abs(res.Values[i]-v) > 0.01) {
+			t.Fatal(i, v, res.Values[i])
+		}
+	}
+
+	// packages written elsewhere may have an unusable data_null
+	if _, err := gpkg.DB.DB().Exec(`UPDATE gpkg_2d_gridded_coverage_ancillary SET data_null = -9999 WHERE tile_matrix_set_name = 'dem'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := gpkg.StoreCoverageTile("dem", 0, 0, 0, elevation); err == nil {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,205 @@
+package gpkg
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FieldType is a GeoPackage column data type.
+type FieldType string
+
+const (
+	FieldTypeBoolean   FieldType = "BOOLEAN"
+	FieldTypeTinyInt   FieldType = "TINYINT"
+	FieldTypeSmallInt  FieldType = "SMALLINT"
+	FieldTypeMediumInt FieldType = "MEDIUMINT"
+	FieldTypeInt       FieldType = "INT"
+	FieldTypeInteger   FieldType = "INTEGER"
+	FieldTypeFloat     FieldType = "FLOAT"
+	FieldTypeDouble    FieldType = "DOUBLE"
+	FieldTypeReal      FieldType = "REAL"
+	FieldTypeText      FieldType = "TEXT"
+	FieldTypeBlob      FieldType = "BLOB"
+	FieldTypeDate      FieldType = "DATE"
+	FieldTypeDateTime  FieldType = "DATETIME"
+)
+
+// Field is a column of a feature or attributes table. Size is the maximum
+// length of TEXT and BLOB fields, zero for unbounded. Default is the
+// column default value, none when nil. Alias, Title, Description, MimeType
+// and Constraint, the name of a constraint of the schema or of the
+// GeoPackage, are stored in gpkg_data_columns when one of them is set.
+type Field struct {
+	Name       string
+	Type       FieldType
+	Size       int
+	NotNull    bool
+	Default    interface{}
+	PrimaryKey bool
+
+	Alias       string
+	Title       string
+	Description string
+	MimeType    string
+	Constraint  string
+}
+
+func (f Field) dataColumn(table string) *DataColumn {
+	if f.Alias == "" && f.Title == "" && f.Description == "" && f.MimeType == "" && f.Constraint == "" {
+		return nil
+	}
+	return &DataColumn{
+		Table:          table,
+		Column:         f.Name,
+		Name:           f.Alias,
+		Title:          f.Title,
+		Description:    f.Description,
+		MimeType:       f.MimeType,
+		ConstraintName: f.Constraint,
+	}
+}
+
+func (f Field) sqlType() string {
+	if f.Size > 0 && (f.Type == FieldTypeText || f.Type == FieldTypeBlob) {
+		return fmt.Sprintf("%s(%d)", f.Type, f.Size)
+	}
+	return string(f.Type)
+}
+
+func sqlLiteral(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return "'" + strings.Replace(v, "'", "''", -1) + "'", nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case []byte:
+		return fmt.Sprintf("X'%X'", v), nil
+	default:
+		return "", fmt.Errorf("unsupported default value %v", v)
+	}
+}
+
+func (f Field) sql() (string, error) {
+	if f.Name == "" {
+		return "", errors.New("field has no name")
+	}
+	if f.PrimaryKey {
+		if f.Type != FieldTypeInteger && f.Type != FieldTypeInt {
+			return "", fmt.Errorf("primary key %s must be an INTEGER", f.Name)
+		}
+		return quoteIdentifier(f.Name) + " INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL", nil
+	}
+	if f.Type == "" {
+		return "", fmt.Errorf("field %s has no type", f.Name)
+	}
+	part := quoteIdentifier(f.Name) + " " + f.sqlType()
+	if f.NotNull {
+		part += " NOT NULL"
+	}
+	if f.Default != nil {
+		def, err := sqlLiteral(f.Default)
+		if err != nil {
+			return "", err
+		}
+		part += " DEFAULT " + def
+	}
+	return part, nil
+}
+
+// LayerSchema describes a feature or attributes table. When none of the
+// fields is the primary key an INTEGER fid primary key is added.
+// Constraints are stored in gpkg_data_column_constraints with the table.
+type LayerSchema struct {
+	Name        string
+	Fields      []Field
+	Constraints []DataColumnConstraint
+}
+
+func (s *LayerSchema) primaryKey() string {
+	for _, f := range s.Fields {
+		if f.PrimaryKey {
+			return f.Name
+		}
+	}
+	return ""
+}
+
+// storeDataColumns stores the constraints and column descriptions of s.
+func (g *GeoPackage) storeDataColumns(s *LayerSchema) error {
+	if len(s.Constraints) > 0 {
+		if err := g.AddDataColumnConstraints(s.Constraints...); err != nil {
+			return err
+		}
+	}
+	for _, f := range s.Fields {
+		if dc := f.dataColumn(s.Name); dc != nil {
+			if err := g.AddDataColumn(*dc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// createSQL returns the CREATE TABLE statement of s, with a geometry column
+// when gc is not nil.
+func (s *LayerSchema) createSQL(gc *GeometryColumn) (string, error) {
+	if s.Name == "" {
+		return "", errors.New("layer schema has no name")
+	}
+	var parts []string
+	if s.primaryKey() == "" {
+		parts = append(parts, quoteIdentifier(FID)+" INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL")
+	}
+	for _, f := range s.Fields {
+		part, err := f.sql()
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	if gc != nil {
+		parts = append(parts, quoteIdentifier(gc.ColumnName)+" "+strings.ToUpper(gc.GeometryType))
+	}
+	return fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdentifier(s.Name), strings.Join(parts, ", ")), nil
+}
+
+// CreateFeatureTable creates the feature table described by schema and
+// registers it in gpkg_contents and gpkg_geometry_columns with the geometry
+// column gc.
+func (g *GeoPackage) CreateFeatureTable(schema *LayerSchema, gc GeometryColumn) error {
+	if gc.ColumnName == "" {
+		gc.ColumnName = DefaultGeometryColumn
+	}
+	if gc.GeometryType == "" {
+		gc.GeometryType = "GEOMETRY"
+	}
+	gc.GeometryColumnTableName = schema.Name
+
+	stmt, err := schema.createSQL(&gc)
+	if err != nil {
+		return err
+	}
+	if _, err = g.DB.DB().Exec(stmt); err != nil {
+		return err
+	}
+	if err = g.AddGeometryColumn(gc); err != nil {
+		return err
+	}
+	return g.storeDataColumns(schema)
+}
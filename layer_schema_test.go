@@ -0,0 +1,77 @@
+package gpkg
+
+import (
+	"os"
+	"testing"
+
+	"github.com/flywave/go-geom"
+	"github.com/flywave/go-geom/general"
+)
+
+func TestCreateFeatureTable(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	schema := &LayerSchema{
+		Name: "roads",
+		Fields: []Field{
+			{Name: "name", Type: FieldTypeText, Size: 50, NotNull: true, Default: "unnamed"},
+			{Name: "lanes", Type: FieldTypeTinyInt, Default: 2},
+			{Name: "oneway", Type: FieldTypeBoolean},
+			{Name: "width", Type: FieldTypeDouble},
+			{Name: "opened", Type: FieldTypeDate},
+			{Name: "photo", Type: FieldTypeBlob, Size: 1024},
+		},
+	}
+	err := gpkg.CreateFeatureTable(schema, GeometryColumn{ColumnName: "geom", GeometryType: "LINESTRING", SpatialReferenceSystemId: 4326})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columns, err := gpkg.getTableColumns("roads")
+	if err != nil || len(columns) != 8 {
+		t.FailNow()
+	}
+	types := map[string]string{}
+	for _, c := range columns {
+		types[c.name] = c.ctype
+	}
+	if types["fid"] != "INTEGER" || types["name"] != "TEXT(50)" || types["photo"] != "BLOB(1024)" || types["geom"] != "LINESTRING" {
+		t.FailNow()
+	}
+
+	err = gpkg.UpsertFeatures("roads", []*geom.Feature{{
+		Properties: map[string]interface{}{"oneway": true, "width": 7},
+		Geometry:   general.NewLineString([][]float64{{0, 0}, {1, 1}}),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		name   string
+		oneway bool
+		width  float64
+	)
+	gpkg.DB.DB().QueryRow(`SELECT name, oneway, width FROM roads`).Scan(&name, &oneway, &width)
+	if name != "unnamed" || !oneway || width != 7 {
+		t.FailNow()
+	}
+
+	if err := gpkg.CreateFeatureTable(&LayerSchema{Name: "bad", Fields: []Field{{Name: "id", Type: FieldTypeText, PrimaryKey: true}}}, GeometryColumn{}); err == nil {
+		t.FailNow()
+	}
+}
+
+func TestNewValueColumn(t *testing.T) {
+	if c := newValueColumn("a", 1); c == nil || c.ctype != "integer" {
+		t.FailNow()
+	}
+	if c := newValueColumn("a", 1.5); c == nil || c.ctype != "real" {
+		t.FailNow()
+	}
+	if c := newPKColumn("id", int64(1)); c == nil || c.ctype != "integer" {
+		t.FailNow()
+	}
+}
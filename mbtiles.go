@@ -0,0 +1,383 @@
+package gpkg
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+
+	"github.com/flywave/go-geo"
+	"github.com/pkg/errors"
+)
+
+const (
+	WebPExtensionName       = "gpkg_webp"
+	WebPExtensionDefinition = "http://www.geopackage.org/spec/#extension_tiles_webp"
+
+	webMercatorExtent = 20037508.342789244
+	webMercatorMaxLat = 85.0511287798066
+)
+
+func isWebMercator(srs_id int) bool {
+	switch srs_id {
+	case 3857, 900913, 102100, 102113:
+		return true
+	}
+	return false
+}
+
+func readMBTilesMetadata(db *sql.DB) (map[string]string, error) {
+	metadata := map[string]string{}
+	rows, err := db.Query(`SELECT name, value FROM metadata`)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading mbtiles metadata")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, value sql.NullString
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		metadata[name.String] = value.String
+	}
+	return metadata, rows.Err()
+}
+
+// parseMBTilesBounds parses the "left,bottom,right,top" bounds of an
+// MBTiles metadata table, in WGS84 degrees.
+func parseMBTilesBounds(bounds string) (*vec2d.Rect, error) {
+	parts := strings.Split(bounds, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid mbtiles bounds %v", bounds)
+	}
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mbtiles bounds %v", bounds)
+		}
+		v[i] = f
+	}
+	return &vec2d.Rect{
+		Min: vec2d.T{math.Max(v[0], -180), math.Max(v[1], -webMercatorMaxLat)},
+		Max: vec2d.T{math.Min(v[2], 180), math.Min(v[3], webMercatorMaxLat)},
+	}, nil
+}
+
+// parseMBTilesFormat returns the tile format of the "format" of an MBTiles
+// metadata table.
+func parseMBTilesFormat(format string) (TileFormat, error) {
+	switch strings.ToLower(format) {
+	case "png":
+		return PNG, nil
+	case "jpg", "jpeg":
+		return JPG, nil
+	case "webp":
+		return WEBP, nil
+	case "pbf":
+		return PBF, nil
+	}
+	return UNKNOWN, fmt.Errorf("unsupported mbtiles format %v", format)
+}
+
+// ImportMBTiles copies the tiles of the MBTiles file at path into the new
+// tiles table table_name, in EPSG:3857. MBTiles rows count from the bottom
+// of the grid and are flipped to GeoPackage rows. The bounds, zoom levels,
+// name and description of the MBTiles metadata are translated to
+// gpkg_contents and gpkg_tile_matrix. pbf tiles are imported to a vector
+// tiles table and webp tiles register the WebP extension. Every tile must
+// be of the format of the metadata, or of the first tile when it has none.
+// The table is dropped when the import fails.
+func (g *GeoPackage) ImportMBTiles(path string, table_name string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	if g.TableExist(table_name) {
+		return fmt.Errorf("%v already exists", table_name)
+	}
+	if err := g.importMBTiles(path, table_name); err != nil {
+		g.dropTilesTable(table_name)
+		return err
+	}
+	return nil
+}
+
+func (g *GeoPackage) importMBTiles(path string, table_name string) error {
+	const selectSQL = `SELECT zoom_level, tile_column, tile_row, tile_data FROM tiles`
+
+	db, err := sql.Open(DriverName, path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	metadata, err := readMBTilesMetadata(db)
+	if err != nil {
+		return err
+	}
+
+	var format TileFormat
+	if v, ok := metadata["format"]; ok {
+		if format, err = parseMBTilesFormat(v); err != nil {
+			return err
+		}
+	} else {
+		var data []byte
+		if err = db.QueryRow(`SELECT tile_data FROM tiles LIMIT 1`).Scan(&data); err == sql.ErrNoRows {
+			return errors.New("mbtiles has no tiles")
+		} else if err != nil {
+			return err
+		}
+		if format, err = detectTileFormat(&data); err != nil {
+			return errors.Wrap(err, "Error detecting mbtiles format")
+		}
+	}
+
+	minzoom, maxzoom := 0, -1
+	if v, ok := metadata["minzoom"]; ok {
+		if minzoom, err = strconv.Atoi(v); err != nil {
+			return errors.Wrap(err, "Error parsing mbtiles minzoom")
+		}
+	}
+	if v, ok := metadata["maxzoom"]; ok {
+		if maxzoom, err = strconv.Atoi(v); err != nil {
+			return errors.Wrap(err, "Error parsing mbtiles maxzoom")
+		}
+	} else if err = db.QueryRow(`SELECT coalesce(max(zoom_level), -1) FROM tiles`).Scan(&maxzoom); err != nil {
+		return err
+	}
+	if maxzoom < 0 {
+		return errors.New("mbtiles has no tiles")
+	}
+
+	conf := geo.DefaultTileGridOptions()
+	conf[geo.TILEGRID_SRS] = geo.NewProj("EPSG:3857")
+	conf[geo.TILEGRID_ORIGIN] = geo.ORIGIN_UL
+	conf[geo.TILEGRID_NUM_LEVELS] = maxzoom + 1
+	grid := geo.NewTileGrid(conf)
+
+	ll := geo.NewProj(4326)
+	var cov geo.Coverage = geo.NewBBoxCoverage(grid.Srs.TransformRectTo(ll, *grid.BBox, 16), ll, false)
+	if v, ok := metadata["bounds"]; ok {
+		bounds, err := parseMBTilesBounds(v)
+		if err != nil {
+			return err
+		}
+		cov = geo.NewBBoxCoverage(*bounds, ll, false)
+	}
+
+	switch format {
+	case PBF:
+		err = g.AddVectorTilesTable(table_name, grid, cov)
+	case WEBP:
+		if err = g.AddTilesTable(table_name, grid, cov); err == nil {
+			tileData := "tile_data"
+			err = g.RegisterExtension(Extension{
+				Table:      table_name,
+				Column:     &tileData,
+				Extension:  WebPExtensionName,
+				Definition: WebPExtensionDefinition,
+				Scope:      ExtensionScopeReadWrite,
+			})
+		}
+	default:
+		err = g.AddTilesTable(table_name, grid, cov)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = g.DB.DB().Exec(`DELETE FROM gpkg_tile_matrix WHERE table_name = ? AND zoom_level < ?`, table_name, minzoom); err != nil {
+		return err
+	}
+	if desc, ok := metadata["description"]; ok {
+		if _, err = g.DB.DB().Exec(`UPDATE gpkg_contents SET description = ? WHERE table_name = ?`, desc, table_name); err != nil {
+			return err
+		}
+	}
+	if name, ok := metadata["name"]; ok && name != "" {
+		// identifiers are unique, keep the table name when it is taken.
+		if _, err = g.DB.DB().Exec(`UPDATE gpkg_contents SET identifier = ? WHERE table_name = ? AND NOT EXISTS (SELECT 1 FROM gpkg_contents WHERE identifier = ?)`, name, table_name, name); err != nil {
+			return errors.Wrap(err, "Error setting identifier of "+table_name)
+		}
+	}
+
+	rows, err := db.Query(selectSQL)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return g.storeTiles(table_name, func() (*Tile, error) {
+		for rows.Next() {
+			t := &Tile{}
+			if err := rows.Scan(&t.Zoom, &t.Column, &t.Row, &t.Data); err != nil {
+				return nil, err
+			}
+			if t.Zoom < minzoom || t.Zoom > maxzoom {
+				continue
+			}
+			// uncompressed pbf has no signature to detect
+			if f, err := detectTileFormat(&t.Data); f != format && !(format == PBF && err != nil) {
+				return nil, fmt.Errorf("mbtiles tile %d/%d/%d is not %v", t.Zoom, t.Column, t.Row, format)
+			}
+			t.Row = (1 << uint(t.Zoom)) - 1 - t.Row
+			return t, nil
+		}
+		return nil, rows.Err()
+	})
+}
+
+// ExportMBTiles writes the tiles of the web mercator tiles table table_name
+// to a new MBTiles file at path. GeoPackage rows are flipped to the MBTiles
+// bottom up rows, and zoom levels renumbered from the size of their tile
+// matrix. The format is detected from the tiles. The file is removed when
+// the export fails.
+func (g *GeoPackage) ExportMBTiles(table_name string, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%v already exists", path)
+	}
+	if err := g.exportMBTiles(table_name, path); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+func (g *GeoPackage) exportMBTiles(table_name string, path string) error {
+	const (
+		createSQL = `
+		CREATE TABLE metadata (name TEXT, value TEXT);
+		CREATE UNIQUE INDEX metadata_name ON metadata (name);
+		CREATE TABLE tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB);
+		CREATE UNIQUE INDEX tile_index ON tiles (zoom_level, tile_column, tile_row);
+		`
+		selectSQL = `SELECT zoom_level, tile_column, tile_row, tile_data FROM "%v"`
+	)
+
+	srs_id, err := g.GetTileSrsId(table_name)
+	if err != nil {
+		return err
+	}
+	if !isWebMercator(srs_id) {
+		return fmt.Errorf("mbtiles need web mercator tiles, %v is in %v", table_name, srs_id)
+	}
+	grid, err := g.GetTileGrid(table_name)
+	if err != nil {
+		return err
+	}
+	if grid == nil || math.Abs(grid.BBox.Min[0]+webMercatorExtent) > 1 || math.Abs(grid.BBox.Max[1]-webMercatorExtent) > 1 {
+		return fmt.Errorf("tile matrix set of %v is not the web mercator grid", table_name)
+	}
+
+	// zoom levels whose matrix is 2^z x 2^z tiles
+	var matrices []TileMatrix
+	if err = g.DB.Where("table_name = ?", table_name).Order("zoom_level").Find(&matrices).Error; err != nil {
+		return err
+	}
+	zooms := map[int]int{}
+	for _, tm := range matrices {
+		w := tm.MatrixWidth
+		if w == 0 || w&(w-1) != 0 || tm.MatrixHeight != w {
+			return fmt.Errorf("tile matrix %v of %v is not a web mercator level", tm.ZoomLevel, table_name)
+		}
+		zooms[int(tm.ZoomLevel)] = int(math.Log2(float64(w)))
+	}
+
+	format, err := g.GetTileFormat(table_name)
+	if err != nil {
+		return errors.Wrap(err, "Error detecting tile format of "+table_name)
+	}
+
+	db, err := sql.Open(DriverName, path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if _, err = db.Exec(createSQL); err != nil {
+		return errors.Wrap(err, "Error creating mbtiles "+path)
+	}
+
+	rows, err := g.DB.DB().Query(fmt.Sprintf(selectSQL, table_name))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO tiles (zoom_level, tile_column, tile_row, tile_data) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	minzoom, maxzoom := math.MaxInt32, -1
+	for rows.Next() {
+		var (
+			z, x, y int
+			data    []byte
+		)
+		if err = rows.Scan(&z, &x, &y, &data); err != nil {
+			tx.Rollback()
+			return err
+		}
+		mz, ok := zooms[z]
+		if !ok {
+			tx.Rollback()
+			return fmt.Errorf("tile %d/%d/%d of %v has no tile matrix", z, x, y, table_name)
+		}
+		if _, err = stmt.Exec(mz, x, (1<<uint(mz))-1-y, data); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if mz < minzoom {
+			minzoom = mz
+		}
+		if mz > maxzoom {
+			maxzoom = mz
+		}
+	}
+	if err = rows.Err(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if maxzoom < 0 {
+		tx.Rollback()
+		return fmt.Errorf("%v has no tiles", table_name)
+	}
+
+	name, description := table_name, ""
+	g.DB.DB().QueryRow(`SELECT identifier, coalesce(description, '') FROM gpkg_contents WHERE table_name = ?`, table_name).Scan(&name, &description)
+
+	bounds := vec2d.Rect{Min: vec2d.T{-180, -webMercatorMaxLat}, Max: vec2d.T{180, webMercatorMaxLat}}
+	if ext, err := g.GetExtent(table_name); err == nil && ext[2] > ext[0] && ext[3] > ext[1] {
+		rect := vec2d.Rect{Min: vec2d.T{ext[0], ext[1]}, Max: vec2d.T{ext[2], ext[3]}}
+		bounds = geo.NewProj(srs_id).TransformRectTo(geo.NewProj(4326), rect, 16)
+	}
+
+	metadata := [][2]string{
+		{"name", name},
+		{"description", description},
+		{"type", "baselayer"},
+		{"version", "1.1"},
+		{"format", format.String()},
+		{"bounds", fmt.Sprintf("%v,%v,%v,%v", bounds.Min[0], bounds.Min[1], bounds.Max[0], bounds.Max[1])},
+		{"center", fmt.Sprintf("%v,%v,%d", (bounds.Min[0]+bounds.Max[0])/2, (bounds.Min[1]+bounds.Max[1])/2, minzoom)},
+		{"minzoom", strconv.Itoa(minzoom)},
+		{"maxzoom", strconv.Itoa(maxzoom)},
+	}
+	for _, m := range metadata {
+		if _, err = tx.Exec(`INSERT INTO metadata (name, value) VALUES (?, ?)`, m[0], m[1]); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
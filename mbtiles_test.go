@@ -0,0 +1,172 @@
+package gpkg
+
+import (
+	"bytes"
+	"database/sql"
+	"image"
+	"image/png"
+	"os"
+	"testing"
+)
+
+func TestMBTiles(t *testing.T) {
+	defer os.Remove("./test.mbtiles")
+	defer os.Remove("./export.mbtiles")
+
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 256, 256)))
+	tile := buf.Bytes()
+
+	db, err := sql.Open(DriverName, "./test.mbtiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+	CREATE TABLE metadata (name TEXT, value TEXT);
+	CREATE TABLE tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB);
+	INSERT INTO metadata VALUES ('name', 'roads'), ('format', 'png'), ('bounds', '-10,-20,30,40'), ('minzoom', '1'), ('maxzoom', '2'), ('description', 'road network');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// tms rows count from the bottom
+	for _, c := range [][3]int{{1, 0, 0}, {1, 1, 1}, {2, 3, 0}} {
+		if _, err = db.Exec(`INSERT INTO tiles VALUES (?, ?, ?, ?)`, c[0], c[1], c[2], append(tile, byte(c[0]), byte(c[1]), byte(c[2]))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	if err := gpkg.ImportMBTiles("./test.mbtiles", "roads"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := gpkg.GetTile("roads", 1, 0, 1); !bytes.HasSuffix(data, []byte{1, 0, 0}) {
+		t.FailNow()
+	}
+	if data, _ := gpkg.GetTile("roads", 2, 3, 3); !bytes.HasSuffix(data, []byte{2, 3, 0}) {
+		t.FailNow()
+	}
+	if zooms, _ := gpkg.GetTileZoomLevels("roads"); len(zooms) != 2 || zooms[0] != 1 {
+		t.Fatal(zooms)
+	}
+	if w, _ := gpkg.QueryInt(`SELECT matrix_width FROM gpkg_tile_matrix WHERE table_name = 'roads' AND zoom_level = 2`); w != 4 {
+		t.FailNow()
+	}
+	ext, err := gpkg.GetExtent("roads")
+	if err != nil || ext[0] > -1113194 || ext[0] < -1113195 || ext[2] < 3339584 || ext[2] > 3339585 {
+		t.Fatal(ext)
+	}
+	description := ""
+	gpkg.DB.DB().QueryRow(`SELECT description FROM gpkg_contents WHERE table_name = 'roads'`).Scan(&description)
+	if description != "road network" {
+		t.FailNow()
+	}
+
+	if err := gpkg.ExportMBTiles("roads", "./export.mbtiles"); err != nil {
+		t.Fatal(err)
+	}
+	if err := gpkg.ExportMBTiles("roads", "./export.mbtiles"); err == nil {
+		t.FailNow()
+	}
+
+	db, err = sql.Open(DriverName, "./export.mbtiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	metadata, err := readMBTilesMetadata(db)
+	if err != nil || metadata["format"] != "png" || metadata["minzoom"] != "1" || metadata["maxzoom"] != "2" || metadata["name"] != "roads" {
+		t.Fatal(metadata)
+	}
+	bounds, err := parseMBTilesBounds(metadata["bounds"])
+	if err != nil || bounds.Min[0] < -10.001 || bounds.Min[0] > -9.999 || bounds.Max[1] < 39.999 || bounds.Max[1] > 40.001 {
+		t.Fatal(metadata["bounds"])
+	}
+	var data []byte
+	if err := db.QueryRow(`SELECT tile_data FROM tiles WHERE zoom_level = 1 AND tile_column = 1 AND tile_row = 1`).Scan(&data); err != nil || !bytes.HasSuffix(data, []byte{1, 1, 1}) {
+		t.FailNow()
+	}
+}
+
+func TestImportMBTilesFormatMismatch(t *testing.T) {
+	defer os.Remove("./test.mbtiles")
+
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 256, 256)))
+
+	db, err := sql.Open(DriverName, "./test.mbtiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+	CREATE TABLE metadata (name TEXT, value TEXT);
+	CREATE TABLE tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB);
+	INSERT INTO metadata VALUES ('format', 'jpg'), ('maxzoom', '1');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec(`INSERT INTO tiles VALUES (1, 0, 0, ?)`, buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	if err := gpkg.ImportMBTiles("./test.mbtiles", "roads"); err == nil {
+		t.FailNow()
+	}
+	if gpkg.TableExist("roads") {
+		t.FailNow()
+	}
+	if n, _ := gpkg.QueryInt(`SELECT count(*) FROM gpkg_contents WHERE table_name = 'roads'`); n != 0 {
+		t.FailNow()
+	}
+	if n, _ := gpkg.QueryInt(`SELECT count(*) FROM gpkg_tile_matrix WHERE table_name = 'roads'`); n != 0 {
+		t.FailNow()
+	}
+}
+
+func TestImportMBTilesWebP(t *testing.T) {
+	defer os.Remove("./test.mbtiles")
+
+	db, err := sql.Open(DriverName, "./test.mbtiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+	CREATE TABLE metadata (name TEXT, value TEXT);
+	CREATE TABLE tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB);
+	INSERT INTO metadata VALUES ('format', 'webp'), ('maxzoom', '1');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec(`INSERT INTO tiles VALUES (1, 1, 0, ?)`, webpTile); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	if err := gpkg.ImportMBTiles("./test.mbtiles", "imagery"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := gpkg.GetTile("imagery", 1, 1, 1); err != nil || !bytes.Equal(data, webpTile) {
+		t.Fatal(data, err)
+	}
+	if n, _ := gpkg.QueryInt(`SELECT count(*) FROM gpkg_extensions WHERE table_name = 'imagery' AND extension_name = 'gpkg_webp'`); n != 1 {
+		t.FailNow()
+	}
+	if f, _ := gpkg.GetTileFormat("imagery"); f != WEBP {
+		t.Fatal(f)
+	}
+}
@@ -0,0 +1,200 @@
+package gpkg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Media describes a row of a media table, a related table holding
+// attachments with their MIME content type.
+type Media struct {
+	Table       string
+	ID          int64
+	ContentType string
+	Size        int64
+}
+
+// MediaTableName is the media table AttachMedia creates for feature_table.
+func MediaTableName(feature_table string) string {
+	return feature_table + "_media"
+}
+
+// CreateMediaTable creates a media table with the id, data and
+// content_type columns required by the Related Tables Extension.
+func (g *GeoPackage) CreateMediaTable(table_name string) error {
+	return g.CreateAttributesTable(&LayerSchema{
+		Name: table_name,
+		Fields: []Field{
+			{Name: ID, Type: FieldTypeInteger, PrimaryKey: true},
+			{Name: "data", Type: FieldTypeBlob, NotNull: true},
+			{Name: "content_type", Type: FieldTypeText, NotNull: true},
+		},
+	})
+}
+
+// mediaRelation returns the media relation of feature_table, creating the
+// media table and the relation when create is true.
+func (g *GeoPackage) mediaRelation(feature_table string, create bool) (*Relation, error) {
+	rels, err := g.GetRelations(feature_table)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rels {
+		if rels[i].RelationName == RelationTypeMedia {
+			return &rels[i], nil
+		}
+	}
+	if !create {
+		return nil, nil
+	}
+
+	media := MediaTableName(feature_table)
+	if !g.TableExist(media) {
+		if err = g.CreateMediaTable(media); err != nil {
+			return nil, err
+		}
+	}
+	rel := &Relation{
+		BaseTableName:    feature_table,
+		RelatedTableName: media,
+		RelationName:     RelationTypeMedia,
+		MappingTableName: feature_table + "_" + media,
+	}
+	if err = g.AddRelation(rel); err != nil {
+		return nil, err
+	}
+	return rel, nil
+}
+
+// AttachMedia stores the content of r in the media table of feature_table
+// and links it to the feature fid, in one transaction. The media table and
+// its relation are created on first use. The sqlite3 driver has no
+// incremental BLOB I/O, so the content is read in memory before it is
+// inserted.
+func (g *GeoPackage) AttachMedia(feature_table string, fid int64, content_type string, r io.Reader) (*Media, error) {
+	const insertSQL = `INSERT INTO "%v" (data, content_type) VALUES (?, ?)`
+
+	rel, err := g.mediaRelation(feature_table, true)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		data = []byte{}
+	}
+
+	tx, err := g.DB.DB().Begin()
+	if err != nil {
+		return nil, err
+	}
+	res, err := tx.Exec(fmt.Sprintf(insertSQL, rel.RelatedTableName), data, content_type)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	m := rel.MappingTableName
+	if _, err = tx.Exec(fmt.Sprintf(insertRelatedLinkSQL, m, m), fid, id, fid, id); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &Media{Table: rel.RelatedTableName, ID: id, ContentType: content_type, Size: int64(len(data))}, nil
+}
+
+// ListMedia returns the media linked to the feature fid of feature_table,
+// without their content.
+func (g *GeoPackage) ListMedia(feature_table string, fid int64) ([]Media, error) {
+	const selectSQL = `
+	SELECT m."%v", m.content_type, length(m.data)
+	FROM "%v" AS m JOIN "%v" AS r ON r.related_id = m."%v"
+	WHERE r.base_id = ?
+	ORDER BY m."%v"
+	`
+	rels, err := g.GetRelations(feature_table)
+	if err != nil {
+		return nil, err
+	}
+
+	media := make([]Media, 0)
+	for _, rel := range rels {
+		if rel.RelationName != RelationTypeMedia {
+			continue
+		}
+		pk := rel.RelatedPrimaryColumn
+		rows, err := g.DB.DB().Query(fmt.Sprintf(selectSQL, pk, rel.RelatedTableName, rel.MappingTableName, pk, pk), fid)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			m := Media{Table: rel.RelatedTableName}
+			if err := rows.Scan(&m.ID, &m.ContentType, &m.Size); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			media = append(media, m)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return media, nil
+}
+
+// DetachMedia removes the link between the feature fid and media m, and
+// deletes m when no other feature links to it.
+func (g *GeoPackage) DetachMedia(feature_table string, fid int64, m Media) error {
+	const deleteSQL = `DELETE FROM "%v" WHERE id = ? AND NOT EXISTS (SELECT 1 FROM "%v" WHERE related_id = ?)`
+
+	rel, err := g.mediaRelation(feature_table, false)
+	if err != nil || rel == nil {
+		return err
+	}
+	if err = g.RemoveRelatedLink(*rel, fid, m.ID); err != nil {
+		return err
+	}
+	_, err = g.DB.DB().Exec(fmt.Sprintf(deleteSQL, m.Table, rel.MappingTableName), m.ID, m.ID)
+	return err
+}
+
+// MediaReader reads the content of a media row. The sqlite3 driver has no
+// incremental BLOB I/O and SQLite loads a whole BLOB to return any part of
+// it, so the content is read once by OpenMedia and held in memory until
+// the reader is dropped.
+type MediaReader struct {
+	Media
+	r *bytes.Reader
+}
+
+// OpenMedia returns a reader over the content of the row id of the media
+// table table_name.
+func (g *GeoPackage) OpenMedia(table_name string, id int64) (*MediaReader, error) {
+	const selectSQL = `SELECT content_type, data FROM "%v" WHERE id = ?`
+
+	var data []byte
+	r := &MediaReader{Media: Media{Table: table_name, ID: id}}
+	err := g.DB.DB().QueryRow(fmt.Sprintf(selectSQL, table_name), id).Scan(&r.ContentType, &data)
+	if err != nil {
+		return nil, err
+	}
+	r.Size = int64(len(data))
+	r.r = bytes.NewReader(data)
+	return r, nil
+}
+
+func (r *MediaReader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
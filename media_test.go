@@ -0,0 +1,67 @@
+package gpkg
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/flywave/go-geom"
+	"github.com/flywave/go-geom/general"
+)
+
+func TestMedia(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	err := gpkg.CreateFeatureTable(&LayerSchema{Name: "poles"}, GeometryColumn{ColumnName: "geom", GeometryType: "POINT", SpatialReferenceSystemId: 4326})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gpkg.UpsertFeatures("poles", []*geom.Feature{{ID: 1, Properties: map[string]interface{}{}, Geometry: general.NewPoint([]float64{1, 1})}})
+
+	photo := bytes.Repeat([]byte{0xFF, 0xD8, 0x00, 0x01}, 10000)
+	m, err := gpkg.AttachMedia("poles", 1, "image/jpeg", bytes.NewReader(photo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gpkg.AttachMedia("poles", 1, "application/pdf", bytes.NewReader([]byte("%PDF-1.4"))); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := gpkg.ListMedia("poles", 1)
+	if err != nil || len(list) != 2 || list[0].ContentType != "image/jpeg" || list[0].Size != int64(len(photo)) {
+		t.FailNow()
+	}
+
+	r, err := gpkg.OpenMedia(m.Table, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(data, photo) {
+		t.FailNow()
+	}
+
+	if err := gpkg.DetachMedia("poles", 1, list[1]); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := gpkg.ListMedia("poles", 1); len(list) != 1 {
+		t.FailNow()
+	}
+	count, _ := gpkg.QueryInt(`SELECT count(*) FROM poles_media`)
+	if count != 1 {
+		t.FailNow()
+	}
+
+	// A failing link rolls back the media row.
+	gpkg.DB.DB().Exec(`DROP TABLE poles_poles_media`)
+	if _, err := gpkg.AttachMedia("poles", 1, "image/jpeg", bytes.NewReader(photo)); err == nil {
+		t.FailNow()
+	}
+	count, _ = gpkg.QueryInt(`SELECT count(*) FROM poles_media`)
+	if count != 1 {
+		t.FailNow()
+	}
+}
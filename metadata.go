@@ -1,5 +1,37 @@
 package gpkg
 
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	MetadataExtensionName       = "gpkg_metadata"
+	MetadataExtensionDefinition = "http://www.geopackage.org/spec/#extension_metadata"
+
+	MetadataScopeUndefined            = "undefined"
+	MetadataScopeFieldSession         = "fieldSession"
+	MetadataScopeCollectionSession    = "collectionSession"
+	MetadataScopeSeries               = "series"
+	MetadataScopeDataset              = "dataset"
+	MetadataScopeFeatureType          = "featureType"
+	MetadataScopeFeature              = "feature"
+	MetadataScopeAttributeType        = "attributeType"
+	MetadataScopeAttribute            = "attribute"
+	MetadataScopeTile                 = "tile"
+	MetadataScopeModel                = "model"
+	MetadataScopeCatalog              = "catalog"
+	MetadataScopeSchema               = "schema"
+	MetadataScopeTaxonomy             = "taxonomy"
+	MetadataScopeSoftware             = "software"
+	MetadataScopeService              = "service"
+	MetadataScopeCollectionHardware   = "collectionHardware"
+	MetadataScopeNonGeographicDataset = "nonGeographicDataset"
+	MetadataScopeDimensionGroup       = "dimensionGroup"
+	MetadataScopeStyle                = "style"
+)
+
 type Metadata struct {
 	Id            int    `gorm:"column:id;not null;primary_key"`
 	MdScope       string `sql:"type:text" gorm:"column:md_scope;not null;default:'dataset'"`
@@ -11,3 +43,188 @@ type Metadata struct {
 func (Metadata) TableName() string {
 	return "gpkg_metadata"
 }
+
+// registerMetadataExtension creates the metadata tables if needed and
+// registers them in gpkg_extensions.
+func (g *GeoPackage) registerMetadataExtension() error {
+	err := g.DB.AutoMigrate(Metadata{}).Error
+	if err != nil {
+		return errors.Wrap(err, "Error migrating Metadata")
+	}
+	err = g.DB.AutoMigrate(MetadataReference{}).Error
+	if err != nil {
+		return errors.Wrap(err, "Error migrating MetadataReference")
+	}
+	for _, table := range []string{Metadata{}.TableName(), MetadataReference{}.TableName()} {
+		err = g.RegisterExtension(Extension{
+			Table:      table,
+			Extension:  MetadataExtensionName,
+			Definition: MetadataExtensionDefinition,
+			Scope:      ExtensionScopeReadWrite,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddMetadata stores a metadata document and returns it with its id set.
+// An empty scope defaults to dataset and an empty mime type to text/xml.
+func (g *GeoPackage) AddMetadata(scope string, standard_uri string, mime_type string, body string) (*Metadata, error) {
+	if scope == "" {
+		scope = MetadataScopeDataset
+	}
+	if mime_type == "" {
+		mime_type = "text/xml"
+	}
+	if standard_uri == "" {
+		return nil, errors.New("metadata has no standard uri")
+	}
+	if err := g.registerMetadataExtension(); err != nil {
+		return nil, err
+	}
+
+	md := &Metadata{MdScope: scope, MdStandardUri: standard_uri, MimeType: mime_type, Metadata: body}
+	if err := g.DB.Create(md).Error; err != nil {
+		return nil, errors.Wrap(err, "Error creating metadata")
+	}
+	return md, nil
+}
+
+// GetMetadata returns the metadata document with the given id.
+func (g *GeoPackage) GetMetadata(id int) (*Metadata, error) {
+	md := &Metadata{}
+	if err := g.DB.Where("id = ?", id).First(md).Error; err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// UpdateMetadata replaces the content of the metadata document md.Id.
+func (g *GeoPackage) UpdateMetadata(md *Metadata) error {
+	return g.DB.Model(Metadata{}).Where("id = ?", md.Id).Updates(map[string]interface{}{
+		"md_scope":        md.MdScope,
+		"md_standard_uri": md.MdStandardUri,
+		"mime_type":       md.MimeType,
+		"metadata":        md.Metadata,
+	}).Error
+}
+
+// DeleteMetadata deletes the metadata document id and its references.
+// References using it as their parent lose their parent.
+func (g *GeoPackage) DeleteMetadata(id int) error {
+	tx, err := g.DB.DB().Begin()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range []string{
+		`DELETE FROM gpkg_metadata_reference WHERE md_file_id = ?`,
+		`UPDATE gpkg_metadata_reference SET md_parent_id = NULL WHERE md_parent_id = ?`,
+		`DELETE FROM gpkg_metadata WHERE id = ?`,
+	} {
+		if _, err = tx.Exec(stmt, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// MetadataFor returns the metadata referenced at the scope given by the
+// arguments: the whole GeoPackage when table is empty, otherwise a table,
+// a column, a row or a row/col when column and rowid are set.
+func (g *GeoPackage) MetadataFor(table string, column string, rowid *int) ([]Metadata, error) {
+	const selectSQL = `
+	SELECT md_file_id FROM gpkg_metadata_reference
+	WHERE reference_scope = ? AND %v
+	ORDER BY timestamp, md_file_id
+	`
+	metadata := make([]Metadata, 0)
+	if !g.TableExist(MetadataReference{}.TableName()) {
+		return metadata, nil
+	}
+
+	where := "table_name IS NULL"
+	args := []interface{}{referenceScope(table, column, rowid)}
+	if table != "" {
+		where = "table_name = ?"
+		args = append(args, table)
+		if column != "" {
+			where += " AND column_name = ?"
+			args = append(args, column)
+		}
+		if rowid != nil {
+			where += " AND row_id_value = ?"
+			args = append(args, *rowid)
+		}
+	}
+
+	rows, err := g.DB.DB().Query(fmt.Sprintf(selectSQL, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	seen := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		md, err := g.GetMetadata(id)
+		if err != nil {
+			return nil, err
+		}
+		metadata = append(metadata, *md)
+	}
+	return metadata, nil
+}
+
+// MetadataParents returns the chain of parents of the metadata document id,
+// nearest first, following md_parent_id in its references.
+func (g *GeoPackage) MetadataParents(id int) ([]Metadata, error) {
+	const selectSQL = `
+	SELECT md_parent_id FROM gpkg_metadata_reference
+	WHERE md_file_id = ? AND md_parent_id IS NOT NULL
+	ORDER BY timestamp DESC
+	LIMIT 1
+	`
+	parents := make([]Metadata, 0)
+	if !g.TableExist(MetadataReference{}.TableName()) {
+		return parents, nil
+	}
+	seen := map[int]bool{id: true}
+	for {
+		var parent int
+		err := g.DB.DB().QueryRow(selectSQL, id).Scan(&parent)
+		if err != nil {
+			if isNoRows(err) {
+				return parents, nil
+			}
+			return nil, err
+		}
+		if seen[parent] {
+			return nil, fmt.Errorf("metadata %v has a cyclic parent chain", id)
+		}
+		seen[parent] = true
+		md, err := g.GetMetadata(parent)
+		if err != nil {
+			return nil, err
+		}
+		parents = append(parents, *md)
+		id = parent
+	}
+}
@@ -1,7 +1,19 @@
 package gpkg
 
 import (
+	"database/sql"
+	"fmt"
 	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ReferenceScopeGeoPackage = "geopackage"
+	ReferenceScopeTable      = "table"
+	ReferenceScopeColumn     = "column"
+	ReferenceScopeRow        = "row"
+	ReferenceScopeRowCol     = "row/col"
 )
 
 type MetadataReference struct {
@@ -17,3 +29,109 @@ type MetadataReference struct {
 func (MetadataReference) TableName() string {
 	return "gpkg_metadata_reference"
 }
+
+func referenceScope(table string, column string, rowid *int) string {
+	switch {
+	case table == "":
+		return ReferenceScopeGeoPackage
+	case column != "" && rowid != nil:
+		return ReferenceScopeRowCol
+	case column != "":
+		return ReferenceScopeColumn
+	case rowid != nil:
+		return ReferenceScopeRow
+	}
+	return ReferenceScopeTable
+}
+
+func isNoRows(err error) bool {
+	return err == sql.ErrNoRows || errors.Cause(err) == sql.ErrNoRows
+}
+
+// validate checks that the table, column and row of ref match its scope.
+func (ref *MetadataReference) validate() error {
+	var want string
+	switch ref.ReferenceScope {
+	case ReferenceScopeGeoPackage:
+		if ref.Name != "" || ref.ColumnName != "" || ref.RowIdValue != nil {
+			return errors.New("geopackage metadata reference has a table, column or row")
+		}
+		return nil
+	case ReferenceScopeTable, ReferenceScopeColumn, ReferenceScopeRow, ReferenceScopeRowCol:
+		if ref.Name == "" {
+			return fmt.Errorf("%v metadata reference has no table", ref.ReferenceScope)
+		}
+		want = referenceScope(ref.Name, ref.ColumnName, ref.RowIdValue)
+	default:
+		return fmt.Errorf("unknown metadata reference scope %v", ref.ReferenceScope)
+	}
+	if want != ref.ReferenceScope {
+		return fmt.Errorf("%v metadata reference does not match its column and row, expected %v", ref.ReferenceScope, want)
+	}
+	return nil
+}
+
+// ReferenceMetadata links the metadata document ref.MdFileId to the
+// GeoPackage, a table, a column, a row or a row/col. An empty
+// ref.ReferenceScope is derived from the table, column and row set, and a
+// nil ref.Timestamp defaults to now. ref.MdParentId, when set, links the
+// document to the more general metadata it is part of.
+func (g *GeoPackage) ReferenceMetadata(ref *MetadataReference) error {
+	const insertSQL = `
+	INSERT INTO gpkg_metadata_reference
+		(reference_scope, table_name, column_name, row_id_value, timestamp, md_file_id, md_parent_id)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	if ref.ReferenceScope == "" {
+		ref.ReferenceScope = referenceScope(ref.Name, ref.ColumnName, ref.RowIdValue)
+	}
+	if err := ref.validate(); err != nil {
+		return err
+	}
+	if ref.Name != "" && !g.TableExist(ref.Name) {
+		return fmt.Errorf("unknown table %v", ref.Name)
+	}
+	if _, err := g.GetMetadata(ref.MdFileId); err != nil {
+		return errors.Wrap(err, fmt.Sprint("Error getting metadata ", ref.MdFileId))
+	}
+	if ref.MdParentId != nil {
+		if *ref.MdParentId == ref.MdFileId {
+			return errors.New("metadata cannot be its own parent")
+		}
+		if _, err := g.GetMetadata(*ref.MdParentId); err != nil {
+			return errors.Wrap(err, fmt.Sprint("Error getting parent metadata ", *ref.MdParentId))
+		}
+	}
+	if err := g.registerMetadataExtension(); err != nil {
+		return err
+	}
+	if ref.Timestamp == nil {
+		now := time.Now().UTC()
+		ref.Timestamp = &now
+	}
+
+	// table_name and column_name are NULL when not used by the scope.
+	var table, column interface{}
+	if ref.Name != "" {
+		table = ref.Name
+	}
+	if ref.ColumnName != "" {
+		column = ref.ColumnName
+	}
+	_, err := g.DB.DB().Exec(insertSQL, ref.ReferenceScope, table, column, ref.RowIdValue,
+		ref.Timestamp.UTC().Format("2006-01-02T15:04:05.000Z"), ref.MdFileId, ref.MdParentId)
+	if err != nil {
+		return errors.Wrap(err, "Error creating metadata reference")
+	}
+	return nil
+}
+
+// GetMetadataReferences returns the references of the metadata document id.
+func (g *GeoPackage) GetMetadataReferences(id int) ([]MetadataReference, error) {
+	refs := make([]MetadataReference, 0)
+	if !g.TableExist(MetadataReference{}.TableName()) {
+		return refs, nil
+	}
+	err := g.DB.Where("md_file_id = ?", id).Order("timestamp").Find(&refs).Error
+	return refs, err
+}
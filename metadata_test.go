@@ -0,0 +1,80 @@
+package gpkg
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	if err := gpkg.CreateAttributesTable(&LayerSchema{Name: "surveys", Fields: []Field{{Name: "name", Type: FieldTypeText}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	iso := "http://schemas.opengis.net/iso/19139/"
+	series, err := gpkg.AddMetadata(MetadataScopeSeries, iso, "", "<series/>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataset, err := gpkg.AddMetadata("", iso, "text/xml", "<dataset/>")
+	if err != nil || dataset.MdScope != MetadataScopeDataset {
+		t.FailNow()
+	}
+	field, err := gpkg.AddMetadata(MetadataScopeAttribute, iso, "text/plain", "units: m")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gpkg.ReferenceMetadata(&MetadataReference{MdFileId: series.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gpkg.ReferenceMetadata(&MetadataReference{Name: "surveys", MdFileId: dataset.Id, MdParentId: &series.Id}); err != nil {
+		t.Fatal(err)
+	}
+	row := 1
+	if err := gpkg.ReferenceMetadata(&MetadataReference{Name: "surveys", ColumnName: "name", RowIdValue: &row, MdFileId: field.Id, MdParentId: &dataset.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gpkg.ReferenceMetadata(&MetadataReference{ReferenceScope: ReferenceScopeColumn, Name: "surveys", MdFileId: field.Id}); err == nil {
+		t.FailNow()
+	}
+
+	if md, err := gpkg.MetadataFor("", "", nil); err != nil || len(md) != 1 || md[0].Id != series.Id {
+		t.FailNow()
+	}
+	if md, err := gpkg.MetadataFor("surveys", "", nil); err != nil || len(md) != 1 || md[0].Metadata != "<dataset/>" {
+		t.FailNow()
+	}
+	md, err := gpkg.MetadataFor("surveys", "name", &row)
+	if err != nil || len(md) != 1 || md[0].MimeType != "text/plain" {
+		t.FailNow()
+	}
+
+	parents, err := gpkg.MetadataParents(field.Id)
+	if err != nil || len(parents) != 2 || parents[0].Id != dataset.Id || parents[1].Id != series.Id {
+		t.FailNow()
+	}
+
+	refs, err := gpkg.GetMetadataReferences(field.Id)
+	if err != nil || len(refs) != 1 || refs[0].ReferenceScope != ReferenceScopeRowCol || refs[0].Timestamp == nil {
+		t.FailNow()
+	}
+
+	count, _ := gpkg.QueryInt(`SELECT count(*) FROM gpkg_extensions WHERE extension_name = 'gpkg_metadata'`)
+	if count != 2 {
+		t.FailNow()
+	}
+
+	if err := gpkg.DeleteMetadata(dataset.Id); err != nil {
+		t.Fatal(err)
+	}
+	if md, _ := gpkg.MetadataFor("surveys", "", nil); len(md) != 0 {
+		t.FailNow()
+	}
+	if parents, _ := gpkg.MetadataParents(field.Id); len(parents) != 0 {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,757 @@
+package gpkg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/flywave/go-geom"
+	"github.com/flywave/go-geom/general"
+)
+
+// The Mapbox Vector Tile codec is kept here rather than taken from the mvt
+// package of github.com/flywave/go-mapbox. That package places features
+// with a tileid.TileID in web mercator, while the tiles of a GeoPackage
+// use any tile matrix set. Its raw feature writer also drops the id 0, and
+// its reader reports malformed tiles as recovered panics with no cause.
+
+// Geometry types of Mapbox Vector Tile features.
+const (
+	mvtUnknown    = 0
+	mvtPoint      = 1
+	mvtLineString = 2
+	mvtPolygon    = 3
+)
+
+const (
+	mvtMoveTo    = 1
+	mvtLineTo    = 2
+	mvtClosePath = 7
+
+	mvtVersion       = 2
+	mvtDefaultExtent = 4096
+)
+
+// mvtFeature is a feature of a Mapbox Vector Tile layer, with its geometry
+// as commands in the pixel space of the layer extent.
+type mvtFeature struct {
+	ID         *uint64
+	Type       int
+	Geometry   []uint32
+	Properties map[string]interface{}
+}
+
+// mvtLayer is a layer of a Mapbox Vector Tile.
+type mvtLayer struct {
+	Version  uint32
+	Name     string
+	Extent   uint32
+	Features []mvtFeature
+}
+
+// pbReader reads the fields of a protocol buffers message.
+type pbReader struct {
+	data []byte
+	pos  int
+}
+
+var errTruncated = errors.New("truncated protocol buffers message")
+
+func (r *pbReader) more() bool {
+	return r.pos < len(r.data)
+}
+
+func (r *pbReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	r.pos += n
+	return v, nil
+}
+
+func (r *pbReader) key() (int, int, error) {
+	k, err := r.varint()
+	return int(k >> 3), int(k & 7), err
+}
+
+func (r *pbReader) bytes() ([]byte, error) {
+	n, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(r.data)-r.pos) < n {
+		return nil, errTruncated
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+func (r *pbReader) fixed(size int) (uint64, error) {
+	if len(r.data)-r.pos < size {
+		return 0, errTruncated
+	}
+	var v uint64
+	if size == 4 {
+		v = uint64(binary.LittleEndian.Uint32(r.data[r.pos:]))
+	} else {
+		v = binary.LittleEndian.Uint64(r.data[r.pos:])
+	}
+	r.pos += size
+	return v, nil
+}
+
+func (r *pbReader) skip(wire int) error {
+	var err error
+	switch wire {
+	case 0:
+		_, err = r.varint()
+	case 1:
+		_, err = r.fixed(8)
+	case 2:
+		_, err = r.bytes()
+	case 5:
+		_, err = r.fixed(4)
+	default:
+		err = fmt.Errorf("unsupported protocol buffers wire type %d", wire)
+	}
+	return err
+}
+
+func (r *pbReader) packed() ([]uint32, error) {
+	b, err := r.bytes()
+	if err != nil {
+		return nil, err
+	}
+	pr := &pbReader{data: b}
+	vs := []uint32{}
+	for pr.more() {
+		v, err := pr.varint()
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, uint32(v))
+	}
+	return vs, nil
+}
+
+// pbWriter writes the fields of a protocol buffers message.
+type pbWriter struct {
+	buf []byte
+}
+
+func (w *pbWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf = append(w.buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func (w *pbWriter) key(field int, wire int) {
+	w.varint(uint64(field<<3 | wire))
+}
+
+func (w *pbWriter) varintField(field int, v uint64) {
+	w.key(field, 0)
+	w.varint(v)
+}
+
+func (w *pbWriter) bytesField(field int, b []byte) {
+	w.key(field, 2)
+	w.varint(uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *pbWriter) doubleField(field int, v float64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+	w.key(field, 1)
+	w.buf = append(w.buf, b[:]...)
+}
+
+func (w *pbWriter) packedField(field int, vs []uint32) {
+	p := &pbWriter{}
+	for _, v := range vs {
+		p.varint(uint64(v))
+	}
+	w.bytesField(field, p.buf)
+}
+
+func zigzag(v int64) uint32 {
+	return uint32((v << 1) ^ (v >> 63))
+}
+
+func unzigzag(v uint32) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+// decodeMVT decodes the layers of an uncompressed Mapbox Vector Tile.
+func decodeMVT(data []byte) ([]*mvtLayer, error) {
+	r := &pbReader{data: data}
+	layers := []*mvtLayer{}
+	for r.more() {
+		field, wire, err := r.key()
+		if err != nil {
+			return nil, err
+		}
+		if field != 3 || wire != 2 {
+			if err = r.skip(wire); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		b, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		l, err := decodeMVTLayer(b)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, l)
+	}
+	return layers, nil
+}
+
+func decodeMVTLayer(data []byte) (*mvtLayer, error) {
+	type rawFeature struct {
+		mvtFeature
+		tags []uint32
+	}
+	var (
+		keys     []string
+		values   []interface{}
+		features []rawFeature
+	)
+	l := &mvtLayer{Version: 1, Extent: mvtDefaultExtent}
+
+	r := &pbReader{data: data}
+	for r.more() {
+		field, wire, err := r.key()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case field == 15 && wire == 0:
+			v, err := r.varint()
+			if err != nil {
+				return nil, err
+			}
+			l.Version = uint32(v)
+		case field == 1 && wire == 2:
+			b, err := r.bytes()
+			if err != nil {
+				return nil, err
+			}
+			l.Name = string(b)
+		case field == 2 && wire == 2:
+			b, err := r.bytes()
+			if err != nil {
+				return nil, err
+			}
+			f := rawFeature{}
+			fr := &pbReader{data: b}
+			for fr.more() {
+				field, wire, err := fr.key()
+				if err != nil {
+					return nil, err
+				}
+				switch {
+				case field == 1 && wire == 0:
+					id, err := fr.varint()
+					if err != nil {
+						return nil, err
+					}
+					f.ID = &id
+				case field == 2 && wire == 2:
+					if f.tags, err = fr.packed(); err != nil {
+						return nil, err
+					}
+				case field == 3 && wire == 0:
+					t, err := fr.varint()
+					if err != nil {
+						return nil, err
+					}
+					f.Type = int(t)
+				case field == 4 && wire == 2:
+					if f.Geometry, err = fr.packed(); err != nil {
+						return nil, err
+					}
+				default:
+					if err = fr.skip(wire); err != nil {
+						return nil, err
+					}
+				}
+			}
+			features = append(features, f)
+		case field == 3 && wire == 2:
+			b, err := r.bytes()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, string(b))
+		case field == 4 && wire == 2:
+			b, err := r.bytes()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeMVTValue(b)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		case field == 5 && wire == 0:
+			v, err := r.varint()
+			if err != nil {
+				return nil, err
+			}
+			l.Extent = uint32(v)
+		default:
+			if err = r.skip(wire); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, f := range features {
+		if len(f.tags)%2 != 0 {
+			return nil, fmt.Errorf("feature of layer %v has an odd number of tags", l.Name)
+		}
+		f.Properties = make(map[string]interface{}, len(f.tags)/2)
+		for i := 0; i < len(f.tags); i += 2 {
+			k, v := int(f.tags[i]), int(f.tags[i+1])
+			if k >= len(keys) || v >= len(values) {
+				return nil, fmt.Errorf("feature of layer %v has an invalid tag", l.Name)
+			}
+			f.Properties[keys[k]] = values[v]
+		}
+		l.Features = append(l.Features, f.mvtFeature)
+	}
+	return l, nil
+}
+
+func decodeMVTValue(data []byte) (interface{}, error) {
+	var v interface{}
+	r := &pbReader{data: data}
+	for r.more() {
+		field, wire, err := r.key()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case field == 1 && wire == 2:
+			b, err := r.bytes()
+			if err != nil {
+				return nil, err
+			}
+			v = string(b)
+		case field == 2 && wire == 5:
+			b, err := r.fixed(4)
+			if err != nil {
+				return nil, err
+			}
+			v = float64(math.Float32frombits(uint32(b)))
+		case field == 3 && wire == 1:
+			b, err := r.fixed(8)
+			if err != nil {
+				return nil, err
+			}
+			v = math.Float64frombits(b)
+		case field >= 4 && field <= 7 && wire == 0:
+			n, err := r.varint()
+			if err != nil {
+				return nil, err
+			}
+			switch field {
+			case 4:
+				v = int64(n)
+			case 5:
+				v = n
+			case 6:
+				v = int64(n>>1) ^ -int64(n&1)
+			case 7:
+				v = n != 0
+			}
+		default:
+			if err = r.skip(wire); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// encodeMVT encodes layers as an uncompressed Mapbox Vector Tile.
+func encodeMVT(layers []*mvtLayer) []byte {
+	w := &pbWriter{}
+	for _, l := range layers {
+		w.bytesField(3, encodeMVTLayer(l))
+	}
+	return w.buf
+}
+
+func encodeMVTLayer(l *mvtLayer) []byte {
+	var (
+		keys    []string
+		values  []interface{}
+		keyIdx  = map[string]uint32{}
+		valIdx  = map[interface{}]uint32{}
+		version = l.Version
+		extent  = l.Extent
+	)
+	if version == 0 {
+		version = mvtVersion
+	}
+	if extent == 0 {
+		extent = mvtDefaultExtent
+	}
+
+	w := &pbWriter{}
+	w.varintField(15, uint64(version))
+	w.bytesField(1, []byte(l.Name))
+	for _, f := range l.Features {
+		fw := &pbWriter{}
+		if f.ID != nil {
+			fw.varintField(1, *f.ID)
+		}
+		tags := []uint32{}
+		for _, k := range sortedKeys(f.Properties) {
+			v := mvtValue(f.Properties[k])
+			if v == nil {
+				continue
+			}
+			ki, ok := keyIdx[k]
+			if !ok {
+				ki = uint32(len(keys))
+				keyIdx[k] = ki
+				keys = append(keys, k)
+			}
+			vi, ok := valIdx[v]
+			if !ok {
+				vi = uint32(len(values))
+				valIdx[v] = vi
+				values = append(values, v)
+			}
+			tags = append(tags, ki, vi)
+		}
+		if len(tags) > 0 {
+			fw.packedField(2, tags)
+		}
+		fw.varintField(3, uint64(f.Type))
+		fw.packedField(4, f.Geometry)
+		w.bytesField(2, fw.buf)
+	}
+	for _, k := range keys {
+		w.bytesField(3, []byte(k))
+	}
+	for _, v := range values {
+		vw := &pbWriter{}
+		switch v := v.(type) {
+		case string:
+			vw.bytesField(1, []byte(v))
+		case float64:
+			vw.doubleField(3, v)
+		case int64:
+			vw.varintField(4, uint64(v))
+		case uint64:
+			vw.varintField(5, v)
+		case bool:
+			b := uint64(0)
+			if v {
+				b = 1
+			}
+			vw.varintField(7, b)
+		}
+		w.bytesField(4, vw.buf)
+	}
+	w.varintField(5, uint64(extent))
+	return w.buf
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// mvtValue converts a property to one of the value types of the encoder,
+// nil when it has no vector tile representation.
+func mvtValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string, float64, int64, uint64, bool:
+		return v
+	case []byte:
+		return string(v)
+	case float32:
+		return float64(v)
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return uint64(v)
+	case uint8:
+		return uint64(v)
+	case uint16:
+		return uint64(v)
+	case uint32:
+		return uint64(v)
+	case nil:
+		return nil
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// mvtGeometryParts returns the parts of the geometry commands of a feature
+// of type typ, in pixels: the points of a point feature, the lines of a
+// line feature and the closed rings of a polygon feature.
+func mvtGeometryParts(typ int, cmds []uint32) ([][][]float64, error) {
+	var (
+		parts [][][]float64
+		part  [][]float64
+		x, y  int64
+	)
+	for i := 0; i < len(cmds); {
+		id, count := int(cmds[i]&7), int(cmds[i]>>3)
+		i++
+		switch id {
+		case mvtMoveTo, mvtLineTo:
+			if i+2*count > len(cmds) {
+				return nil, errors.New("truncated vector tile geometry")
+			}
+			if id == mvtMoveTo && typ != mvtPoint && len(part) > 0 {
+				parts = append(parts, part)
+				part = nil
+			}
+			for j := 0; j < count; j++ {
+				x += unzigzag(cmds[i])
+				y += unzigzag(cmds[i+1])
+				i += 2
+				if typ == mvtPoint {
+					parts = append(parts, [][]float64{{float64(x), float64(y)}})
+				} else {
+					part = append(part, []float64{float64(x), float64(y)})
+				}
+			}
+		case mvtClosePath:
+			if len(part) > 0 {
+				part = append(part, []float64{part[0][0], part[0][1]})
+			}
+		default:
+			return nil, fmt.Errorf("unknown vector tile geometry command %d", id)
+		}
+	}
+	if len(part) > 0 {
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// ringArea returns the signed area of ring with the shoelace formula, in
+// pixel space where y grows downwards exterior rings have a positive area.
+func ringArea(ring [][]float64) float64 {
+	var a float64
+	for i := 0; i+1 < len(ring); i++ {
+		a += ring[i][0]*ring[i+1][1] - ring[i+1][0]*ring[i][1]
+	}
+	if n := len(ring); n > 0 && (ring[0][0] != ring[n-1][0] || ring[0][1] != ring[n-1][1]) {
+		a += ring[n-1][0]*ring[0][1] - ring[0][0]*ring[n-1][1]
+	}
+	return a / 2
+}
+
+// decodeMVTGeometry returns the geometry of a feature, with the pixel
+// coordinates converted by project. It returns nil for unknown geometries.
+func decodeMVTGeometry(typ int, cmds []uint32, project func(x float64, y float64) []float64) (geom.Geometry, error) {
+	parts, err := mvtGeometryParts(typ, cmds)
+	if err != nil || len(parts) == 0 {
+		return nil, err
+	}
+
+	var polygons [][][][]float64
+	if typ == mvtPolygon {
+		for _, ring := range parts {
+			if len(ring) < 4 {
+				continue
+			}
+			if ringArea(ring) > 0 || len(polygons) == 0 {
+				polygons = append(polygons, [][][]float64{ring})
+			} else {
+				polygons[len(polygons)-1] = append(polygons[len(polygons)-1], ring)
+			}
+		}
+	}
+	for _, part := range parts {
+		for i, p := range part {
+			part[i] = project(p[0], p[1])
+		}
+	}
+
+	switch typ {
+	case mvtPoint:
+		if len(parts) == 1 {
+			return general.NewPoint(parts[0][0]), nil
+		}
+		points := make([][]float64, len(parts))
+		for i := range parts {
+			points[i] = parts[i][0]
+		}
+		return general.NewMultiPoint(points), nil
+	case mvtLineString:
+		if len(parts) == 1 {
+			return general.NewLineString(parts[0]), nil
+		}
+		return general.NewMultiLineString(parts), nil
+	case mvtPolygon:
+		switch len(polygons) {
+		case 0:
+			return nil, nil
+		case 1:
+			return general.NewPolygon(polygons[0]), nil
+		}
+		return general.NewMultiPolygon(polygons), nil
+	}
+	return nil, nil
+}
+
+// mvtGeometryEncoder writes geometry commands with coordinates relative to
+// the previous point.
+type mvtGeometryEncoder struct {
+	cmds []uint32
+	x, y int64
+}
+
+func (e *mvtGeometryEncoder) moveTo(p [2]int64) {
+	e.cmds = append(e.cmds, mvtMoveTo|1<<3, zigzag(p[0]-e.x), zigzag(p[1]-e.y))
+	e.x, e.y = p[0], p[1]
+}
+
+func (e *mvtGeometryEncoder) lineTo(ps [][2]int64) {
+	e.cmds = append(e.cmds, uint32(mvtLineTo|len(ps)<<3))
+	for _, p := range ps {
+		e.cmds = append(e.cmds, zigzag(p[0]-e.x), zigzag(p[1]-e.y))
+		e.x, e.y = p[0], p[1]
+	}
+}
+
+// pixelPath converts coords with project, dropping repeated points and,
+// for rings, the closing point.
+func pixelPath(coords [][]float64, ring bool, project func([]float64) [2]int64) [][2]int64 {
+	path := make([][2]int64, 0, len(coords))
+	for _, c := range coords {
+		p := project(c)
+		if n := len(path); n > 0 && path[n-1] == p {
+			continue
+		}
+		path = append(path, p)
+	}
+	if n := len(path); ring && n > 1 && path[0] == path[n-1] {
+		path = path[:n-1]
+	}
+	return path
+}
+
+func pixelRingArea(ring [][2]int64) float64 {
+	var a float64
+	for i := range ring {
+		j := (i + 1) % len(ring)
+		a += float64(ring[i][0]*ring[j][1] - ring[j][0]*ring[i][1])
+	}
+	return a / 2
+}
+
+// encodeMVTGeometry returns the type and commands of g, with coordinates
+// converted to pixels by project. Exterior rings are written with a
+// positive area and interior rings with a negative one. The type is
+// mvtUnknown when g has nothing left to encode.
+func encodeMVTGeometry(g geom.Geometry, project func([]float64) [2]int64) (int, []uint32) {
+	e := &mvtGeometryEncoder{}
+	points := func(coords [][]float64) int {
+		ps := make([][2]int64, 0, len(coords))
+		for _, c := range coords {
+			ps = append(ps, project(c))
+		}
+		if len(ps) == 0 {
+			return mvtUnknown
+		}
+		e.cmds = append(e.cmds, uint32(mvtMoveTo|len(ps)<<3))
+		for _, p := range ps {
+			e.cmds = append(e.cmds, zigzag(p[0]-e.x), zigzag(p[1]-e.y))
+			e.x, e.y = p[0], p[1]
+		}
+		return mvtPoint
+	}
+	lines := func(lines [][][]float64) int {
+		typ := mvtUnknown
+		for _, l := range lines {
+			path := pixelPath(l, false, project)
+			if len(path) < 2 {
+				continue
+			}
+			e.moveTo(path[0])
+			e.lineTo(path[1:])
+			typ = mvtLineString
+		}
+		return typ
+	}
+	polygons := func(polygons [][][][]float64) int {
+		typ := mvtUnknown
+		for _, rings := range polygons {
+			for i, r := range rings {
+				path := pixelPath(r, true, project)
+				if len(path) < 3 {
+					if i == 0 {
+						break
+					}
+					continue
+				}
+				area := pixelRingArea(path)
+				if area == 0 {
+					if i == 0 {
+						break
+					}
+					continue
+				}
+				if (i == 0) != (area > 0) {
+					for a, b := 0, len(path)-1; a < b; a, b = a+1, b-1 {
+						path[a], path[b] = path[b], path[a]
+					}
+				}
+				e.moveTo(path[0])
+				e.lineTo(path[1:])
+				e.cmds = append(e.cmds, mvtClosePath|1<<3)
+				typ = mvtPolygon
+			}
+		}
+		return typ
+	}
+
+	var typ int
+	switch g := g.(type) {
+	case geom.Point:
+		typ = points([][]float64{g.Data()})
+	case geom.MultiPoint:
+		typ = points(g.Data())
+	case geom.LineString:
+		typ = lines([][][]float64{g.Data()})
+	case geom.MultiLine:
+		typ = lines(g.Data())
+	case geom.Polygon:
+		typ = polygons([][][][]float64{g.Data()})
+	case geom.MultiPolygon:
+		typ = polygons(g.Data())
+	}
+	if typ == mvtUnknown {
+		return mvtUnknown, nil
+	}
+	return typ, e.cmds
+}
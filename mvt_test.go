@@ -0,0 +1,68 @@
+package gpkg
+
+import (
+	"math"
+	"testing"
+
+	"github.com/flywave/go-geom"
+	"github.com/flywave/go-geom/general"
+)
+
+func TestMVTRoundTrip(t *testing.T) {
+	pixel := func(c []float64) [2]int64 {
+		return [2]int64{int64(math.Round(c[0])), int64(math.Round(c[1]))}
+	}
+	identity := func(x float64, y float64) []float64 { return []float64{x, y} }
+
+	// The exterior ring is counterclockwise in pixels and the hole clockwise,
+	// the encoder reverses both.
+	polygon := general.NewPolygon([][][]float64{
+		{{0, 0}, {0, 100}, {100, 100}, {100, 0}, {0, 0}},
+		{{10, 10}, {20, 10}, {20, 20}, {10, 20}, {10, 10}},
+	})
+	typ, cmds := encodeMVTGeometry(polygon, pixel)
+	if typ != mvtPolygon {
+		t.Fatal(typ)
+	}
+	id := uint64(7)
+	data := encodeMVT([]*mvtLayer{{Name: "l", Features: []mvtFeature{
+		{ID: &id, Type: typ, Geometry: cmds, Properties: map[string]interface{}{"s": "a", "n": 1.5, "i": -3, "b": true}},
+	}}})
+
+	layers, err := decodeMVT(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 1 || layers[0].Name != "l" || layers[0].Extent != mvtDefaultExtent || layers[0].Version != mvtVersion {
+		t.Fatal(layers)
+	}
+	f := layers[0].Features[0]
+	if *f.ID != 7 || f.Properties["s"] != "a" || f.Properties["n"] != 1.5 || f.Properties["i"] != int64(-3) || f.Properties["b"] != true {
+		t.Fatal(f)
+	}
+
+	g, err := decodeMVTGeometry(f.Type, f.Geometry, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok := g.(geom.Polygon)
+	if !ok || len(p.Data()) != 2 || len(p.Data()[0]) != 5 {
+		t.Fatal(g)
+	}
+	if ringArea(p.Data()[0]) <= 0 || ringArea(p.Data()[1]) >= 0 {
+		t.Fatal(p.Data())
+	}
+
+	typ, cmds = encodeMVTGeometry(general.NewMultiPoint([][]float64{{1, 2}, {3, 4}}), pixel)
+	g, err = decodeMVTGeometry(typ, cmds, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mp, ok := g.(geom.MultiPoint); !ok || mp.Data()[1][0] != 3 || mp.Data()[1][1] != 4 {
+		t.Fatal(g)
+	}
+
+	if typ, _ = encodeMVTGeometry(general.NewLineString([][]float64{{1, 1}, {1.2, 1.1}}), pixel); typ != mvtUnknown {
+		t.Fatal("degenerate line")
+	}
+}
@@ -0,0 +1,162 @@
+package gpkg
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+const (
+	ApplicationIDGP10 = 0x47503130 // "GP10", GeoPackage 1.0
+	ApplicationIDGP11 = 0x47503131 // "GP11", GeoPackage 1.1
+
+	MinUserVersion = 10000 // 1.0.0
+	MaxUserVersion = 10399 // 1.3.x
+)
+
+type OpenMode int
+
+const (
+	OpenReadOnly OpenMode = iota
+	OpenReadWrite
+	OpenCreate
+)
+
+func (m OpenMode) String() string {
+	switch m {
+	case OpenReadOnly:
+		return "ro"
+	case OpenReadWrite:
+		return "rw"
+	case OpenCreate:
+		return "rwc"
+	default:
+		return ""
+	}
+}
+
+type OpenOptions struct {
+	Mode OpenMode
+}
+
+// InvalidGeoPackageError is returned by Open when the file is a SQLite
+// database but its application_id or user_version do not identify a
+// GeoPackage 1.0 - 1.3.
+type InvalidGeoPackageError struct {
+	Uri           string
+	ApplicationID int
+	UserVersion   int
+}
+
+func (e *InvalidGeoPackageError) Error() string {
+	return fmt.Sprintf("%s is not a GeoPackage (application_id=0x%08X, user_version=%d)", e.Uri, uint32(e.ApplicationID), e.UserVersion)
+}
+
+func IsInvalidGeoPackage(err error) bool {
+	_, ok := errors.Cause(err).(*InvalidGeoPackageError)
+	return ok
+}
+
+// Open opens an existing GeoPackage, or creates one when opts.Mode is
+// OpenCreate. A nil opts opens the file read-only; files opened read-only
+// are never written to.
+func Open(uri string, opts *OpenOptions) (*GeoPackage, error) {
+	mode := OpenReadOnly
+	if opts != nil {
+		mode = opts.Mode
+	}
+	if mode != OpenReadOnly && mode != OpenReadWrite && mode != OpenCreate {
+		return nil, fmt.Errorf("unknown open mode: %d", mode)
+	}
+
+	g := &GeoPackage{Uri: uri}
+	db, err := gorm.Open("sqlite3", DriverName, sqliteDSN(uri, mode))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error opening "+uri)
+	}
+	g.DB = db
+
+	if mode == OpenCreate {
+		blank, err := g.isBlank()
+		if err != nil {
+			g.Close()
+			return nil, errors.Wrap(err, "Error reading "+uri)
+		}
+		if blank {
+			if err = g.DB.Exec(initialSQL).Error; err != nil {
+				g.Close()
+				return nil, errors.Wrap(err, "Error initializing "+uri)
+			}
+			if err = g.AutoMigrate(); err != nil {
+				g.Close()
+				return nil, err
+			}
+			return g, nil
+		}
+	}
+
+	if err = g.validate(); err != nil {
+		g.Close()
+		return nil, err
+	}
+	if mode != OpenReadOnly {
+		if err = g.migrateTileMatrixSet(); err != nil {
+			g.Close()
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+func sqliteDSN(uri string, mode OpenMode) string {
+	path := strings.TrimPrefix(uri, "file:")
+	if i := strings.IndexByte(path, '?'); i >= 0 && strings.HasPrefix(uri, "file:") {
+		path = path[:i]
+	}
+	path = strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(path)
+	dsn := "file:" + path + "?mode=" + mode.String()
+	if mode != OpenReadOnly {
+		dsn += "&_foreign_keys=1"
+	}
+	return dsn
+}
+
+func (g *GeoPackage) isBlank() (bool, error) {
+	var appID, userVersion, tables int
+	if err := g.DB.DB().QueryRow("PRAGMA application_id;").Scan(&appID); err != nil {
+		return false, err
+	}
+	if err := g.DB.DB().QueryRow("PRAGMA user_version;").Scan(&userVersion); err != nil {
+		return false, err
+	}
+	if err := g.DB.DB().QueryRow("SELECT count(*) FROM sqlite_master;").Scan(&tables); err != nil {
+		return false, err
+	}
+	return appID == 0 && userVersion == 0 && tables == 0, nil
+}
+
+func (g *GeoPackage) validate() error {
+	var appID, userVersion int
+	if err := g.DB.DB().QueryRow("PRAGMA application_id;").Scan(&appID); err != nil {
+		if _, serr := os.Stat(g.Uri); os.IsNotExist(serr) {
+			return errors.Wrap(serr, "Error opening "+g.Uri)
+		}
+		return &InvalidGeoPackageError{Uri: g.Uri}
+	}
+	if err := g.DB.DB().QueryRow("PRAGMA user_version;").Scan(&userVersion); err != nil {
+		return errors.Wrap(err, "Error reading user_version of "+g.Uri)
+	}
+
+	switch appID {
+	case ApplicationID:
+		if userVersion >= MinUserVersion && userVersion <= MaxUserVersion {
+			return nil
+		}
+	case ApplicationIDGP10, ApplicationIDGP11:
+		return nil
+	}
+	return &InvalidGeoPackageError{Uri: g.Uri, ApplicationID: appID, UserVersion: userVersion}
+}
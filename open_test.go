@@ -0,0 +1,88 @@
+package gpkg
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+func TestOpenGPKG(t *testing.T) {
+	gpkg, err := Open("./test.gpkg", &OpenOptions{Mode: OpenCreate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gpkg.Close()
+	defer os.Remove("./test.gpkg")
+
+	info, _ := os.Stat("./test.gpkg")
+
+	gpkg, err = Open("./test.gpkg", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gpkg.UpdateSRS(DefaultSpatialReferenceSystem[4326]); err == nil {
+		t.FailNow()
+	}
+
+	gpkg.Close()
+
+	info2, _ := os.Stat("./test.gpkg")
+	if !info.ModTime().Equal(info2.ModTime()) || info.Size() != info2.Size() {
+		t.FailNow()
+	}
+
+	gpkg, err = Open("./test.gpkg", &OpenOptions{Mode: OpenReadWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gpkg.UpdateSRS(DefaultSpatialReferenceSystem[4326]); err != nil {
+		t.Fatal(err)
+	}
+	gpkg.Close()
+}
+
+func TestOpenNotGPKG(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "./test.sqlite")
+	db.Exec("CREATE TABLE foo (id INTEGER PRIMARY KEY)")
+	db.Close()
+	defer os.Remove("./test.sqlite")
+
+	_, err := Open("./test.sqlite", nil)
+	if !IsInvalidGeoPackage(err) {
+		t.FailNow()
+	}
+
+	if _, err := Open("./not_exist.gpkg", nil); err == nil {
+		t.FailNow()
+	}
+	if _, err := os.Stat("./not_exist.gpkg"); !os.IsNotExist(err) {
+		t.FailNow()
+	}
+}
+
+func TestOpenLegacyTileMatrixSet(t *testing.T) {
+	gpkg, err := Open("./test.gpkg", &OpenOptions{Mode: OpenCreate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("./test.gpkg")
+	// The layout written while the TileMatrixSet.Name tag was malformed.
+	if _, err := gpkg.DB.DB().Exec(`ALTER TABLE gpkg_tile_matrix_set RENAME COLUMN table_name TO name`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gpkg.DB.DB().Exec(`INSERT INTO gpkg_tile_matrix_set (name, srs_id, min_x, min_y, max_x, max_y) VALUES ('tiles', 4326, -180, -90, 180, 90)`); err != nil {
+		t.Fatal(err)
+	}
+	gpkg.Close()
+
+	gpkg, err = Open("./test.gpkg", &OpenOptions{Mode: OpenReadWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gpkg.Close()
+	sets, err := gpkg.GetTileMatrixSets()
+	if err != nil || len(sets) != 1 || sets[0].Name != "tiles" {
+		t.Fatal(sets, err)
+	}
+}
@@ -0,0 +1,252 @@
+package gpkg
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Resampling is the method used to reduce 2x2 child tiles to their parent
+// tile.
+type Resampling int
+
+const (
+	ResamplingNearest Resampling = iota
+	ResamplingAverage
+	ResamplingBilinear
+)
+
+// overviewBatchSize is the number of parent tiles composed before they are
+// stored, reads and writes never overlap so that SQLite does not report the
+// database as locked.
+const overviewBatchSize = 256
+
+// overviewTileMatrix returns the tile matrix of zoom level z of table_name,
+// one level above child, creating it when it does not exist.
+func (g *GeoPackage) overviewTileMatrix(table_name string, z int, child *TileMatrix) (*TileMatrix, error) {
+	matrices := []TileMatrix{}
+	if err := g.DB.Where("table_name = ? AND zoom_level = ?", table_name, z).Find(&matrices).Error; err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error reading tile matrix %v of %v", z, table_name))
+	}
+	if len(matrices) > 0 {
+		tm := &matrices[0]
+		if tm.TileWidth != child.TileWidth || tm.TileHeight != child.TileHeight ||
+			math.Abs(tm.PixelXSize-2*child.PixelXSize) > tm.PixelXSize*1e-9 || math.Abs(tm.PixelYSize-2*child.PixelYSize) > tm.PixelYSize*1e-9 {
+			return nil, fmt.Errorf("tile matrix %v of %v is not the parent of tile matrix %v", z, table_name, child.ZoomLevel)
+		}
+		return tm, nil
+	}
+
+	tm := &TileMatrix{
+		Name:         table_name,
+		ZoomLevel:    int8(z),
+		MatrixWidth:  (child.MatrixWidth + 1) / 2,
+		MatrixHeight: (child.MatrixHeight + 1) / 2,
+		TileWidth:    child.TileWidth,
+		TileHeight:   child.TileHeight,
+		PixelXSize:   2 * child.PixelXSize,
+		PixelYSize:   2 * child.PixelYSize,
+	}
+	if err := g.DB.Create(tm).Error; err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error creating tile matrix %v of %v", z, table_name))
+	}
+	return tm, nil
+}
+
+// overviewParents returns the column and row of the tiles of zoom level z
+// having at least a child at level z + 1.
+func (g *GeoPackage) overviewParents(table_name string, z int) ([][2]int, error) {
+	const selectSQL = `SELECT DISTINCT tile_column / 2, tile_row / 2 FROM "%v" WHERE zoom_level = ? ORDER BY 2, 1`
+
+	rows, err := g.DB.DB().Query(fmt.Sprintf(selectSQL, table_name), z+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parents := make([][2]int, 0)
+	for rows.Next() {
+		var p [2]int
+		if err := rows.Scan(&p[0], &p[1]); err != nil {
+			return nil, err
+		}
+		parents = append(parents, p)
+	}
+	return parents, rows.Err()
+}
+
+// BuildOverviews builds the tiles of zoom levels toZoom to fromZoom - 1 of
+// table_name, each from the 2x2 child tiles of the level below, starting
+// at fromZoom. Missing tile matrices are added to gpkg_tile_matrix. Tiles
+// are PNG or JPEG, parents use the format of their first child, and are
+// composed by runtime.NumCPU() workers.
+func (g *GeoPackage) BuildOverviews(table_name string, fromZoom int, toZoom int, resampling Resampling) error {
+	if toZoom < 0 || toZoom >= fromZoom {
+		return fmt.Errorf("invalid zoom levels %d to %d", fromZoom, toZoom)
+	}
+	child, err := g.getTileMatrix(table_name, fromZoom)
+	if err != nil {
+		return err
+	}
+
+	for z := fromZoom - 1; z >= toZoom; z-- {
+		tm, err := g.overviewTileMatrix(table_name, z, child)
+		if err != nil {
+			return err
+		}
+		parents, err := g.overviewParents(table_name, z)
+		if err != nil {
+			return err
+		}
+		for start := 0; start < len(parents); start += overviewBatchSize {
+			end := start + overviewBatchSize
+			if end > len(parents) {
+				end = len(parents)
+			}
+			tiles, err := g.buildOverviewTiles(table_name, z, tm, parents[start:end], resampling)
+			if err != nil {
+				return err
+			}
+			if err = g.StoreTiles(table_name, tiles); err != nil {
+				return err
+			}
+		}
+		child = tm
+	}
+	return nil
+}
+
+// buildOverviewTiles composes the tiles parents of zoom level z with a
+// bounded pool of workers, skipping the parents without any child.
+func (g *GeoPackage) buildOverviewTiles(table_name string, z int, tm *TileMatrix, parents [][2]int, resampling Resampling) ([]*Tile, error) {
+	var (
+		wg    sync.WaitGroup
+		once  sync.Once
+		first error
+	)
+	tiles := make([]*Tile, len(parents))
+	jobs := make(chan int)
+
+	workers := runtime.NumCPU()
+	if workers > len(parents) {
+		workers = len(parents)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				t, err := g.buildOverviewTile(table_name, z, tm, parents[i], resampling)
+				if err != nil {
+					once.Do(func() { first = err })
+					continue
+				}
+				tiles[i] = t
+			}
+		}()
+	}
+	for i := range parents {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	if first != nil {
+		return nil, first
+	}
+
+	built := tiles[:0]
+	for _, t := range tiles {
+		if t != nil {
+			built = append(built, t)
+		}
+	}
+	return built, nil
+}
+
+func (g *GeoPackage) buildOverviewTile(table_name string, z int, tm *TileMatrix, parent [2]int, resampling Resampling) (*Tile, error) {
+	w, h := int(tm.TileWidth), int(tm.TileHeight)
+	mosaic := image.NewRGBA(image.Rect(0, 0, 2*w, 2*h))
+	format := UNKNOWN
+
+	for i := 0; i < 4; i++ {
+		dx, dy := i%2, i/2
+		x, y := 2*parent[0]+dx, 2*parent[1]+dy
+		data, err := g.GetTile(table_name, z+1, x, y)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == 0 {
+			continue
+		}
+		img, f, err := decodeTileImage(data)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error decoding tile %d/%d/%d of %v", z+1, x, y, table_name))
+		}
+		if format == UNKNOWN {
+			format = f
+		}
+		draw.Draw(mosaic, image.Rect(dx*w, dy*h, (dx+1)*w, (dy+1)*h), img, img.Bounds().Min, draw.Src)
+	}
+	if format == UNKNOWN {
+		return nil, nil
+	}
+
+	data, err := encodeTileImage(downsample(mosaic, resampling), format)
+	if err != nil {
+		return nil, err
+	}
+	return &Tile{Zoom: z, Column: parent[0], Row: parent[1], Data: data}, nil
+}
+
+// downsample halves the size of src. Average is a 2x2 box filter and
+// Bilinear a tent filter spanning 4x4 pixels.
+func downsample(src *image.RGBA, resampling Resampling) *image.RGBA {
+	w, h := src.Rect.Dx()/2, src.Rect.Dy()/2
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	var taps []int
+	var weights []float64
+	switch resampling {
+	case ResamplingAverage:
+		taps, weights = []int{0, 1}, []float64{1, 1}
+	case ResamplingBilinear:
+		taps, weights = []int{-1, 0, 1, 2}, []float64{1, 3, 3, 1}
+	default:
+		taps, weights = []int{0}, []float64{1}
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sum [4]float64
+			var total float64
+			for j, ty := range taps {
+				sy := 2*y + ty
+				if sy < 0 || sy >= 2*h {
+					continue
+				}
+				for i, tx := range taps {
+					sx := 2*x + tx
+					if sx < 0 || sx >= 2*w {
+						continue
+					}
+					wt := weights[i] * weights[j]
+					p := src.Pix[src.PixOffset(sx, sy):]
+					for c := 0; c < 4; c++ {
+						sum[c] += wt * float64(p[c])
+					}
+					total += wt
+				}
+			}
+			d := dst.Pix[dst.PixOffset(x, y):]
+			for c := 0; c < 4; c++ {
+				d[c] = uint8(math.Round(sum[c] / total))
+			}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,80 @@
+package gpkg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"testing"
+)
+
+func solidPNG(t *testing.T, c color.RGBA) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestBuildOverviews(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	grid := newCoverageTestGrid()
+	if err := gpkg.AddTilesTable("tiles", grid, nil, &TilesTableOptions{Levels: []int{2}}); err != nil {
+		t.Fatal(err)
+	}
+	tiles := []*Tile{
+		{Zoom: 2, Column: 0, Row: 0, Data: solidPNG(t, color.RGBA{255, 0, 0, 255})},
+		{Zoom: 2, Column: 1, Row: 0, Data: solidPNG(t, color.RGBA{0, 255, 0, 255})},
+		{Zoom: 2, Column: 0, Row: 1, Data: solidPNG(t, color.RGBA{0, 0, 255, 255})},
+	}
+	if err := gpkg.StoreTiles("tiles", tiles); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gpkg.BuildOverviews("tiles", 2, 0, ResamplingBilinear); err != nil {
+		t.Fatal(err)
+	}
+	zooms, err := gpkg.GetTileZoomLevels("tiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zooms) != 3 || zooms[0] != 0 {
+		t.Fatal(zooms)
+	}
+	if ok, _ := gpkg.TileExists("tiles", 1, 1, 1); ok {
+		t.Fatal("tile without children")
+	}
+
+	data, err := gpkg.GetTile("tiles", 1, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, _, _ := img.At(0, 0).RGBA(); r>>8 != 255 || g != 0 {
+		t.Fatal(img.At(0, 0))
+	}
+	if r, g, _, _ := img.At(127, 0).RGBA(); r>>8 != 223 || g>>8 != 32 {
+		t.Fatal(img.At(127, 0))
+	}
+	if _, _, _, a := img.At(255, 255).RGBA(); a != 0 {
+		t.Fatal(img.At(255, 255))
+	}
+	if ok, _ := gpkg.TileExists("tiles", 0, 0, 0); !ok {
+		t.Fatal("missing tile 0/0/0")
+	}
+
+	if err := gpkg.BuildOverviews("tiles", 0, 1, ResamplingNearest); err == nil {
+		t.Fatal("invalid zoom levels")
+	}
+}
@@ -0,0 +1,132 @@
+package gpkg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/flywave/go-geom/general"
+)
+
+type OrderBy struct {
+	Column string
+	Desc   bool
+}
+
+// QueryOptions restricts the features returned by GetFeatureReader.
+// Where is a SQL expression whose ? placeholders are bound to Args.
+// Columns selects the property columns to read, the primary key, id and
+// geometry columns are always read. MinFid and MaxFid bound the feature ids
+// inclusively, a zero Limit means no limit.
+type QueryOptions struct {
+	Where   string
+	Args    []interface{}
+	Columns []string
+	OrderBy []OrderBy
+	Limit   int
+	Offset  int
+	MinFid  *int64
+	MaxFid  *int64
+	BBox    *general.Extent
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func (g *GeoPackage) selectColumns(table string, geomColumn string, columns []string) (string, error) {
+	if len(columns) == 0 {
+		return "*", nil
+	}
+	tableColumns, err := g.getTableColumns(table)
+	if err != nil {
+		return "", err
+	}
+	selected := []string{}
+	seen := map[string]bool{}
+	add := func(name string) {
+		if name == "" || seen[name] {
+			return
+		}
+		seen[name] = true
+		selected = append(selected, quoteIdentifier(name))
+	}
+	for _, c := range tableColumns {
+		if c.pk == 1 || c.name == ID || c.name == FID {
+			add(c.name)
+		}
+	}
+	add(geomColumn)
+	for _, c := range columns {
+		add(c)
+	}
+	return strings.Join(selected, ", "), nil
+}
+
+// buildFeatureQuery returns the SELECT statement and its arguments for
+// reading table with opts. The bbox restriction is evaluated with the
+// ST_* functions so that LIMIT and OFFSET apply to the matching features,
+// with the rtree index narrowing the candidates when there is one.
+func (g *GeoPackage) buildFeatureQuery(table string, geomColumn string, opts *QueryOptions) (string, []interface{}, error) {
+	if opts == nil {
+		return fmt.Sprintf("SELECT * FROM %s;", table), nil, nil
+	}
+
+	var (
+		where []string
+		args  []interface{}
+	)
+	fid, err := g.rowIdColumn(table)
+	if err != nil {
+		return "", nil, err
+	}
+	columns, err := g.selectColumns(table, geomColumn, opts.Columns)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if opts.Where != "" {
+		where = append(where, "("+opts.Where+")")
+		args = append(args, opts.Args...)
+	}
+	if opts.MinFid != nil {
+		where = append(where, fid+" >= ?")
+		args = append(args, *opts.MinFid)
+	}
+	if opts.MaxFid != nil {
+		where = append(where, fid+" <= ?")
+		args = append(args, *opts.MaxFid)
+	}
+	if opts.BBox != nil && geomColumn != "" {
+		ext := opts.BBox
+		if g.HasSpatialIndex(table, geomColumn) {
+			where = append(where, fmt.Sprintf("%s IN (SELECT id FROM %s WHERE minx <= ? AND maxx >= ? AND miny <= ? AND maxy >= ?)", fid, quoteIdentifier(SpatialIndexName(table, geomColumn))))
+			args = append(args, ext.MaxX(), ext.MinX(), ext.MaxY(), ext.MinY())
+		}
+		c := quoteIdentifier(geomColumn)
+		where = append(where, fmt.Sprintf("ST_MinX(%s) <= ? AND ST_MaxX(%s) >= ? AND ST_MinY(%s) <= ? AND ST_MaxY(%s) >= ?", c, c, c, c))
+		args = append(args, ext.MaxX(), ext.MinX(), ext.MaxY(), ext.MinY())
+	}
+
+	stmt := fmt.Sprintf("SELECT %s FROM %s", columns, quoteIdentifier(table))
+	if len(where) > 0 {
+		stmt += " WHERE " + strings.Join(where, " AND ")
+	}
+	if len(opts.OrderBy) > 0 {
+		order := make([]string, len(opts.OrderBy))
+		for i, o := range opts.OrderBy {
+			order[i] = quoteIdentifier(o.Column)
+			if o.Desc {
+				order[i] += " DESC"
+			}
+		}
+		stmt += " ORDER BY " + strings.Join(order, ", ")
+	}
+	if opts.Limit > 0 || opts.Offset > 0 {
+		limit := opts.Limit
+		if limit <= 0 {
+			limit = -1
+		}
+		stmt += fmt.Sprintf(" LIMIT %d OFFSET %d", limit, opts.Offset)
+	}
+	return stmt + ";", args, nil
+}
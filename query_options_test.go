@@ -0,0 +1,53 @@
+package gpkg
+
+import (
+	"os"
+	"testing"
+
+	"github.com/flywave/go-geom/general"
+)
+
+func TestFeatureReaderQueryOptions(t *testing.T) {
+	gpkg, _ := createFeatureTestPackage(t, false)
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	read := func(opts *QueryOptions) []string {
+		r, err := gpkg.GetFeatureReader("test", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		names := []string{}
+		for r.Next() {
+			f, err := r.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, f.Properties["name"].(string))
+		}
+		return names
+	}
+
+	names := read(&QueryOptions{
+		Where:   "name LIKE ?",
+		Args:    []interface{}{"A%"},
+		Columns: []string{"name"},
+		OrderBy: []OrderBy{{Column: "name", Desc: true}},
+		Limit:   2,
+		Offset:  1,
+	})
+	if len(names) != 2 || names[0] != "Austria" || names[1] != "Australia" {
+		t.FailNow()
+	}
+
+	min, max := int64(1), int64(10)
+	if names := read(&QueryOptions{MinFid: &min, MaxFid: &max}); len(names) != 10 {
+		t.FailNow()
+	}
+
+	names = read(&QueryOptions{BBox: &general.Extent{65, 30, 70, 35}, Limit: 1})
+	if len(names) != 1 || names[0] != "Afghanistan" {
+		t.FailNow()
+	}
+}
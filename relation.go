@@ -1,15 +1,219 @@
 package gpkg
 
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	RelatedTablesExtensionName       = "related_tables"
+	RelatedTablesExtensionDefinition = "http://docs.opengeospatial.org/is/18-000/18-000.html"
+
+	RelationTypeFeatures         = "features"
+	RelationTypeMedia            = "media"
+	RelationTypeSimpleAttributes = "simple_attributes"
+	RelationTypeAttributes       = "attributes"
+	RelationTypeTiles            = "tiles"
+)
+
 type Relation struct {
-	Id                   int    `gorm:"column:id;uniqu;not null;primary_key"`
+	Id                   int    `gorm:"column:id;primary_key;AUTO_INCREMENT"`
 	BaseTableName        string `gorm:"column:base_table_name;not null"`
 	BasePrimaryColumn    string `gorm:"column:base_primary_column;not null;default:'id'"`
 	RelatedTableName     string `gorm:"column:related_table_name;not null"`
 	RelatedPrimaryColumn string `gorm:"column:related_primary_column;not null;default:'id'"`
 	RelationName         string `gorm:"column:relation_name;not null"`
-	MappingTableName     string `gorm:"column:mapping_table_name;not null"`
+	MappingTableName     string `gorm:"column:mapping_table_name;not null;unique"`
 }
 
 func (Relation) TableName() string {
 	return "gpkgext_relations"
 }
+
+func isRelationName(name string) bool {
+	switch name {
+	case RelationTypeFeatures, RelationTypeMedia, RelationTypeSimpleAttributes, RelationTypeAttributes, RelationTypeTiles:
+		return true
+	}
+	return strings.HasPrefix(name, "x-")
+}
+
+func (g *GeoPackage) primaryKeyColumn(table string) (string, error) {
+	columns, err := g.getTableColumns(table)
+	if err != nil {
+		return "", err
+	}
+	if len(columns) == 0 {
+		return "", fmt.Errorf("unknown table %v", table)
+	}
+	for _, c := range columns {
+		if c.pk == 1 {
+			return c.name, nil
+		}
+	}
+	return ID, nil
+}
+
+// AddRelation registers rel in gpkgext_relations and creates its mapping
+// table, with base_id and related_id columns, if it does not exist yet.
+// Empty primary columns default to the primary keys of the tables. rel.Id
+// is set to the id of the new relation.
+func (g *GeoPackage) AddRelation(rel *Relation) error {
+	const createMappingTableSQL = `
+	CREATE TABLE IF NOT EXISTS "%v" (
+		base_id INTEGER NOT NULL,
+		related_id INTEGER NOT NULL
+	)
+	`
+	var err error
+
+	if !isRelationName(rel.RelationName) {
+		return fmt.Errorf("unknown relation name %v", rel.RelationName)
+	}
+	if rel.MappingTableName == "" {
+		return errors.New("relation has no mapping table")
+	}
+	if rel.BasePrimaryColumn == "" {
+		if rel.BasePrimaryColumn, err = g.primaryKeyColumn(rel.BaseTableName); err != nil {
+			return err
+		}
+	}
+	if rel.RelatedPrimaryColumn == "" {
+		if rel.RelatedPrimaryColumn, err = g.primaryKeyColumn(rel.RelatedTableName); err != nil {
+			return err
+		}
+	}
+
+	if err = g.AutoMigrateRelatedTables(); err != nil {
+		return err
+	}
+	if _, err = g.DB.DB().Exec(fmt.Sprintf(createMappingTableSQL, rel.MappingTableName)); err != nil {
+		return errors.Wrap(err, "Error creating mapping table "+rel.MappingTableName)
+	}
+	if err = g.RegisterExtension(Extension{
+		Table:      rel.MappingTableName,
+		Extension:  RelatedTablesExtensionName,
+		Definition: RelatedTablesExtensionDefinition,
+		Scope:      ExtensionScopeReadWrite,
+	}); err != nil {
+		return err
+	}
+
+	rel.Id = 0
+	if err = g.DB.Create(rel).Error; err != nil {
+		return errors.Wrap(err, "Error creating relation "+rel.MappingTableName)
+	}
+	return nil
+}
+
+// GetRelations returns the relations whose base table is base_table, or all
+// relations when base_table is empty.
+func (g *GeoPackage) GetRelations(base_table string) ([]Relation, error) {
+	relations := make([]Relation, 0)
+	if !g.TableExist(Relation{}.TableName()) {
+		return relations, nil
+	}
+	db := g.DB
+	if base_table != "" {
+		db = db.Where("base_table_name = ?", base_table)
+	}
+	err := db.Find(&relations).Error
+	return relations, err
+}
+
+// GetRelation returns the relation using mapping_table.
+func (g *GeoPackage) GetRelation(mapping_table string) (*Relation, error) {
+	rel := &Relation{}
+	if err := g.DB.Where("mapping_table_name = ?", mapping_table).First(rel).Error; err != nil {
+		return nil, err
+	}
+	return rel, nil
+}
+
+// RemoveRelation unregisters rel and drops its mapping table. The base and
+// related tables are left untouched.
+func (g *GeoPackage) RemoveRelation(rel Relation) error {
+	tx, err := g.DB.DB().Begin()
+	if err != nil {
+		return err
+	}
+	stmts := []struct {
+		sql  string
+		args []interface{}
+	}{
+		{`DELETE FROM gpkgext_relations WHERE mapping_table_name = ?`, []interface{}{rel.MappingTableName}},
+		{`DELETE FROM gpkg_extensions WHERE table_name = ? AND extension_name = ?`, []interface{}{rel.MappingTableName, RelatedTablesExtensionName}},
+		{fmt.Sprintf(`DROP TABLE IF EXISTS "%v"`, rel.MappingTableName), nil},
+	}
+	for _, stmt := range stmts {
+		if _, err = tx.Exec(stmt.sql, stmt.args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// insertRelatedLinkSQL inserts the link between base_id and related_id
+// into a mapping table unless it exists.
+const insertRelatedLinkSQL = `
+	INSERT INTO "%v" (base_id, related_id)
+	SELECT ?, ?
+	WHERE NOT EXISTS (SELECT 1 FROM "%v" WHERE base_id = ? AND related_id = ?)
+	`
+
+// AddRelatedLink links the base row base_id to the related row related_id
+// in the mapping table of rel. Existing links are left as is.
+func (g *GeoPackage) AddRelatedLink(rel Relation, base_id int64, related_id int64) error {
+	m := rel.MappingTableName
+	_, err := g.DB.DB().Exec(fmt.Sprintf(insertRelatedLinkSQL, m, m), base_id, related_id, base_id, related_id)
+	return err
+}
+
+// RemoveRelatedLink removes the link between base_id and related_id.
+func (g *GeoPackage) RemoveRelatedLink(rel Relation, base_id int64, related_id int64) error {
+	const deleteSQL = `DELETE FROM "%v" WHERE base_id = ? AND related_id = ?`
+	_, err := g.DB.DB().Exec(fmt.Sprintf(deleteSQL, rel.MappingTableName), base_id, related_id)
+	return err
+}
+
+// GetRelatedIds returns the ids of the rows related to base_id.
+func (g *GeoPackage) GetRelatedIds(rel Relation, base_id int64) ([]int64, error) {
+	const selectSQL = `SELECT related_id FROM "%v" WHERE base_id = ? ORDER BY related_id`
+	rows, err := g.DB.DB().Query(fmt.Sprintf(selectSQL, rel.MappingTableName), base_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func relatedQueryOptions(rel Relation, base_id int64) *QueryOptions {
+	return &QueryOptions{
+		Where: fmt.Sprintf(`%s IN (SELECT related_id FROM %s WHERE base_id = ?)`, quoteIdentifier(rel.RelatedPrimaryColumn), quoteIdentifier(rel.MappingTableName)),
+		Args:  []interface{}{base_id},
+	}
+}
+
+// GetRelatedFeatures returns a reader over the features related to base_id
+// by a features relation.
+func (g *GeoPackage) GetRelatedFeatures(rel Relation, base_id int64) (*GeoPackageReader, error) {
+	return g.GetFeatureReader(rel.RelatedTableName, relatedQueryOptions(rel, base_id))
+}
+
+// GetRelatedAttributes returns a reader over the rows related to base_id,
+// for relations to attributes, simple attributes and media tables.
+func (g *GeoPackage) GetRelatedAttributes(rel Relation, base_id int64) (*AttributeReader, error) {
+	return g.GetAttributeReader(rel.RelatedTableName, relatedQueryOptions(rel, base_id))
+}
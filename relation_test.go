@@ -0,0 +1,91 @@
+package gpkg
+
+import (
+	"os"
+	"testing"
+
+	"github.com/flywave/go-geom"
+	"github.com/flywave/go-geom/general"
+)
+
+func TestRelatedTables(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	err := gpkg.CreateFeatureTable(&LayerSchema{Name: "parcels", Fields: []Field{{Name: "name", Type: FieldTypeText}}}, GeometryColumn{ColumnName: "geom", GeometryType: "POINT", SpatialReferenceSystemId: 4326})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gpkg.CreateAttributesTable(&LayerSchema{Name: "owners", Fields: []Field{{Name: "name", Type: FieldTypeText}}}); err != nil {
+		t.Fatal(err)
+	}
+	gpkg.UpsertFeatures("parcels", []*geom.Feature{
+		{ID: 1, Properties: map[string]interface{}{"name": "p1"}, Geometry: general.NewPoint([]float64{1, 1})},
+		{ID: 2, Properties: map[string]interface{}{"name": "p2"}, Geometry: general.NewPoint([]float64{2, 2})},
+	})
+	gpkg.StoreAttributes("owners", []*Attributes{
+		{ID: 1, Properties: map[string]interface{}{"name": "Ann"}},
+		{ID: 2, Properties: map[string]interface{}{"name": "Bob"}},
+	})
+
+	rel := &Relation{BaseTableName: "parcels", RelatedTableName: "owners", RelationName: RelationTypeAttributes, MappingTableName: "parcels_owners"}
+	if err := gpkg.AddRelation(rel); err != nil {
+		t.Fatal(err)
+	}
+	if rel.Id == 0 || rel.BasePrimaryColumn != "fid" || rel.RelatedPrimaryColumn != "fid" {
+		t.FailNow()
+	}
+	if err := gpkg.AddRelation(&Relation{BaseTableName: "parcels", RelatedTableName: "owners", RelationName: "owns", MappingTableName: "x"}); err == nil {
+		t.FailNow()
+	}
+
+	count, _ := gpkg.QueryInt(`SELECT count(*) FROM gpkg_extensions WHERE extension_name = 'related_tables' AND table_name IN ('gpkgext_relations', 'parcels_owners') AND definition != 'TBD'`)
+	if count != 2 {
+		t.FailNow()
+	}
+
+	gpkg.AddRelatedLink(*rel, 1, 1)
+	gpkg.AddRelatedLink(*rel, 1, 2)
+	gpkg.AddRelatedLink(*rel, 1, 2)
+	gpkg.AddRelatedLink(*rel, 2, 2)
+
+	ids, err := gpkg.GetRelatedIds(*rel, 1)
+	if err != nil || len(ids) != 2 {
+		t.FailNow()
+	}
+
+	r, err := gpkg.GetRelatedAttributes(*rel, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []interface{}
+	for r.Next() {
+		row, _ := r.Read()
+		names = append(names, row.Properties["name"])
+	}
+	r.Close()
+	if len(names) != 1 || names[0] != "Bob" {
+		t.FailNow()
+	}
+
+	gpkg.RemoveRelatedLink(*rel, 1, 1)
+	if ids, _ := gpkg.GetRelatedIds(*rel, 1); len(ids) != 1 {
+		t.FailNow()
+	}
+
+	rels, err := gpkg.GetRelations("parcels")
+	if err != nil || len(rels) != 1 || rels[0].MappingTableName != "parcels_owners" {
+		t.FailNow()
+	}
+
+	if err := gpkg.RemoveRelation(*rel); err != nil {
+		t.Fatal(err)
+	}
+	if gpkg.TableExist("parcels_owners") {
+		t.FailNow()
+	}
+	if rels, _ := gpkg.GetRelations(""); len(rels) != 0 {
+		t.FailNow()
+	}
+}
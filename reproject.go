@@ -0,0 +1,286 @@
+package gpkg
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/flywave/go-geo"
+	vec2d "github.com/flywave/go3d/float64/vec2"
+	"github.com/pkg/errors"
+)
+
+// warperCacheSize is the number of decoded source tiles above which a
+// tileWarper drops its cache.
+const warperCacheSize = 256
+
+// tileWarper samples the tiles of a level of a tiles table, read through
+// the grid returned by GetTileGrid, at arbitrary coordinates of its srs.
+type tileWarper struct {
+	g     *GeoPackage
+	table string
+	grid  *geo.TileGrid
+	zoom  int
+	level int
+	tiles map[[2]int]*image.RGBA
+}
+
+// load decodes the tiles covering the pixels px, py, in pixels of the level
+// counted from the top left corner of the grid.
+func (w *tileWarper) load(px []float64, py []float64) error {
+	minx, miny, maxx, maxy := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for i := range px {
+		if math.IsNaN(px[i]) || math.IsNaN(py[i]) || math.IsInf(px[i], 0) || math.IsInf(py[i], 0) {
+			continue
+		}
+		minx, maxx = math.Min(minx, px[i]), math.Max(maxx, px[i])
+		miny, maxy = math.Min(miny, py[i]), math.Max(maxy, py[i])
+	}
+	if minx > maxx {
+		return nil
+	}
+
+	if len(w.tiles) > warperCacheSize {
+		w.tiles = map[[2]int]*image.RGBA{}
+	}
+
+	tw, th := float64(w.grid.TileSize[0]), float64(w.grid.TileSize[1])
+	size := w.grid.GridSizes[w.level]
+	c0, c1 := clampInt(int(math.Floor(minx/tw)), 0, int(size[0])-1), clampInt(int(math.Floor((maxx+1)/tw)), 0, int(size[0])-1)
+	r0, r1 := clampInt(int(math.Floor(miny/th)), 0, int(size[1])-1), clampInt(int(math.Floor((maxy+1)/th)), 0, int(size[1])-1)
+	for r := r0; r <= r1; r++ {
+		for c := c0; c <= c1; c++ {
+			key := [2]int{c, r}
+			if _, ok := w.tiles[key]; ok {
+				continue
+			}
+			data, err := w.g.GetTile(w.table, w.zoom, c, r)
+			if err != nil {
+				return err
+			}
+			if len(data) == 0 {
+				w.tiles[key] = nil
+				continue
+			}
+			img, _, err := decodeTileImage(data)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("Error decoding tile %d/%d/%d of %v", w.zoom, c, r, w.table))
+			}
+			w.tiles[key] = img
+		}
+	}
+	return nil
+}
+
+// pixel returns the premultiplied RGBA pixel x, y of the level, transparent
+// outside of the tiles.
+func (w *tileWarper) pixel(x int, y int) [4]float64 {
+	tw, th := int(w.grid.TileSize[0]), int(w.grid.TileSize[1])
+	if x < 0 || y < 0 {
+		return [4]float64{}
+	}
+	img := w.tiles[[2]int{x / tw, y / th}]
+	if img == nil || x%tw >= img.Rect.Dx() || y%th >= img.Rect.Dy() {
+		return [4]float64{}
+	}
+	p := img.Pix[img.PixOffset(x%tw, y%th):]
+	return [4]float64{float64(p[0]), float64(p[1]), float64(p[2]), float64(p[3])}
+}
+
+// sample interpolates the level bilinearly at pixel coordinates px, py,
+// whose integer values are pixel centers.
+func (w *tileWarper) sample(px float64, py float64) [4]float64 {
+	x0, y0 := math.Floor(px), math.Floor(py)
+	fx, fy := px-x0, py-y0
+	var v [4]float64
+	for _, n := range [4]struct {
+		dx, dy int
+		wt     float64
+	}{{0, 0, (1 - fx) * (1 - fy)}, {1, 0, fx * (1 - fy)}, {0, 1, (1 - fx) * fy}, {1, 1, fx * fy}} {
+		if n.wt == 0 {
+			continue
+		}
+		p := w.pixel(int(x0)+n.dx, int(y0)+n.dy)
+		for c := 0; c < 4; c++ {
+			v[c] += n.wt * p[c]
+		}
+	}
+	return v
+}
+
+// warpTile returns the tile coord of dst warped from the level of w, nil
+// when it is fully transparent.
+func (w *tileWarper) warpTile(dst *geo.TileGrid, coord [3]int) (*image.RGBA, error) {
+	tw, th := int(dst.TileSize[0]), int(dst.TileSize[1])
+	bbox := dst.TileBBox(coord, false)
+	dx, dy := (bbox.Max[0]-bbox.Min[0])/float64(tw), (bbox.Max[1]-bbox.Min[1])/float64(th)
+
+	points := make([]vec2d.T, 0, tw*th)
+	for j := 0; j < th; j++ {
+		for i := 0; i < tw; i++ {
+			points = append(points, vec2d.T{bbox.Min[0] + (float64(i)+0.5)*dx, bbox.Max[1] - (float64(j)+0.5)*dy})
+		}
+	}
+	points = dst.Srs.TransformTo(w.grid.Srs, points)
+
+	res := w.grid.Resolutions[w.level]
+	minx, maxy := w.grid.BBox.Min[0], w.grid.BBox.Max[1]
+	px, py := make([]float64, len(points)), make([]float64, len(points))
+	for i, p := range points {
+		px[i] = (p[0]-minx)/res - 0.5
+		py[i] = (maxy-p[1])/res - 0.5
+	}
+	if err := w.load(px, py); err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, tw, th))
+	empty := true
+	for i := range points {
+		if math.IsNaN(px[i]) || math.IsNaN(py[i]) || math.IsInf(px[i], 0) || math.IsInf(py[i], 0) {
+			continue
+		}
+		v := w.sample(px[i], py[i])
+		if v[3] == 0 {
+			continue
+		}
+		empty = false
+		for c := 0; c < 4; c++ {
+			img.Pix[i*4+c] = uint8(math.Round(v[c]))
+		}
+	}
+	if empty {
+		return nil, nil
+	}
+	return img, nil
+}
+
+// closestLevel returns the level of grid whose resolution is the closest to
+// res on a log scale.
+func closestLevel(grid *geo.TileGrid, res float64) int {
+	level, best := 0, math.Inf(1)
+	for i, r := range grid.Resolutions {
+		if d := math.Abs(math.Log(r / res)); d < best {
+			level, best = i, d
+		}
+	}
+	return level
+}
+
+// ReprojectTiles creates the tiles table dst_table with the grid dst_grid
+// and fills it with the PNG or JPEG tiles of src_table, warped to the srs
+// of dst_grid with bilinear interpolation. Each level of dst_grid, up to
+// the one closest to the most detailed level of src_table, is read from
+// the source level of the closest resolution. dst_table is dropped when
+// the reprojection fails.
+func (g *GeoPackage) ReprojectTiles(src_table string, dst_table string, dst_grid *geo.TileGrid) error {
+	if g.TableExist(dst_table) {
+		return fmt.Errorf("table %v already exists", dst_table)
+	}
+	if err := g.reprojectTiles(src_table, dst_table, dst_grid); err != nil {
+		g.dropTilesTable(dst_table)
+		return err
+	}
+	return nil
+}
+
+func (g *GeoPackage) reprojectTiles(src_table string, dst_table string, dst_grid *geo.TileGrid) error {
+	src, err := g.GetTileGrid(src_table)
+	if err != nil {
+		return err
+	}
+	zooms, err := g.GetTileZoomLevels(src_table)
+	if err != nil {
+		return err
+	}
+	if len(zooms) == 0 || len(zooms) != len(src.Resolutions) {
+		return fmt.Errorf("%v has no tile matrix", src_table)
+	}
+	format, err := g.GetTileFormat(src_table)
+	if err != nil {
+		return err
+	}
+	if format != PNG && format != JPG {
+		return fmt.Errorf("cannot reproject %v tiles", format)
+	}
+
+	srcBBox := *src.BBox
+	if ext, err := g.GetExtent(src_table); err == nil && ext != nil {
+		srcBBox = vec2d.Rect{Min: vec2d.T{ext.MinX(), ext.MinY()}, Max: vec2d.T{ext.MaxX(), ext.MaxY()}}
+	}
+	dstBBox := src.Srs.TransformRectTo(dst_grid.Srs, srcBBox, 16)
+	bbox := vec2d.Rect{
+		Min: vec2d.T{math.Max(dstBBox.Min[0], dst_grid.BBox.Min[0]), math.Max(dstBBox.Min[1], dst_grid.BBox.Min[1])},
+		Max: vec2d.T{math.Min(dstBBox.Max[0], dst_grid.BBox.Max[0]), math.Min(dstBBox.Max[1], dst_grid.BBox.Max[1])},
+	}
+	if bbox.Min[0] >= bbox.Max[0] || bbox.Min[1] >= bbox.Max[1] {
+		return fmt.Errorf("%v is outside of the destination grid", src_table)
+	}
+
+	// scale converts source resolutions to destination units, from the
+	// whole source extent as clipping to dst_grid would shrink it.
+	scale := (dstBBox.Max[0] - dstBBox.Min[0]) / (srcBBox.Max[0] - srcBBox.Min[0])
+	finest := src.Resolutions[len(src.Resolutions)-1] * scale
+	levels := []int{}
+	for l := 0; l < int(dst_grid.Levels); l++ {
+		levels = append(levels, l)
+		if dst_grid.Resolutions[l] <= finest*math.Sqrt2 {
+			break
+		}
+	}
+
+	if err = g.AddTilesTable(dst_table, dst_grid, geo.NewBBoxCoverage(bbox, dst_grid.Srs, false), &TilesTableOptions{Levels: levels}); err != nil {
+		return err
+	}
+
+	for _, l := range levels {
+		level := closestLevel(src, dst_grid.Resolutions[l]/scale)
+		w := &tileWarper{g: g, table: src_table, grid: src, zoom: zooms[level], level: level, tiles: map[[2]int]*image.RGBA{}}
+
+		z, _, top, err := g.GridTileCoord(dst_table, dst_grid, [3]int{0, 0, l})
+		if err != nil {
+			return err
+		}
+		delta := dst_grid.Resolutions[l] / 10
+		x0, y0, _ := dst_grid.Tile(bbox.Min[0]+delta, bbox.Min[1]+delta, l)
+		x1, y1, _ := dst_grid.Tile(bbox.Max[0]-delta, bbox.Max[1]-delta, l)
+		if y0 > y1 {
+			y0, y1 = y1, y0
+		}
+		size := dst_grid.GridSizes[l]
+		x0, x1 = clampInt(x0, 0, int(size[0])-1), clampInt(x1, 0, int(size[0])-1)
+		y0, y1 = clampInt(y0, 0, int(size[1])-1), clampInt(y1, 0, int(size[1])-1)
+
+		tiles := []*Tile{}
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				img, err := w.warpTile(dst_grid, [3]int{x, y, l})
+				if err != nil {
+					return err
+				}
+				if img == nil {
+					continue
+				}
+				data, err := encodeTileImage(img, format)
+				if err != nil {
+					return err
+				}
+				row := y
+				if !dst_grid.FlippedYAxis {
+					row = top - y
+				}
+				tiles = append(tiles, &Tile{Zoom: z, Column: x, Row: row, Data: data})
+			}
+			if len(tiles) >= overviewBatchSize {
+				if err = g.StoreTiles(dst_table, tiles); err != nil {
+					return err
+				}
+				tiles = tiles[:0]
+			}
+		}
+		if err = g.StoreTiles(dst_table, tiles); err != nil {
+			return err
+		}
+	}
+	return nil
+}
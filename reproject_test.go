@@ -0,0 +1,113 @@
+package gpkg
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/flywave/go-geo"
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+func TestReprojectTiles(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	conf := geo.DefaultTileGridOptions()
+	conf[geo.TILEGRID_SRS] = geo.NewProj(4326)
+	conf[geo.TILEGRID_BBOX] = &vec2d.Rect{Min: vec2d.T{-180, -90}, Max: vec2d.T{180, 90}}
+	conf[geo.TILEGRID_NUM_LEVELS] = 2
+	conf[geo.TILEGRID_ORIGIN] = geo.ORIGIN_UL
+	src := geo.NewTileGrid(conf)
+	cov := geo.NewBBoxCoverage(vec2d.Rect{Min: vec2d.T{-180, -85}, Max: vec2d.T{180, 85}}, src.Srs, false)
+	if err := gpkg.AddTilesTable("wgs84", src, cov); err != nil {
+		t.Fatal(err)
+	}
+
+	red := solidPNG(t, color.RGBA{255, 0, 0, 255})
+	tiles := []*Tile{}
+	for l := 0; l < 2; l++ {
+		for x := 0; x < int(src.GridSizes[l][0]); x++ {
+			for y := 0; y < int(src.GridSizes[l][1]); y++ {
+				tiles = append(tiles, &Tile{Zoom: l, Column: x, Row: y, Data: red})
+			}
+		}
+	}
+	if err := gpkg.StoreTiles("wgs84", tiles); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := newCoverageTestGrid()
+	if err := gpkg.ReprojectTiles("wgs84", "mercator", dst); err != nil {
+		t.Fatal(err)
+	}
+	zooms, err := gpkg.GetTileZoomLevels("mercator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zooms) != 3 || zooms[2] != 2 {
+		t.Fatal(zooms)
+	}
+
+	data, err := gpkg.GetTile("mercator", 2, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, _, a := img.At(128, 128).RGBA(); r>>8 != 255 || g != 0 || a>>8 != 255 {
+		t.Fatal(img.At(128, 128))
+	}
+
+	if err := gpkg.ReprojectTiles("wgs84", "mercator", dst); err == nil {
+		t.Fatal("destination table exists")
+	}
+
+	// clipping the source to a quarter of the world keeps its resolution
+	conf = geo.DefaultTileGridOptions()
+	conf[geo.TILEGRID_SRS] = dst.Srs
+	conf[geo.TILEGRID_BBOX] = &vec2d.Rect{Min: vec2d.T{0, 0}, Max: vec2d.T{dst.BBox.Max[0], dst.BBox.Max[1]}}
+	conf[geo.TILEGRID_RES] = dst.Resolutions[:5]
+	conf[geo.TILEGRID_ORIGIN] = geo.ORIGIN_UL
+	if err := gpkg.ReprojectTiles("wgs84", "quarter", geo.NewTileGrid(conf)); err != nil {
+		t.Fatal(err)
+	}
+	if quarter, _ := gpkg.GetTileZoomLevels("quarter"); len(quarter) != len(zooms) {
+		t.Fatal(quarter)
+	}
+}
+
+func TestReprojectTilesFailure(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	conf := geo.DefaultTileGridOptions()
+	conf[geo.TILEGRID_SRS] = geo.NewProj(4326)
+	conf[geo.TILEGRID_BBOX] = &vec2d.Rect{Min: vec2d.T{-180, -90}, Max: vec2d.T{180, 90}}
+	conf[geo.TILEGRID_NUM_LEVELS] = 1
+	conf[geo.TILEGRID_ORIGIN] = geo.ORIGIN_UL
+	src := geo.NewTileGrid(conf)
+	if err := gpkg.AddTilesTable("wgs84", src, nil); err != nil {
+		t.Fatal(err)
+	}
+	broken := append(solidPNG(t, color.RGBA{255, 0, 0, 255})[:16], 0, 0, 0, 0)
+	if err := gpkg.StoreTile("wgs84", 0, 0, 0, broken); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gpkg.ReprojectTiles("wgs84", "mercator", newCoverageTestGrid()); err == nil {
+		t.Fatal("the source tile is broken")
+	}
+	if gpkg.TableExist("mercator") {
+		t.FailNow()
+	}
+	if n, _ := gpkg.QueryInt(`SELECT count(*) FROM gpkg_tile_matrix WHERE table_name = 'mercator'`); n != 0 {
+		t.FailNow()
+	}
+}
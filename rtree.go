@@ -1,5 +1,18 @@
 package gpkg
 
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	RTreeExtensionName       = "gpkg_rtree_index"
+	RTreeExtensionDefinition = "http://www.geopackage.org/spec120/#extension_rtree"
+)
+
 type RTree struct {
 	Table string  `gorm:"-"`
 	Id    int     `gorm:"column:id;unique;not null;primary_key"`
@@ -16,3 +29,232 @@ func (rt RTree) ResourceName() string {
 func (rt RTree) TableName() string {
 	return rt.Table
 }
+
+func SpatialIndexName(table string, column string) string {
+	return "rtree_" + table + "_" + column
+}
+
+var rtreeTriggerNames = []string{"insert", "update1", "update2", "update3", "update4", "delete"}
+
+// rtreeTriggersSQL are the triggers mandated by the GeoPackage RTree
+// Spatial Indexes extension. <t> is the feature table, <c> its geometry
+// column and <i> its integer primary key.
+const rtreeTriggersSQL = `
+CREATE TRIGGER "rtree_<t>_<c>_insert" AFTER INSERT ON "<t>"
+  WHEN (new."<c>" NOT NULL AND NOT ST_IsEmpty(NEW."<c>"))
+BEGIN
+  INSERT OR REPLACE INTO "rtree_<t>_<c>" VALUES (
+    NEW.<i>,
+    ST_MinX(NEW."<c>"), ST_MaxX(NEW."<c>"),
+    ST_MinY(NEW."<c>"), ST_MaxY(NEW."<c>")
+  );
+END;
+
+CREATE TRIGGER "rtree_<t>_<c>_update1" AFTER UPDATE OF "<c>" ON "<t>"
+  WHEN OLD.<i> = NEW.<i> AND
+       (NEW."<c>" NOTNULL AND NOT ST_IsEmpty(NEW."<c>"))
+BEGIN
+  INSERT OR REPLACE INTO "rtree_<t>_<c>" VALUES (
+    NEW.<i>,
+    ST_MinX(NEW."<c>"), ST_MaxX(NEW."<c>"),
+    ST_MinY(NEW."<c>"), ST_MaxY(NEW."<c>")
+  );
+END;
+
+CREATE TRIGGER "rtree_<t>_<c>_update2" AFTER UPDATE OF "<c>" ON "<t>"
+  WHEN OLD.<i> = NEW.<i> AND
+       (NEW."<c>" ISNULL OR ST_IsEmpty(NEW."<c>"))
+BEGIN
+  DELETE FROM "rtree_<t>_<c>" WHERE id = OLD.<i>;
+END;
+
+CREATE TRIGGER "rtree_<t>_<c>_update3" AFTER UPDATE ON "<t>"
+  WHEN OLD.<i> != NEW.<i> AND
+       (NEW."<c>" NOTNULL AND NOT ST_IsEmpty(NEW."<c>"))
+BEGIN
+  DELETE FROM "rtree_<t>_<c>" WHERE id = OLD.<i>;
+  INSERT OR REPLACE INTO "rtree_<t>_<c>" VALUES (
+    NEW.<i>,
+    ST_MinX(NEW."<c>"), ST_MaxX(NEW."<c>"),
+    ST_MinY(NEW."<c>"), ST_MaxY(NEW."<c>")
+  );
+END;
+
+CREATE TRIGGER "rtree_<t>_<c>_update4" AFTER UPDATE ON "<t>"
+  WHEN OLD.<i> != NEW.<i> AND
+       (NEW."<c>" ISNULL OR ST_IsEmpty(NEW."<c>"))
+BEGIN
+  DELETE FROM "rtree_<t>_<c>" WHERE id IN (OLD.<i>, NEW.<i>);
+END;
+
+CREATE TRIGGER "rtree_<t>_<c>_delete" AFTER DELETE ON "<t>"
+  WHEN old."<c>" NOT NULL
+BEGIN
+  DELETE FROM "rtree_<t>_<c>" WHERE id = OLD.<i>;
+END;
+`
+
+// rowIdColumn returns the INTEGER PRIMARY KEY of a table, which is an
+// alias of its rowid, or rowid itself if the table has none.
+func (g *GeoPackage) rowIdColumn(table string) (string, error) {
+	columns, err := g.getTableColumns(table)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range columns {
+		if c.pk == 1 && strings.ToUpper(c.ctype) == "INTEGER" {
+			return `"` + c.name + `"`, nil
+		}
+	}
+	return "rowid", nil
+}
+
+func (g *GeoPackage) HasSpatialIndex(table string, column string) bool {
+	return g.TableExist(SpatialIndexName(table, column))
+}
+
+// CreateSpatialIndex creates the rtree_<table>_<column> virtual table,
+// fills it from the existing rows and installs the triggers keeping it up
+// to date. The triggers need the ST_* SQL functions on the connection.
+func (g *GeoPackage) CreateSpatialIndex(table string, column string) error {
+	const (
+		createSQL = `CREATE VIRTUAL TABLE "%v" USING rtree(id, minx, maxx, miny, maxy)`
+		selectSQL = `SELECT %v, "%v" FROM "%v" WHERE "%v" IS NOT NULL`
+		insertSQL = `INSERT OR REPLACE INTO "%v" (id, minx, maxx, miny, maxy) VALUES (?,?,?,?,?)`
+	)
+	var err error
+
+	if column == "" {
+		if column, err = g.GetGeomColumn(table); err != nil {
+			return err
+		}
+	}
+	if g.HasSpatialIndex(table, column) {
+		return nil
+	}
+
+	name := SpatialIndexName(table, column)
+	pk, err := g.rowIdColumn(table)
+	if err != nil {
+		return err
+	}
+
+	if err = g.DB.AutoMigrate(Extension{}).Error; err != nil {
+		return errors.Wrap(err, "Error migrating Extension")
+	}
+
+	tx, err := g.DB.DB().Begin()
+	if err != nil {
+		return err
+	}
+	if err = g.fillSpatialIndex(tx, fmt.Sprintf(createSQL, name), fmt.Sprintf(selectSQL, pk, column, table, column), fmt.Sprintf(insertSQL, name)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	triggers := strings.NewReplacer("<t>", table, "<c>", column, "<i>", pk).Replace(rtreeTriggersSQL)
+	if _, err = tx.Exec(triggers); err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = registerExtensionTx(tx, Extension{
+		Table:      table,
+		Column:     &column,
+		Extension:  RTreeExtensionName,
+		Definition: RTreeExtensionDefinition,
+		Scope:      ExtensionScopeWriteOnly,
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (g *GeoPackage) fillSpatialIndex(tx *sql.Tx, createSQL string, selectSQL string, insertSQL string) error {
+	if _, err := tx.Exec(createSQL); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(selectSQL)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var (
+		ids  []int64
+		exts [][4]float64
+	)
+	for rows.Next() {
+		var id int64
+		var data []byte
+		if err := rows.Scan(&id, &data); err != nil {
+			return err
+		}
+		ext, err := BinaryExtent(data)
+		if err != nil {
+			return fmt.Errorf("invalid geometry in row %d: %v", id, err)
+		}
+		if ext == nil {
+			continue
+		}
+		ids = append(ids, id)
+		exts = append(exts, [4]float64{ext.MinX(), ext.MaxX(), ext.MinY(), ext.MaxY()})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	stmt, err := tx.Prepare(insertSQL)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i := range ids {
+		if _, err := stmt.Exec(ids[i], exts[i][0], exts[i][1], exts[i][2], exts[i][3]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *GeoPackage) DropSpatialIndex(table string, column string) error {
+	const (
+		dropTriggerSQL     = `DROP TRIGGER IF EXISTS "%v_%v"`
+		dropTableSQL       = `DROP TABLE IF EXISTS "%v"`
+		deleteExtensionSQL = `DELETE FROM gpkg_extensions WHERE table_name = ? AND column_name = ? AND extension_name = ?`
+	)
+	var err error
+
+	if column == "" {
+		if column, err = g.GetGeomColumn(table); err != nil {
+			return err
+		}
+	}
+	name := SpatialIndexName(table, column)
+	registered := g.TableExist(Extension{}.TableName())
+
+	tx, err := g.DB.DB().Begin()
+	if err != nil {
+		return err
+	}
+	for _, trigger := range rtreeTriggerNames {
+		if _, err = tx.Exec(fmt.Sprintf(dropTriggerSQL, name, trigger)); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err = tx.Exec(fmt.Sprintf(dropTableSQL, name)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if registered {
+		if _, err = tx.Exec(deleteExtensionSQL, table, column, RTreeExtensionName); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,106 @@
+package gpkg
+
+import (
+	"os"
+	"testing"
+
+	"github.com/flywave/go-geom/general"
+)
+
+func TestSpatialIndex(t *testing.T) {
+	gpkg, fcs := createFeatureTestPackage(t, false)
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	if err := gpkg.CreateSpatialIndex("test", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if !gpkg.HasSpatialIndex("test", "geom") {
+		t.FailNow()
+	}
+
+	count, err := gpkg.QueryInt(`SELECT count(*) FROM "rtree_test_geom" WHERE minx >= -180 AND maxx <= 180`)
+	if err != nil || count != len(fcs.Features) {
+		t.FailNow()
+	}
+
+	count, _ = gpkg.QueryInt(`SELECT count(*) FROM gpkg_extensions WHERE extension_name = 'gpkg_rtree_index'`)
+	if count != 1 {
+		t.FailNow()
+	}
+
+	if err := gpkg.DropSpatialIndex("test", "geom"); err != nil {
+		t.Fatal(err)
+	}
+
+	if gpkg.HasSpatialIndex("test", "geom") {
+		t.FailNow()
+	}
+}
+
+func TestSpatialIndexRollback(t *testing.T) {
+	gpkg, _ := createFeatureTestPackage(t, false)
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	if err := gpkg.DB.Exec(`UPDATE "test" SET geom = x'00' WHERE rowid = 1`).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := gpkg.CreateSpatialIndex("test", "geom"); err == nil {
+		t.Fatal("invalid geometry")
+	}
+	if gpkg.HasSpatialIndex("test", "geom") {
+		t.FailNow()
+	}
+	count, _ := gpkg.QueryInt(`SELECT count(*) FROM gpkg_extensions WHERE extension_name = 'gpkg_rtree_index'`)
+	if count != 0 {
+		t.Fatal("extension registered without its index")
+	}
+}
+
+func TestFeatureReaderInBBox(t *testing.T) {
+	gpkg, fcs := createFeatureTestPackage(t, false)
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	read := func() []interface{} {
+		r, err := gpkg.GetFeatureReaderInBBox("test", &general.Extent{65, 30, 70, 35})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		ids := []interface{}{}
+		for r.Next() {
+			f, err := r.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, f.ID)
+		}
+		return ids
+	}
+
+	scanned := read()
+	if len(scanned) == 0 || len(scanned) >= len(fcs.Features) || scanned[0] != "AFG" {
+		t.FailNow()
+	}
+
+	r, err := gpkg.GetFeatureReader("test", &QueryOptions{BBox: &general.Extent{65, 30, 70, 35}, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Next() {
+		t.Fatal("the limit applies after the bbox")
+	}
+	r.Close()
+
+	if err := gpkg.CreateSpatialIndex("test", "geom"); err != nil {
+		t.Fatal(err)
+	}
+
+	indexed := read()
+	if len(indexed) != len(scanned) {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,393 @@
+// Package server serves the tiles tables of a GeoPackage over HTTP as XYZ
+// tiles, with a TileJSON document per table. Feature tables are served as
+// Mapbox Vector Tiles built on demand.
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/flywave/go-geo"
+	gpkg "github.com/flywave/go-gpkg"
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+// Server is an http.Handler serving
+//
+//	/                          the list of tiles and feature tables
+//	/{table}.json              the TileJSON document of a table
+//	/{table}/{z}/{x}/{y}.{ext} a tile, 204 when it does not exist
+//
+// Rows count from the top of the tile matrix, as in the GeoPackage. The
+// tiles of feature tables are .pbf or .mvt tiles of Grid, rows counting
+// from the top.
+type Server struct {
+	g *gpkg.GeoPackage
+
+	// BaseURL is the URL the tile urls of TileJSON documents start with,
+	// derived from the request when empty.
+	BaseURL string
+
+	// Grid is the grid of the vector tiles of feature tables, the web
+	// mercator grid by default.
+	Grid *geo.TileGrid
+
+	// VectorTileOptions changes how the vector tiles of feature tables are
+	// built.
+	VectorTileOptions *gpkg.VectorTileOptions
+}
+
+func New(g *gpkg.GeoPackage) *Server {
+	return &Server{g: g, Grid: geo.NewMercTileGrid()}
+}
+
+// TileJSON is a TileJSON 2.2.0 document.
+type TileJSON struct {
+	TileJSON    string     `json:"tilejson"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Scheme      string     `json:"scheme"`
+	Format      string     `json:"format,omitempty"`
+	Tiles       []string   `json:"tiles"`
+	MinZoom     int        `json:"minzoom"`
+	MaxZoom     int        `json:"maxzoom"`
+	Bounds      [4]float64 `json:"bounds"`
+	Center      [3]float64 `json:"center"`
+
+	VectorLayers []VectorLayer `json:"vector_layers,omitempty"`
+}
+
+// VectorLayer describes a layer of vector tiles in a TileJSON document.
+type VectorLayer struct {
+	ID string `json:"id"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	switch {
+	case path == "":
+		s.serveIndex(w, r)
+	case len(parts) == 1 && strings.HasSuffix(path, ".json"):
+		s.serveTileJSON(w, r, strings.TrimSuffix(path, ".json"))
+	case len(parts) == 4:
+		s.serveTile(w, r, parts)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) tables() ([]string, error) {
+	sets, err := s.g.GetTileMatrixSets()
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]string, 0, len(sets))
+	for _, set := range sets {
+		tables = append(tables, set.Name)
+	}
+	return tables, nil
+}
+
+func (s *Server) featureTables() ([]string, error) {
+	layers, err := s.g.GetVectorLayers()
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]string, 0, len(layers))
+	for _, l := range layers {
+		tables = append(tables, l.Name)
+	}
+	return tables, nil
+}
+
+func contains(tables []string, table string) bool {
+	for _, t := range tables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) isTilesTable(table string) (bool, error) {
+	tables, err := s.tables()
+	if err != nil {
+		return false, err
+	}
+	return contains(tables, table), nil
+}
+
+func (s *Server) isFeatureTable(table string) (bool, error) {
+	tables, err := s.featureTables()
+	if err != nil {
+		return false, err
+	}
+	return contains(tables, table), nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (s *Server) baseURL(r *http.Request) string {
+	if s.BaseURL != "" {
+		return strings.TrimSuffix(s.BaseURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+func (s *Server) serveIndex(w http.ResponseWriter, r *http.Request) {
+	tables, err := s.tables()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	features, err := s.featureTables()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tables = append(tables, features...)
+	index := make([]map[string]string, 0, len(tables))
+	for _, t := range tables {
+		index = append(index, map[string]string{"name": t, "url": s.baseURL(r) + "/" + t + ".json"})
+	}
+	writeJSON(w, index)
+}
+
+// tileJSON derives the TileJSON document of table from its tile matrix
+// set, coverage and zoom levels.
+func (s *Server) tileJSON(r *http.Request, table string) (*TileJSON, error) {
+	tj := &TileJSON{TileJSON: "2.2.0", Name: table, Scheme: "xyz", Format: "png"}
+	s.g.DB.DB().QueryRow(`SELECT identifier, coalesce(description, '') FROM gpkg_contents WHERE table_name = ?`, table).Scan(&tj.Name, &tj.Description)
+
+	if format, err := s.g.GetTileFormat(table); err == nil && format != gpkg.UNKNOWN {
+		tj.Format = format.String()
+	}
+	tj.Tiles = []string{fmt.Sprintf("%s/%s/{z}/{x}/{y}.%s", s.baseURL(r), table, tj.Format)}
+
+	zooms, err := s.g.GetTileZoomLevels(table)
+	if err != nil {
+		return nil, err
+	}
+	if len(zooms) > 0 {
+		tj.MinZoom, tj.MaxZoom = zooms[0], zooms[len(zooms)-1]
+	}
+
+	// the tile matrix set rather than the tile grid, which needs square
+	// pixels.
+	tms, err := s.g.GetTileMatrixSet(table)
+	if err != nil {
+		return nil, err
+	}
+	if tms.MinX == nil || tms.MinY == nil || tms.MaxX == nil || tms.MaxY == nil {
+		return nil, fmt.Errorf("tile matrix set of %v has no bounds", table)
+	}
+	ll := geo.NewProj(4326)
+	rect := vec2d.Rect{Min: vec2d.T{*tms.MinX, *tms.MinY}, Max: vec2d.T{*tms.MaxX, *tms.MaxY}}
+	bbox := geo.NewProj(tms.GetSpatialReferenceSystemId()).TransformRectTo(ll, rect, 16)
+	if cov, err := s.g.GetCoverage(table); err == nil {
+		if b := cov.GetBBox(); b.Max[0] > b.Min[0] && b.Max[1] > b.Min[1] {
+			bbox = cov.TransformTo(ll).GetBBox()
+		}
+	}
+	tj.Bounds = [4]float64{bbox.Min[0], bbox.Min[1], bbox.Max[0], bbox.Max[1]}
+	tj.Center = [3]float64{(bbox.Min[0] + bbox.Max[0]) / 2, (bbox.Min[1] + bbox.Max[1]) / 2, float64(tj.MinZoom)}
+	return tj, nil
+}
+
+// featureTileJSON derives the TileJSON document of the vector tiles of the
+// feature table table from Grid and the extent of the table.
+func (s *Server) featureTileJSON(r *http.Request, table string) (*TileJSON, error) {
+	tj := &TileJSON{TileJSON: "2.2.0", Name: table, Scheme: "xyz", Format: "pbf", MaxZoom: int(s.Grid.Levels) - 1}
+	s.g.DB.DB().QueryRow(`SELECT identifier, coalesce(description, '') FROM gpkg_contents WHERE table_name = ?`, table).Scan(&tj.Name, &tj.Description)
+	tj.Tiles = []string{fmt.Sprintf("%s/%s/{z}/{x}/{y}.%s", s.baseURL(r), table, tj.Format)}
+	tj.VectorLayers = []VectorLayer{{ID: table}}
+
+	ll := geo.NewProj(4326)
+	bbox := s.Grid.Srs.TransformRectTo(ll, *s.Grid.BBox, 16)
+	if cov, err := s.g.GetCoverage(table); err == nil {
+		if b := cov.GetBBox(); b.Max[0] > b.Min[0] && b.Max[1] > b.Min[1] {
+			bbox = cov.TransformTo(ll).GetBBox()
+		}
+	}
+	tj.Bounds = [4]float64{bbox.Min[0], bbox.Min[1], bbox.Max[0], bbox.Max[1]}
+	tj.Center = [3]float64{(bbox.Min[0] + bbox.Max[0]) / 2, (bbox.Min[1] + bbox.Max[1]) / 2, float64(tj.MinZoom)}
+	return tj, nil
+}
+
+func (s *Server) serveTileJSON(w http.ResponseWriter, r *http.Request, table string) {
+	tileJSON := s.tileJSON
+	if ok, err := s.isTilesTable(table); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if !ok {
+		if ok, err = s.isFeatureTable(table); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		tileJSON = s.featureTileJSON
+	}
+	tj, err := tileJSON(r, table)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, tj)
+}
+
+// formatExtensions are the extensions accepted for each tile format.
+var formatExtensions = map[gpkg.TileFormat][]string{
+	gpkg.PNG:     {"png"},
+	gpkg.JPG:     {"jpg", "jpeg"},
+	gpkg.WEBP:    {"webp"},
+	gpkg.PBF:     {"pbf", "mvt"},
+	gpkg.LERC:    {"lerc"},
+	gpkg.TIFF:    {"tiff", "tif"},
+	gpkg.TERRAIN: {"terrain"},
+}
+
+func etagMatches(header string, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == etag || t == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) serveTile(w http.ResponseWriter, r *http.Request, parts []string) {
+	table := parts[0]
+	dot := strings.LastIndexByte(parts[3], '.')
+	if dot < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	ext := strings.ToLower(parts[3][dot+1:])
+	z, errz := strconv.Atoi(parts[1])
+	x, errx := strconv.Atoi(parts[2])
+	y, erry := strconv.Atoi(parts[3][:dot])
+	if errz != nil || errx != nil || erry != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if ok, err := s.isTilesTable(table); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if !ok {
+		s.serveFeatureTile(w, r, table, z, x, y, ext)
+		return
+	}
+
+	data, err := s.g.GetTile(table, z, x, y)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(data) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	format, _ := gpkg.DetectTileFormat(data)
+	if exts, ok := formatExtensions[format]; ok {
+		found := false
+		for _, e := range exts {
+			found = found || e == ext
+		}
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	writeTile(w, r, data, format)
+}
+
+// serveFeatureTile serves the tile z/x/y of Grid built from the features of
+// table.
+func (s *Server) serveFeatureTile(w http.ResponseWriter, r *http.Request, table string, z int, x int, y int, ext string) {
+	if ok, err := s.isFeatureTable(table); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if !ok || (ext != "pbf" && ext != "mvt") {
+		http.NotFound(w, r)
+		return
+	}
+	if z < 0 || z >= int(s.Grid.Levels) {
+		http.NotFound(w, r)
+		return
+	}
+	size := s.Grid.GridSizes[z]
+	if x < 0 || y < 0 || x >= int(size[0]) || y >= int(size[1]) {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.Grid.FlippedYAxis {
+		y = int(size[1]) - 1 - y
+	}
+
+	data, err := s.g.BuildVectorTile([]string{table}, s.Grid, [3]int{x, y, z}, s.VectorTileOptions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(data) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeTile(w, r, data, gpkg.PBF)
+}
+
+func writeTile(w http.ResponseWriter, r *http.Request, data []byte, format gpkg.TileFormat) {
+	h := fnv.New64a()
+	h.Write(data)
+	etag := fmt.Sprintf(`"%016x"`, h.Sum64())
+	w.Header().Set("ETag", etag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if ct := format.ContentType(); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	if format == gpkg.PBF {
+		// PBF tiles are recognized by their gzip header.
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(data)
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/flywave/go-geo"
+	"github.com/flywave/go-geom"
+	"github.com/flywave/go-geom/general"
+	gpkg "github.com/flywave/go-gpkg"
+)
+
+func TestServer(t *testing.T) {
+	g := gpkg.Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer g.Close()
+
+	conf := geo.DefaultTileGridOptions()
+	conf[geo.TILEGRID_SRS] = geo.NewProj("EPSG:3857")
+	conf[geo.TILEGRID_ORIGIN] = geo.ORIGIN_UL
+	conf[geo.TILEGRID_NUM_LEVELS] = 3
+	grid := geo.NewTileGrid(conf)
+	if err := g.AddTilesTable("osm", grid, geo.NewBBoxCoverage(*grid.BBox, grid.Srs, false)); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 256, 256)))
+	g.StoreTile("osm", 1, 1, 0, buf.Bytes())
+
+	ts := httptest.NewServer(New(g))
+	defer ts.Close()
+
+	get := func(path string, header ...string) *http.Response {
+		req, _ := http.NewRequest("GET", ts.URL+path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := get("/osm/1/1/0.png")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/png" || resp.Header.Get("ETag") == "" {
+		t.Fatal(resp.Status, resp.Header)
+	}
+	if resp := get("/osm/1/1/0.png", "If-None-Match", resp.Header.Get("ETag")); resp.StatusCode != http.StatusNotModified {
+		t.Fatal(resp.Status)
+	}
+	if resp := get("/osm/1/0/0.png"); resp.StatusCode != http.StatusNoContent {
+		t.Fatal(resp.Status)
+	}
+	if resp := get("/osm/1/1/0.jpg"); resp.StatusCode != http.StatusNotFound {
+		t.Fatal(resp.Status)
+	}
+	if resp := get("/other/1/1/0.png"); resp.StatusCode != http.StatusNotFound {
+		t.Fatal(resp.Status)
+	}
+
+	r, err := http.Get(ts.URL + "/osm.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	tj := TileJSON{}
+	if err := json.NewDecoder(r.Body).Decode(&tj); err != nil {
+		t.Fatal(err)
+	}
+	if tj.Format != "png" || tj.MinZoom != 0 || tj.MaxZoom != 2 || len(tj.Tiles) != 1 || tj.Tiles[0] != ts.URL+"/osm/{z}/{x}/{y}.png" {
+		t.Fatal(tj)
+	}
+	if tj.Bounds[0] > -179.9 || tj.Bounds[2] < 179.9 || tj.Bounds[3] < 85 {
+		t.Fatal(tj.Bounds)
+	}
+
+	webp := []byte("RIFF\x1a\x00\x00\x00WEBPVP8L\x0d\x00\x00\x00\x2f\x00\x00\x00\x10\x07\x10\x11\x11\x88\x88\xfe\x07\x00")
+	if err := g.AddTilesTable("imagery", grid, nil); err != nil {
+		t.Fatal(err)
+	}
+	g.StoreTile("imagery", 1, 1, 0, webp)
+	if resp := get("/imagery/1/1/0.webp"); resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/webp" {
+		t.Fatal(resp.Status, resp.Header)
+	}
+
+	srs := 3857
+	minx, miny, maxx, maxy := 0.0, 0.0, 1024.0, 1024.0
+	tms := &gpkg.TileMatrixSet{SpatialReferenceSystemId: &srs, MinX: &minx, MinY: &miny, MaxX: &maxx, MaxY: &maxy}
+	matrices := []gpkg.TileMatrix{{ZoomLevel: 0, MatrixWidth: 1, MatrixHeight: 2, TileWidth: 256, TileHeight: 256, PixelXSize: 4, PixelYSize: 2}}
+	if err := g.AddTileMatrixSet("nonsquare", tms, matrices, nil); err != nil {
+		t.Fatal(err)
+	}
+	if resp := get("/nonsquare.json"); resp.StatusCode != http.StatusOK {
+		t.Fatal(resp.Status)
+	}
+}
+
+func TestServerFeatureTiles(t *testing.T) {
+	g := gpkg.Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer g.Close()
+
+	schema := &gpkg.LayerSchema{Fields: []gpkg.Field{{Name: "name", Type: "TEXT"}}}
+	w, err := g.NewFeatureWriter("places", schema, &gpkg.FeatureWriterOptions{
+		Geometry: &gpkg.GeometryColumn{ColumnName: "geom", GeometryType: "POINT", SpatialReferenceSystemId: 4326},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(&geom.Feature{ID: 1, Properties: map[string]interface{}{"name": "a"}, Geometry: general.NewPoint([]float64{10, 10})}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(New(g))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/places/1/1/0.pbf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != gpkg.PBF.ContentType() {
+		t.Fatal(resp.Status, resp.Header)
+	}
+	for path, status := range map[string]int{
+		"/places/1/0/1.pbf":  http.StatusNoContent,
+		"/places/1/1/0.png":  http.StatusNotFound,
+		"/places/30/0/0.pbf": http.StatusNotFound,
+	} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Fatal(path, resp.Status)
+		}
+	}
+
+	r, err := http.Get(ts.URL + "/places.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	tj := TileJSON{}
+	if err := json.NewDecoder(r.Body).Decode(&tj); err != nil {
+		t.Fatal(err)
+	}
+	if tj.Format != "pbf" || len(tj.VectorLayers) != 1 || tj.VectorLayers[0].ID != "places" || tj.Tiles[0] != ts.URL+"/places/{z}/{x}/{y}.pbf" {
+		t.Fatal(tj)
+	}
+}
@@ -0,0 +1,212 @@
+package gpkg
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/flywave/go-geom/general"
+	"github.com/mattn/go-sqlite3"
+)
+
+// DriverName is the database/sql driver used to open GeoPackages. It is
+// the sqlite3 driver with the GeoPackage SQL functions registered on every
+// connection.
+const DriverName = "sqlite3_gpkg"
+
+func init() {
+	sql.Register(DriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: RegisterSQLFunctions,
+	})
+}
+
+var sqlFunctions = map[string]interface{}{
+	"ST_MinX":           stMinX,
+	"ST_MaxX":           stMaxX,
+	"ST_MinY":           stMinY,
+	"ST_MaxY":           stMaxY,
+	"ST_IsEmpty":        stIsEmpty,
+	"ST_GeometryType":   stGeometryType,
+	"ST_SRID":           stSRID,
+	"GPKG_IsAssignable": gpkgIsAssignable,
+}
+
+// RegisterSQLFunctions registers the SQL functions required by the
+// GeoPackage RTree triggers and geometry type triggers on conn.
+func RegisterSQLFunctions(conn *sqlite3.SQLiteConn) error {
+	for name, impl := range sqlFunctions {
+		if err := conn.RegisterFunc(name, impl, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func geometryBlob(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		if len(v) == 0 {
+			return nil, nil
+		}
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return nil, errors.New("geometry must be a BLOB")
+	}
+}
+
+// sqlExtent returns the extent of a geometry value, nil for NULL and
+// empty geometries.
+func sqlExtent(value interface{}) (*general.Extent, error) {
+	data, err := geometryBlob(value)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return BinaryExtent(data)
+}
+
+// SQLite stores NaN as NULL, which is what the ST_Min/Max functions return
+// for NULL and empty geometries.
+
+func stMinX(value interface{}) (float64, error) {
+	ext, err := sqlExtent(value)
+	if err != nil || ext == nil {
+		return math.NaN(), err
+	}
+	return ext.MinX(), nil
+}
+
+func stMaxX(value interface{}) (float64, error) {
+	ext, err := sqlExtent(value)
+	if err != nil || ext == nil {
+		return math.NaN(), err
+	}
+	return ext.MaxX(), nil
+}
+
+func stMinY(value interface{}) (float64, error) {
+	ext, err := sqlExtent(value)
+	if err != nil || ext == nil {
+		return math.NaN(), err
+	}
+	return ext.MinY(), nil
+}
+
+func stMaxY(value interface{}) (float64, error) {
+	ext, err := sqlExtent(value)
+	if err != nil || ext == nil {
+		return math.NaN(), err
+	}
+	return ext.MaxY(), nil
+}
+
+func stIsEmpty(value interface{}) (bool, error) {
+	data, err := geometryBlob(value)
+	if err != nil || data == nil {
+		return true, err
+	}
+	h, err := DecodeBinaryHeader(data)
+	if err != nil {
+		return false, err
+	}
+	return h.IsGeometryEmpty(), nil
+}
+
+func stSRID(value interface{}) (int64, error) {
+	data, err := geometryBlob(value)
+	if err != nil || data == nil {
+		return 0, err
+	}
+	h, err := DecodeBinaryHeader(data)
+	if err != nil {
+		return 0, err
+	}
+	return int64(h.SRSId()), nil
+}
+
+var wkbGeometryTypeNames = []string{
+	"GEOMETRY",
+	"POINT",
+	"LINESTRING",
+	"POLYGON",
+	"MULTIPOINT",
+	"MULTILINESTRING",
+	"MULTIPOLYGON",
+	"GEOMETRYCOLLECTION",
+	"CIRCULARSTRING",
+	"COMPOUNDCURVE",
+	"CURVEPOLYGON",
+	"MULTICURVE",
+	"MULTISURFACE",
+	"CURVE",
+	"SURFACE",
+}
+
+func stGeometryType(value interface{}) (string, error) {
+	data, err := geometryBlob(value)
+	if err != nil || data == nil {
+		return "", err
+	}
+	h, err := DecodeBinaryHeader(data)
+	if err != nil {
+		return "", err
+	}
+	if !h.IsStandardGeometry() {
+		return "GEOMETRY", nil
+	}
+	wkb := data[h.Size():]
+	if len(wkb) < 5 {
+		return "", errors.New("not enough bytes to decode geometry type")
+	}
+	var en binary.ByteOrder = binary.BigEndian
+	if wkb[0] == 1 {
+		en = binary.LittleEndian
+	}
+	code := int(en.Uint32(wkb[1:5]) & 0xFFFF % 1000)
+	if code >= len(wkbGeometryTypeNames) {
+		return "", errors.New("unknown geometry type")
+	}
+	return wkbGeometryTypeNames[code], nil
+}
+
+var geometryTypeParents = map[string][]string{
+	"POINT":              {"GEOMETRY"},
+	"CURVE":              {"GEOMETRY"},
+	"SURFACE":            {"GEOMETRY"},
+	"LINESTRING":         {"CURVE", "GEOMETRY"},
+	"CIRCULARSTRING":     {"CURVE", "GEOMETRY"},
+	"COMPOUNDCURVE":      {"CURVE", "GEOMETRY"},
+	"CURVEPOLYGON":       {"SURFACE", "GEOMETRY"},
+	"POLYGON":            {"CURVEPOLYGON", "SURFACE", "GEOMETRY"},
+	"MULTIPOINT":         {"GEOMETRYCOLLECTION", "GEOMETRY"},
+	"MULTICURVE":         {"GEOMETRYCOLLECTION", "GEOMETRY"},
+	"MULTISURFACE":       {"GEOMETRYCOLLECTION", "GEOMETRY"},
+	"MULTILINESTRING":    {"MULTICURVE", "GEOMETRYCOLLECTION", "GEOMETRY"},
+	"MULTIPOLYGON":       {"MULTISURFACE", "GEOMETRYCOLLECTION", "GEOMETRY"},
+	"GEOMETRYCOLLECTION": {"GEOMETRY"},
+}
+
+// IsAssignable reports whether a geometry of type actual may be stored in
+// a column declared as expected.
+func IsAssignable(expected string, actual string) bool {
+	expected = strings.ToUpper(expected)
+	actual = strings.ToUpper(actual)
+	if expected == actual {
+		return true
+	}
+	for _, parent := range geometryTypeParents[actual] {
+		if parent == expected {
+			return true
+		}
+	}
+	return false
+}
+
+func gpkgIsAssignable(expected string, actual string) bool {
+	return IsAssignable(expected, actual)
+}
@@ -0,0 +1,48 @@
+package gpkg
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSQLFunctions(t *testing.T) {
+	gpkg, fcs := createFeatureTestPackage(t, true)
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	count, err := gpkg.QueryInt(`SELECT count(*) FROM "rtree_test_geom"`)
+	if err != nil || count != len(fcs.Features) {
+		t.FailNow()
+	}
+
+	var (
+		minx, maxx float64
+		gtype      string
+		srs        int
+		empty      bool
+	)
+	row := gpkg.DB.DB().QueryRow(`SELECT ST_MinX(geom), ST_MaxX(geom), ST_GeometryType(geom), ST_SRID(geom), ST_IsEmpty(geom) FROM test WHERE id = 'AFG'`)
+	if err := row.Scan(&minx, &maxx, &gtype, &srs, &empty); err != nil {
+		t.Fatal(err)
+	}
+	if minx != 60.52843 || maxx != 75.158028 || gtype != "POLYGON" || srs != 4326 || empty {
+		t.FailNow()
+	}
+
+	if _, err := gpkg.DB.DB().Exec(`DELETE FROM test WHERE id = 'AFG'`); err != nil {
+		t.Fatal(err)
+	}
+	count, _ = gpkg.QueryInt(`SELECT count(*) FROM "rtree_test_geom"`)
+	if count != len(fcs.Features)-1 {
+		t.FailNow()
+	}
+}
+
+func TestIsAssignable(t *testing.T) {
+	if !IsAssignable("GEOMETRY", "Point") || !IsAssignable("MULTISURFACE", "MULTIPOLYGON") {
+		t.FailNow()
+	}
+	if IsAssignable("POINT", "LINESTRING") || IsAssignable("POLYGON", "GEOMETRY") {
+		t.FailNow()
+	}
+}
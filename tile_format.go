@@ -63,16 +63,25 @@ func (t TileFormat) ContentType() string {
 	}
 }
 
+// DetectTileFormat returns the format of a tile from its content.
+func DetectTileFormat(data []byte) (TileFormat, error) {
+	return detectTileFormat(&data)
+}
+
 func detectTileFormat(data *[]byte) (TileFormat, error) {
 	patterns := map[TileFormat][][]byte{
 		PNG:  {[]byte("\x89\x50\x4E\x47\x0D\x0A\x1A\x0A")},
 		JPG:  {[]byte("\xFF\xD8\xFF")},
-		WEBP: {[]byte("\x52\x49\x46\x46\xc0\x00\x00\x00\x57\x45\x42\x50\x56\x50")},
 		LERC: {[]byte("\x43\x6E\x74\x5A\x49\x6D\x61\x67\x65\x20"), []byte("\x4C\x65\x72\x63\x32\x20")},
 		TIFF: {[]byte("\x4D\x4D"), []byte("\x49\x49")},
 		PBF:  {[]byte("\x1f\x8b")},
 	}
 
+	// a RIFF container, whose size follows the tag, of WebP data
+	if len(*data) >= 12 && bytes.HasPrefix(*data, []byte("RIFF")) && bytes.Equal((*data)[8:12], []byte("WEBP")) {
+		return WEBP, nil
+	}
+
 	for format, pattern := range patterns {
 		for _, p := range pattern {
 			if bytes.HasPrefix(*data, p) {
@@ -10,3 +10,15 @@ func TestIsLerc(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+// webpTile is a 1x1 lossless WebP image.
+var webpTile = []byte("RIFF\x1a\x00\x00\x00WEBPVP8L\x0d\x00\x00\x00\x2f\x00\x00\x00\x10\x07\x10\x11\x11\x88\x88\xfe\x07\x00")
+
+func TestDetectWebP(t *testing.T) {
+	if f, err := DetectTileFormat(webpTile); err != nil || f != WEBP {
+		t.Fatal(f, err)
+	}
+	if f, _ := DetectTileFormat([]byte("RIFF\x1a\x00\x00\x00WAVEfmt ")); f == WEBP {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,137 @@
+package gpkg
+
+import (
+	"os"
+	"testing"
+
+	"github.com/flywave/go-geo"
+	"github.com/flywave/go-geom/general"
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+func newLowerLeftTestGrid(bbox vec2d.Rect) *geo.TileGrid {
+	conf := geo.DefaultTileGridOptions()
+	conf[geo.TILEGRID_SRS] = geo.NewProj(3857)
+	conf[geo.TILEGRID_BBOX] = &bbox
+	conf[geo.TILEGRID_NUM_LEVELS] = 3
+	conf[geo.TILEGRID_ORIGIN] = geo.ORIGIN_LL
+	return geo.NewTileGrid(conf)
+}
+
+func TestLowerLeftTilesTable(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	grid := newLowerLeftTestGrid(vec2d.Rect{Min: vec2d.T{0, 0}, Max: vec2d.T{1000, 1000}})
+	if err := gpkg.AddTilesTable("ll", grid, nil, &TilesTableOptions{ZoomOffset: 3, Levels: []int{0, 2}}); err != nil {
+		t.Fatal(err)
+	}
+	zooms, err := gpkg.GetTileZoomLevels("ll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zooms) != 2 || zooms[0] != 3 || zooms[1] != 5 {
+		t.Fatal(zooms)
+	}
+
+	if err := gpkg.StoreGridTile("ll", grid, [3]int{1, 0, 2}, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := gpkg.GetTile("ll", 5, 1, 3); err != nil || string(data) != "a" {
+		t.Fatal(data, err)
+	}
+	if data, err := gpkg.GetGridTile("ll", grid, [3]int{1, 0, 2}); err != nil || string(data) != "a" {
+		t.Fatal(data, err)
+	}
+	if _, _, _, err := gpkg.GridTileCoord("ll", grid, [3]int{0, 0, 1}); err == nil {
+		t.Fatal("level 1 has no tile matrix")
+	}
+
+	conf := geo.DefaultTileGridOptions()
+	conf[geo.TILEGRID_SRS] = geo.NewProj(3857)
+	conf[geo.TILEGRID_BBOX] = &vec2d.Rect{Min: vec2d.T{0, 0}, Max: vec2d.T{1000, 600}}
+	conf[geo.TILEGRID_RES] = []float64{4, 2, 1}
+	conf[geo.TILEGRID_ORIGIN] = geo.ORIGIN_LL
+	grid = geo.NewTileGrid(conf)
+	if err := gpkg.AddTilesTable("unaligned", grid, nil); err == nil {
+		t.Fatal("levels of unaligned lower left grid have different tops")
+	}
+}
+
+func TestAddTileMatrixSet(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	srs := 3857
+	minx, miny, maxx, maxy := 0.0, 0.0, 1024.0, 512.0
+	tms := &TileMatrixSet{SpatialReferenceSystemId: &srs, MinX: &minx, MinY: &miny, MaxX: &maxx, MaxY: &maxy}
+	matrices := []TileMatrix{
+		{ZoomLevel: 2, MatrixWidth: 2, MatrixHeight: 2, TileWidth: 256, TileHeight: 256, PixelXSize: 2, PixelYSize: 1},
+		{ZoomLevel: 4, MatrixWidth: 8, MatrixHeight: 8, TileWidth: 256, TileHeight: 256, PixelXSize: 0.5, PixelYSize: 0.25},
+	}
+	if err := gpkg.AddTileMatrixSet("wmts", tms, matrices, nil); err != nil {
+		t.Fatal(err)
+	}
+	tm, err := gpkg.getTileMatrix("wmts", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tm.PixelXSize != 0.5 || tm.PixelYSize != 0.25 || tm.MatrixHeight != 8 {
+		t.Fatal(tm)
+	}
+
+	matrices[1].ZoomLevel = 2
+	if err := gpkg.AddTileMatrixSet("duplicate", tms, matrices, nil); err == nil {
+		t.Fatal("duplicate zoom level")
+	}
+}
+
+func TestNonSquareTileGrid(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	srs := 3857
+	minx, miny, maxx, maxy := 0.0, 0.0, 1024.0, 1024.0
+	tms := &TileMatrixSet{SpatialReferenceSystemId: &srs, MinX: &minx, MinY: &miny, MaxX: &maxx, MaxY: &maxy}
+	matrices := []TileMatrix{
+		{ZoomLevel: 0, MatrixWidth: 1, MatrixHeight: 2, TileWidth: 256, TileHeight: 256, PixelXSize: 4, PixelYSize: 2},
+		{ZoomLevel: 1, MatrixWidth: 2, MatrixHeight: 4, TileWidth: 256, TileHeight: 256, PixelXSize: 2, PixelYSize: 1},
+	}
+	if err := gpkg.AddTileMatrixSet("nonsquare", tms, matrices, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gpkg.GetTileGrid("nonsquare"); err == nil {
+		t.Fatal("tile grids have square pixels")
+	}
+	if err := gpkg.StoreTile("nonsquare", 1, 1, 3, []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	se := &general.Extent{600, 0, 1024, 200}
+	it, err := gpkg.TileIterator("nonsquare", nil, se)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !it.Next() {
+		t.Fatal("tile not read back", it.Err())
+	}
+	tile, err := it.Read()
+	it.Close()
+	if err != nil || tile.Zoom != 1 || tile.Column != 1 || tile.Row != 3 {
+		t.Fatal(tile, err)
+	}
+
+	conf := geo.DefaultTileGridOptions()
+	conf[geo.TILEGRID_SRS] = geo.NewProj(3857)
+	conf[geo.TILEGRID_BBOX] = &vec2d.Rect{Min: vec2d.T{0, 0}, Max: vec2d.T{1024, 1024}}
+	conf[geo.TILEGRID_RES] = []float64{4, 2}
+	conf[geo.TILEGRID_ORIGIN] = geo.ORIGIN_UL
+	if err := gpkg.AddTilesTable("square", geo.NewTileGrid(conf), nil); err != nil {
+		t.Fatal(err)
+	}
+	if g, err := gpkg.GetTileGrid("square"); err != nil || len(g.Resolutions) != 2 || g.Resolutions[1] != 2 {
+		t.Fatal(g, err)
+	}
+}
@@ -0,0 +1,47 @@
+package gpkg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+)
+
+// decodeTileImage decodes a PNG or JPEG tile into an RGBA image.
+func decodeTileImage(data []byte) (*image.RGBA, TileFormat, error) {
+	format, err := DetectTileFormat(data)
+	if err != nil || (format != PNG && format != JPG) {
+		return nil, UNKNOWN, fmt.Errorf("tile is not PNG or JPEG")
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, UNKNOWN, err
+	}
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba, format, nil
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	return rgba, format, nil
+}
+
+// encodeTileImage encodes img as a PNG or JPEG tile.
+func encodeTileImage(img image.Image, format TileFormat) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case JPG:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	case PNG:
+		err = png.Encode(&buf, img)
+	default:
+		err = fmt.Errorf("cannot encode %v tiles", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
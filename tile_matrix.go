@@ -1,6 +1,9 @@
 package gpkg
 
 import (
+	"fmt"
+	"math"
+
 	"github.com/flywave/go-geo"
 )
 
@@ -19,16 +22,47 @@ func (TileMatrix) TableName() string {
 	return "gpkg_tile_matrix"
 }
 
+// TilesTableOptions changes the tile matrices created for the levels of a
+// grid. The tile matrix of grid level i has zoom level i + ZoomOffset.
+// Levels selects the grid levels to create a tile matrix for, all when
+// empty. Grid pixels are square, see AddTileMatrixSet for matrices with
+// independent pixel sizes.
+type TilesTableOptions struct {
+	ZoomOffset int
+	Levels     []int
+}
+
 func NewTileMatrixs(tableName string, grid *geo.TileGrid) []TileMatrix {
-	len := int(grid.Levels)
+	tms, _ := newGridTileMatrices(tableName, grid, nil)
+	return tms
+}
+
+func newGridTileMatrices(tableName string, grid *geo.TileGrid, opts *TilesTableOptions) ([]TileMatrix, error) {
+	if opts == nil {
+		opts = &TilesTableOptions{}
+	}
+	levels := opts.Levels
+	if len(levels) == 0 {
+		for i := 0; i < int(grid.Levels); i++ {
+			levels = append(levels, i)
+		}
+	}
+
 	tms := []TileMatrix{}
-	for i := 0; i < len; i++ {
+	for _, i := range levels {
+		if i < 0 || i >= int(grid.Levels) {
+			return nil, fmt.Errorf("grid has no level %d", i)
+		}
+		zoom := i + opts.ZoomOffset
+		if zoom < 0 || zoom > math.MaxInt8 {
+			return nil, fmt.Errorf("invalid zoom level %d", zoom)
+		}
 		res := grid.Resolutions[i]
 		grids := grid.GridSizes[i]
 
 		tms = append(tms, TileMatrix{
 			Name:         tableName,
-			ZoomLevel:    int8(i),
+			ZoomLevel:    int8(zoom),
 			MatrixWidth:  uint64(grids[0]),
 			MatrixHeight: uint64(grids[1]),
 			TileWidth:    grid.TileSize[0],
@@ -37,5 +71,27 @@ func NewTileMatrixs(tableName string, grid *geo.TileGrid) []TileMatrix {
 			PixelYSize:   res,
 		})
 	}
-	return tms
+	return tms, nil
+}
+
+// validateTileMatrixSet checks that tms has a bbox and that matrices have
+// distinct zoom levels and positive sizes.
+func validateTileMatrixSet(tms *TileMatrixSet, matrices []TileMatrix) error {
+	if tms.MinX == nil || tms.MinY == nil || tms.MaxX == nil || tms.MaxY == nil || *tms.MinX >= *tms.MaxX || *tms.MinY >= *tms.MaxY {
+		return fmt.Errorf("tile matrix set %v has an invalid bbox", tms.Name)
+	}
+	if len(matrices) == 0 {
+		return fmt.Errorf("tile matrix set %v has no tile matrix", tms.Name)
+	}
+	zooms := map[int8]bool{}
+	for _, m := range matrices {
+		if m.ZoomLevel < 0 || zooms[m.ZoomLevel] {
+			return fmt.Errorf("invalid or duplicate zoom level %d", m.ZoomLevel)
+		}
+		zooms[m.ZoomLevel] = true
+		if m.MatrixWidth == 0 || m.MatrixHeight == 0 || m.TileWidth == 0 || m.TileHeight == 0 || m.PixelXSize <= 0 || m.PixelYSize <= 0 {
+			return fmt.Errorf("tile matrix %d has an invalid size", m.ZoomLevel)
+		}
+	}
+	return nil
 }
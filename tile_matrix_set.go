@@ -1,9 +1,15 @@
 package gpkg
 
-import "github.com/flywave/go-geo"
+import (
+	"fmt"
+	"math"
+
+	"github.com/flywave/go-geo"
+	"github.com/pkg/errors"
+)
 
 type TileMatrixSet struct {
-	Name                     string   `"type:text" gorm:"column:table_name;not null;primary_key"`
+	Name                     string   `sql:"type:text" gorm:"column:table_name;not null;primary_key"`
 	SpatialReferenceSystemId *int     `gorm:"column:srs_id;not null"`
 	MinX                     *float64 `gorm:"column:min_x;not null"`
 	MinY                     *float64 `gorm:"column:min_y;not null"`
@@ -15,6 +21,36 @@ func (TileMatrixSet) TableName() string {
 	return "gpkg_tile_matrix_set"
 }
 
+// migrateTileMatrixSet renames the name column of gpkg_tile_matrix_set to
+// table_name. Packages written while the struct tag of TileMatrixSet.Name
+// was malformed have the column named after the field.
+func (g *GeoPackage) migrateTileMatrixSet() error {
+	table := TileMatrixSet{}.TableName()
+	if !g.TableExist(table) {
+		return nil
+	}
+	columns, err := g.getTableColumns(table)
+	if err != nil {
+		return err
+	}
+	legacy := false
+	for _, c := range columns {
+		switch c.name {
+		case "table_name":
+			return nil
+		case "name":
+			legacy = true
+		}
+	}
+	if !legacy {
+		return nil
+	}
+	if _, err = g.DB.DB().Exec(`ALTER TABLE gpkg_tile_matrix_set RENAME COLUMN name TO table_name`); err != nil {
+		return errors.Wrap(err, "Error migrating "+table)
+	}
+	return nil
+}
+
 func (tms TileMatrixSet) GetSpatialReferenceSystemId() int {
 	if tms.SpatialReferenceSystemId == nil {
 		return 0
@@ -27,3 +63,24 @@ func NewTileMatrixSet(tableName string, grid *geo.TileGrid) *TileMatrixSet {
 	srsId := geo.GetEpsgNum(grid.Srs.GetSrsCode())
 	return &TileMatrixSet{Name: tableName, MinX: &bbox.Min[0], MinY: &bbox.Min[1], MaxX: &bbox.Max[0], MaxY: &bbox.Max[1], SpatialReferenceSystemId: &srsId}
 }
+
+// newGridTileMatrixSet returns the tile matrix set of the matrices of grid.
+// GeoPackage rows start at the top of the set, so the top of a lower left
+// grid is the top of its tile rows, which must be the same for all the
+// matrices.
+func newGridTileMatrixSet(tableName string, grid *geo.TileGrid, matrices []TileMatrix) (*TileMatrixSet, error) {
+	minx, miny, maxx, maxy := grid.BBox.Min[0], grid.BBox.Min[1], grid.BBox.Max[0], grid.BBox.Max[1]
+	srsId := geo.GetEpsgNum(grid.Srs.GetSrsCode())
+
+	if !grid.FlippedYAxis {
+		for i, m := range matrices {
+			top := miny + float64(m.MatrixHeight)*float64(m.TileHeight)*m.PixelYSize
+			if i == 0 {
+				maxy = top
+			} else if math.Abs(top-maxy) > 1e-9*math.Max(math.Abs(maxy), 1) {
+				return nil, fmt.Errorf("tile matrices %d and %d of lower left grid do not share a top left corner", matrices[0].ZoomLevel, m.ZoomLevel)
+			}
+		}
+	}
+	return &TileMatrixSet{Name: tableName, MinX: &minx, MinY: &miny, MaxX: &maxx, MaxY: &maxy, SpatialReferenceSystemId: &srsId}, nil
+}
@@ -0,0 +1,353 @@
+package gpkg
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/flywave/go-geo"
+	"github.com/flywave/go-geom/general"
+	"github.com/pkg/errors"
+)
+
+// Tile is a tile of a tiles table, Row counting from the top of its tile
+// matrix.
+type Tile struct {
+	Zoom   int
+	Column int
+	Row    int
+	Data   []byte
+}
+
+// ZoomRange is an inclusive range of zoom levels.
+type ZoomRange struct {
+	Min int
+	Max int
+}
+
+func (r *ZoomRange) contains(z int) bool {
+	return r == nil || (z >= r.Min && z <= r.Max)
+}
+
+// tileBounds returns the first and last columns and rows of the tiles of tm
+// intersecting bbox, false when there is none. A tile covers its top left
+// corner but not its bottom and right edges.
+func tileBounds(tms *TileMatrixSet, tm *TileMatrix, bbox *general.Extent) ([4]int, bool) {
+	w := float64(tm.TileWidth) * tm.PixelXSize
+	h := float64(tm.TileHeight) * tm.PixelYSize
+	minx, maxy := *tms.MinX, *tms.MaxY
+
+	c0 := int(math.Floor((bbox.MinX() - minx) / w))
+	c1 := int(math.Ceil((bbox.MaxX()-minx)/w)) - 1
+	r0 := int(math.Floor((maxy - bbox.MaxY()) / h))
+	r1 := int(math.Ceil((maxy-bbox.MinY())/h)) - 1
+	if c1 < c0 {
+		c1 = c0
+	}
+	if r1 < r0 {
+		r1 = r0
+	}
+
+	c0, r0 = clampInt(c0, 0, math.MaxInt32), clampInt(r0, 0, math.MaxInt32)
+	c1, r1 = clampInt(c1, math.MinInt32, int(tm.MatrixWidth)-1), clampInt(r1, math.MinInt32, int(tm.MatrixHeight)-1)
+	if c0 > c1 || r0 > r1 {
+		return [4]int{}, false
+	}
+	return [4]int{c0, r0, c1, r1}, true
+}
+
+// tileFilter returns the WHERE clause and arguments selecting the tiles of
+// table_name in zooms and intersecting bbox, both optional.
+func (g *GeoPackage) tileFilter(table_name string, zooms *ZoomRange, bbox *general.Extent) (string, []interface{}, error) {
+	if bbox == nil {
+		if zooms == nil {
+			return "1", nil, nil
+		}
+		return "zoom_level BETWEEN ? AND ?", []interface{}{zooms.Min, zooms.Max}, nil
+	}
+
+	tms, err := g.GetTileMatrixSet(table_name)
+	if err != nil {
+		return "", nil, err
+	}
+	if tms.MinX == nil || tms.MaxY == nil {
+		return "", nil, fmt.Errorf("tile matrix set of %v has no bounds", table_name)
+	}
+	var matrices []TileMatrix
+	if err := g.DB.Where("table_name = ?", table_name).Order("zoom_level").Find(&matrices).Error; err != nil {
+		return "", nil, errors.Wrap(err, "Error reading tile matrices of "+table_name)
+	}
+
+	var (
+		where []string
+		args  []interface{}
+	)
+	for i := range matrices {
+		tm := &matrices[i]
+		if !zooms.contains(int(tm.ZoomLevel)) {
+			continue
+		}
+		b, ok := tileBounds(tms, tm, bbox)
+		if !ok {
+			continue
+		}
+		where = append(where, "(zoom_level = ? AND tile_column BETWEEN ? AND ? AND tile_row BETWEEN ? AND ?)")
+		args = append(args, tm.ZoomLevel, b[0], b[2], b[1], b[3])
+	}
+	if len(where) == 0 {
+		return "0", nil, nil
+	}
+	return strings.Join(where, " OR "), args, nil
+}
+
+type TileIterator struct {
+	rows *sql.Rows
+}
+
+// TileIterator returns an iterator over the tiles of table_name within
+// zooms and intersecting bbox, in the srs of the table. A nil zooms or bbox
+// does not restrict the tiles. Tiles are ordered by zoom, column and row.
+func (g *GeoPackage) TileIterator(table_name string, zooms *ZoomRange, bbox *general.Extent) (*TileIterator, error) {
+	const selectSQL = `SELECT zoom_level, tile_column, tile_row, tile_data FROM "%v" WHERE %v ORDER BY zoom_level, tile_column, tile_row`
+
+	where, args, err := g.tileFilter(table_name, zooms, bbox)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := g.DB.DB().Query(fmt.Sprintf(selectSQL, table_name, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	return &TileIterator{rows: rows}, nil
+}
+
+func (it *TileIterator) Next() bool {
+	return it.rows.Next()
+}
+
+func (it *TileIterator) Read() (*Tile, error) {
+	t := &Tile{}
+	if err := it.rows.Scan(&t.Zoom, &t.Column, &t.Row, &t.Data); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Err returns the error that ended the iteration, if any.
+func (it *TileIterator) Err() error {
+	return it.rows.Err()
+}
+
+func (it *TileIterator) Close() error {
+	return it.rows.Close()
+}
+
+// storeTiles stores the tiles returned by next, until it returns nil, with
+// a prepared statement in a single transaction.
+func (g *GeoPackage) storeTiles(table_name string, next func() (*Tile, error)) error {
+	tx, err := g.DB.DB().Begin()
+	if err != nil {
+		return errors.Wrap(err, "Error starting transaction")
+	}
+	if err = storeTilesTx(tx, table_name, next); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// storeTilesTx stores the tiles returned by next, until it returns nil,
+// with a prepared statement in tx.
+func storeTilesTx(tx *sql.Tx, table_name string, next func() (*Tile, error)) error {
+	const insertSQL = `INSERT OR REPLACE INTO "%v" (zoom_level, tile_column, tile_row, tile_data) VALUES (?, ?, ?, ?)`
+
+	stmt, err := tx.Prepare(fmt.Sprintf(insertSQL, table_name))
+	if err != nil {
+		return errors.Wrap(err, "Error preparing insert into "+table_name)
+	}
+	defer stmt.Close()
+
+	for {
+		t, err := next()
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			return nil
+		}
+		if _, err = stmt.Exec(t.Zoom, t.Column, t.Row, t.Data); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Error storing tile %d/%d/%d", t.Zoom, t.Column, t.Row))
+		}
+	}
+}
+
+// nextTile returns a function returning the tiles one by one, then nil.
+func nextTile(tiles []*Tile) func() (*Tile, error) {
+	i := 0
+	return func() (*Tile, error) {
+		if i == len(tiles) {
+			return nil, nil
+		}
+		i++
+		return tiles[i-1], nil
+	}
+}
+
+// StoreTiles stores tiles into table_name in a single transaction,
+// replacing existing tiles.
+func (g *GeoPackage) StoreTiles(table_name string, tiles []*Tile) error {
+	return g.storeTiles(table_name, nextTile(tiles))
+}
+
+// StoreTileStream stores the tiles received from tiles into table_name in a
+// single transaction committed when tiles is closed. On error the rest of
+// tiles is drained, so that producers are not blocked.
+func (g *GeoPackage) StoreTileStream(table_name string, tiles <-chan *Tile) error {
+	err := g.storeTiles(table_name, func() (*Tile, error) {
+		t, ok := <-tiles
+		if !ok {
+			return nil, nil
+		}
+		return t, nil
+	})
+	if err != nil {
+		for range tiles {
+		}
+	}
+	return err
+}
+
+// dropTilesTable drops the tiles table table_name and removes it from the
+// gpkg tables referencing it, in a single transaction.
+func (g *GeoPackage) dropTilesTable(table_name string) error {
+	stmts := []string{
+		`DELETE FROM gpkg_tile_matrix WHERE table_name = ?`,
+		`DELETE FROM gpkg_tile_matrix_set WHERE table_name = ?`,
+		`DELETE FROM gpkg_contents WHERE table_name = ?`,
+	}
+	if g.TableExist(Extension{}.TableName()) {
+		stmts = append(stmts, `DELETE FROM gpkg_extensions WHERE table_name = ?`)
+	}
+	if g.TableExist(VectorTileLayer{}.TableName()) {
+		stmts = append(stmts,
+			`DELETE FROM gpkgext_vt_fields WHERE layer_id IN (SELECT id FROM gpkgext_vt_layers WHERE table_name = ?)`,
+			`DELETE FROM gpkgext_vt_layers WHERE table_name = ?`)
+	}
+
+	tx, err := g.DB.DB().Begin()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range stmts {
+		if _, err = tx.Exec(stmt, table_name); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err = tx.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS "%v"`, table_name)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// TileExists reports whether table_name has the tile z/x/y.
+func (g *GeoPackage) TileExists(table_name string, z int, x int, y int) (bool, error) {
+	const selectSQL = `SELECT EXISTS (SELECT 1 FROM "%v" WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?)`
+	var exists bool
+	err := g.DB.DB().QueryRow(fmt.Sprintf(selectSQL, table_name), z, x, y).Scan(&exists)
+	return exists, err
+}
+
+// deleteTileAncillary removes the gridded tile ancillary rows left by
+// deleted tiles of table_name.
+func (g *GeoPackage) deleteTileAncillary(table_name string) error {
+	const deleteSQL = `DELETE FROM gpkg_2d_gridded_tile_ancillary WHERE tpudt_name = ? AND tpudt_id NOT IN (SELECT id FROM "%v")`
+	if !g.TableExist(GriddedTile{}.TableName()) {
+		return nil
+	}
+	_, err := g.DB.DB().Exec(fmt.Sprintf(deleteSQL, table_name), table_name)
+	return err
+}
+
+// DeleteTile deletes the tile z/x/y of table_name, or returns sql.ErrNoRows
+// if there is none.
+func (g *GeoPackage) DeleteTile(table_name string, z int, x int, y int) error {
+	const deleteSQL = `DELETE FROM "%v" WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?`
+	res, err := g.DB.DB().Exec(fmt.Sprintf(deleteSQL, table_name), z, x, y)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return g.deleteTileAncillary(table_name)
+}
+
+// DeleteTiles deletes the tiles of table_name at zoom intersecting bbox, all
+// the tiles of the zoom level when bbox is nil, and returns their number.
+func (g *GeoPackage) DeleteTiles(table_name string, zoom int, bbox *general.Extent) (int64, error) {
+	const deleteSQL = `DELETE FROM "%v" WHERE %v`
+
+	where, args, err := g.tileFilter(table_name, &ZoomRange{Min: zoom, Max: zoom}, bbox)
+	if err != nil {
+		return 0, err
+	}
+	res, err := g.DB.DB().Exec(fmt.Sprintf(deleteSQL, table_name, where), args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, g.deleteTileAncillary(table_name)
+}
+
+// GridTileCoord returns the zoom level, column and row in table_name of the
+// tile coord, a level, x and y of grid. The tile matrix is the one with the
+// resolution of the level, and rows of lower left grids are flipped to count
+// from the top.
+func (g *GeoPackage) GridTileCoord(table_name string, grid *geo.TileGrid, coord [3]int) (int, int, int, error) {
+	if coord[2] < 0 || coord[2] >= int(grid.Levels) {
+		return 0, 0, 0, fmt.Errorf("grid has no level %d", coord[2])
+	}
+	res := grid.Resolutions[coord[2]]
+
+	matrices := []TileMatrix{}
+	if err := g.DB.Where("table_name = ?", table_name).Find(&matrices).Error; err != nil {
+		return 0, 0, 0, errors.Wrap(err, "Error reading tile matrices of "+table_name)
+	}
+	for _, tm := range matrices {
+		if math.Abs(tm.PixelXSize-res) > res*1e-9 {
+			continue
+		}
+		x, y := coord[0], coord[1]
+		if !grid.FlippedYAxis {
+			y = int(tm.MatrixHeight) - 1 - y
+		}
+		return int(tm.ZoomLevel), x, y, nil
+	}
+	return 0, 0, 0, fmt.Errorf("%v has no tile matrix with resolution %v", table_name, res)
+}
+
+// StoreGridTile stores data as the tile coord of grid, see GridTileCoord.
+func (g *GeoPackage) StoreGridTile(table_name string, grid *geo.TileGrid, coord [3]int, data []byte) error {
+	z, x, y, err := g.GridTileCoord(table_name, grid, coord)
+	if err != nil {
+		return err
+	}
+	return g.StoreTile(table_name, z, x, y, data)
+}
+
+// GetGridTile returns the tile coord of grid, see GridTileCoord.
+func (g *GeoPackage) GetGridTile(table_name string, grid *geo.TileGrid, coord [3]int) ([]byte, error) {
+	z, x, y, err := g.GridTileCoord(table_name, grid, coord)
+	if err != nil {
+		return nil, err
+	}
+	return g.GetTile(table_name, z, x, y)
+}
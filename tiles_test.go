@@ -0,0 +1,103 @@
+package gpkg
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/flywave/go-geo"
+	"github.com/flywave/go-geom/general"
+)
+
+func TestTiles(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	grid := newCoverageTestGrid()
+	if err := gpkg.AddTilesTable("tiles", grid, geo.NewBBoxCoverage(*grid.BBox, grid.Srs, false)); err != nil {
+		t.Fatal(err)
+	}
+
+	tiles := []*Tile{{Zoom: 0, Column: 0, Row: 0, Data: []byte("0")}}
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 4; y++ {
+			tiles = append(tiles, &Tile{Zoom: 2, Column: x, Row: y, Data: []byte{byte(x), byte(y)}})
+		}
+	}
+	if err := gpkg.StoreTiles("tiles", tiles); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan *Tile)
+	go func() {
+		for x := 0; x < 2; x++ {
+			ch <- &Tile{Zoom: 1, Column: x, Row: 0, Data: []byte("1")}
+		}
+		close(ch)
+	}()
+	if err := gpkg.StoreTileStream("tiles", ch); err != nil {
+		t.Fatal(err)
+	}
+
+	count := func(zooms *ZoomRange, bbox *general.Extent) int {
+		it, err := gpkg.TileIterator("tiles", zooms, bbox)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer it.Close()
+		n := 0
+		for it.Next() {
+			if _, err := it.Read(); err != nil {
+				t.Fatal(err)
+			}
+			n++
+		}
+		if it.Err() != nil {
+			t.Fatal(it.Err())
+		}
+		return n
+	}
+	if n := count(nil, nil); n != 19 {
+		t.Fatal(n)
+	}
+	if n := count(&ZoomRange{Min: 1, Max: 2}, nil); n != 18 {
+		t.Fatal(n)
+	}
+	// the north west quarter of the world
+	nw := &general.Extent{grid.BBox.Min[0], 1, -1, grid.BBox.Max[1]}
+	if n := count(nil, nw); n != 1+1+4 {
+		t.Fatal(n)
+	}
+
+	it, _ := gpkg.TileIterator("tiles", &ZoomRange{Min: 2, Max: 2}, nw)
+	it.Next()
+	tile, err := it.Read()
+	it.Close()
+	if err != nil || tile.Column != 0 || tile.Row != 0 || tile.Data[0] != 0 {
+		t.FailNow()
+	}
+
+	if ok, err := gpkg.TileExists("tiles", 2, 3, 3); err != nil || !ok {
+		t.FailNow()
+	}
+	if err := gpkg.DeleteTile("tiles", 2, 3, 3); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := gpkg.TileExists("tiles", 2, 3, 3); ok {
+		t.FailNow()
+	}
+	if err := gpkg.DeleteTile("tiles", 2, 3, 3); err != sql.ErrNoRows {
+		t.FailNow()
+	}
+
+	if n, err := gpkg.DeleteTiles("tiles", 2, nw); err != nil || n != 4 {
+		t.Fatal(n, err)
+	}
+	if n, err := gpkg.DeleteTiles("tiles", 2, nil); err != nil || n != 11 {
+		t.Fatal(n, err)
+	}
+	if n := count(nil, nil); n != 3 {
+		t.Fatal(n)
+	}
+}
@@ -0,0 +1,331 @@
+package gpkg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/flywave/go-geo"
+	"github.com/flywave/go-geom"
+	"github.com/pkg/errors"
+)
+
+const (
+	VectorTilesExtensionName       = "im_vector_tiles"
+	VectorTilesMapboxExtensionName = "im_vector_tiles_mapbox"
+	VectorTilesExtensionDefinition = "http://docs.opengeospatial.org/per/18-074.html"
+
+	VectorTileFieldString  = "String"
+	VectorTileFieldNumber  = "Number"
+	VectorTileFieldBoolean = "Boolean"
+)
+
+// VectorTileLayer describes a layer of the vector tiles of a tiles table,
+// in gpkgext_vt_layers. MinZoom and MaxZoom are the zoom levels of the
+// tiles having the layer.
+type VectorTileLayer struct {
+	Id                  int     `gorm:"column:id;primary_key;AUTO_INCREMENT"`
+	Table               string  `sql:"type:text" gorm:"column:table_name;not null;unique_index:vtl_table_name"`
+	Name                string  `sql:"type:text" gorm:"column:name;not null;unique_index:vtl_table_name"`
+	Description         string  `sql:"type:text" gorm:"column:description"`
+	MinZoom             *int    `gorm:"column:minzoom"`
+	MaxZoom             *int    `gorm:"column:maxzoom"`
+	AttributesTableName *string `sql:"type:text" gorm:"column:attributes_table_name"`
+}
+
+func (VectorTileLayer) TableName() string {
+	return "gpkgext_vt_layers"
+}
+
+// VectorTileField describes a property of the features of a vector tile
+// layer, in gpkgext_vt_fields.
+type VectorTileField struct {
+	Id      int    `gorm:"column:id;primary_key;AUTO_INCREMENT"`
+	LayerId int    `gorm:"column:layer_id;not null;unique_index:vtf_layer_name"`
+	Name    string `sql:"type:text" gorm:"column:name;not null;unique_index:vtf_layer_name"`
+	Type    string `sql:"type:text" gorm:"column:type;not null"`
+}
+
+func (VectorTileField) TableName() string {
+	return "gpkgext_vt_fields"
+}
+
+// AddVectorTilesTable creates the tiles table table_name for Mapbox Vector
+// Tiles, like AddTilesTable, and registers the vector tiles extension.
+func (g *GeoPackage) AddVectorTilesTable(table_name string, grid *geo.TileGrid, cov geo.Coverage, opts ...*TilesTableOptions) error {
+	var opt *TilesTableOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if err := g.addTilesTable(table_name, DataTypeVectorTiles, grid, cov, opt); err != nil {
+		return err
+	}
+	if err := g.DB.AutoMigrate(VectorTileLayer{}).Error; err != nil {
+		return errors.Wrap(err, "Error migrating VectorTileLayer")
+	}
+	if err := g.DB.AutoMigrate(VectorTileField{}).Error; err != nil {
+		return errors.Wrap(err, "Error migrating VectorTileField")
+	}
+
+	tileData := "tile_data"
+	for _, ext := range []Extension{
+		{Table: VectorTileLayer{}.TableName(), Extension: VectorTilesExtensionName},
+		{Table: VectorTileField{}.TableName(), Extension: VectorTilesExtensionName},
+		{Table: table_name, Extension: VectorTilesExtensionName},
+		{Table: table_name, Column: &tileData, Extension: VectorTilesMapboxExtensionName},
+	} {
+		ext.Definition = VectorTilesExtensionDefinition
+		ext.Scope = ExtensionScopeReadWrite
+		if err := g.RegisterExtension(ext); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetVectorTileLayers returns the layers of the vector tiles of table_name.
+func (g *GeoPackage) GetVectorTileLayers(table_name string) ([]VectorTileLayer, error) {
+	layers := make([]VectorTileLayer, 0)
+	if !g.TableExist(VectorTileLayer{}.TableName()) {
+		return layers, nil
+	}
+	err := g.DB.Where("table_name = ?", table_name).Order("id").Find(&layers).Error
+	return layers, err
+}
+
+// GetVectorTileFields returns the fields of the layer layer_id.
+func (g *GeoPackage) GetVectorTileFields(layer_id int) ([]VectorTileField, error) {
+	fields := make([]VectorTileField, 0)
+	err := g.DB.Where("layer_id = ?", layer_id).Order("id").Find(&fields).Error
+	return fields, err
+}
+
+// vectorTileFieldType returns the field type of a property value.
+func vectorTileFieldType(v interface{}) string {
+	switch mvtValue(v).(type) {
+	case bool:
+		return VectorTileFieldBoolean
+	case float64, int64, uint64:
+		return VectorTileFieldNumber
+	}
+	return VectorTileFieldString
+}
+
+// VectorTileMetadata describes a layer of stored vector tiles beyond what
+// the tiles hold: the Description and AttributesTableName of Layer, whose
+// Name selects the layer, and the declared types of its Fields, which take
+// precedence over the types detected from the features.
+type VectorTileMetadata struct {
+	Layer  VectorTileLayer
+	Fields []VectorTileField
+}
+
+// updateVectorTileLayers adds the layers and fields of tiles of zoom level
+// z to gpkgext_vt_layers and gpkgext_vt_fields in tx, and extends the zoom
+// levels of the layers to z. The metadata of the layers is applied.
+func updateVectorTileLayers(tx *sql.Tx, table_name string, z int, layers []*mvtLayer, metadata []VectorTileMetadata) error {
+	const (
+		upsertLayerSQL = `
+		INSERT INTO gpkgext_vt_layers (table_name, name, minzoom, maxzoom)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(table_name, name) DO UPDATE SET
+			minzoom = min(coalesce(minzoom, excluded.minzoom), excluded.minzoom),
+			maxzoom = max(coalesce(maxzoom, excluded.maxzoom), excluded.maxzoom)
+		`
+		updateLayerSQL = `UPDATE gpkgext_vt_layers SET description = ?, attributes_table_name = ? WHERE id = ?`
+		selectLayerSQL = `SELECT id FROM gpkgext_vt_layers WHERE table_name = ? AND name = ?`
+		insertFieldSQL = `INSERT INTO gpkgext_vt_fields (layer_id, name, type) VALUES (?, ?, ?) ON CONFLICT(layer_id, name) DO NOTHING`
+		upsertFieldSQL = `INSERT INTO gpkgext_vt_fields (layer_id, name, type) VALUES (?, ?, ?) ON CONFLICT(layer_id, name) DO UPDATE SET type = excluded.type`
+	)
+
+	meta := make(map[string]*VectorTileMetadata, len(metadata))
+	for i := range metadata {
+		meta[metadata[i].Layer.Name] = &metadata[i]
+	}
+
+	for _, l := range layers {
+		if _, err := tx.Exec(upsertLayerSQL, table_name, l.Name, z, z); err != nil {
+			return errors.Wrap(err, "Error storing vector tile layer "+l.Name)
+		}
+		var id int
+		if err := tx.QueryRow(selectLayerSQL, table_name, l.Name).Scan(&id); err != nil {
+			return errors.Wrap(err, "Error reading vector tile layer "+l.Name)
+		}
+
+		m := meta[l.Name]
+		if m != nil {
+			if _, err := tx.Exec(updateLayerSQL, m.Layer.Description, m.Layer.AttributesTableName, id); err != nil {
+				return errors.Wrap(err, "Error storing vector tile layer "+l.Name)
+			}
+			for _, f := range m.Fields {
+				if _, err := tx.Exec(upsertFieldSQL, id, f.Name, f.Type); err != nil {
+					return errors.Wrap(err, "Error storing vector tile field "+f.Name)
+				}
+			}
+		}
+
+		fields := map[string]string{}
+		for _, f := range l.Features {
+			for k, v := range f.Properties {
+				if _, ok := fields[k]; !ok {
+					fields[k] = vectorTileFieldType(v)
+				}
+			}
+		}
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if _, err := tx.Exec(insertFieldSQL, id, name, fields[name]); err != nil {
+				return errors.Wrap(err, "Error storing vector tile field "+name)
+			}
+		}
+	}
+	return nil
+}
+
+// decodeVectorTile decodes a Mapbox Vector Tile, gzip compressed or not.
+func decodeVectorTile(data []byte) ([]*mvtLayer, error) {
+	if bytes.HasPrefix(data, []byte("\x1f\x8b")) {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = ioutil.ReadAll(r); err != nil {
+			return nil, err
+		}
+	}
+	return decodeMVT(data)
+}
+
+// StoreVectorTile stores the Mapbox Vector Tile data, gzip compressed or
+// not, as the tile z/x/y of table_name and records its layers and their
+// fields in gpkgext_vt_layers and gpkgext_vt_fields, with the optional
+// metadata of the layers, in a single transaction.
+func (g *GeoPackage) StoreVectorTile(table_name string, z int, x int, y int, data []byte, metadata ...VectorTileMetadata) error {
+	const insertSQL = `INSERT OR REPLACE INTO "%v" (zoom_level, tile_column, tile_row, tile_data) VALUES (?, ?, ?, ?)`
+
+	layers, err := decodeVectorTile(data)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Error decoding vector tile %d/%d/%d", z, x, y))
+	}
+
+	tx, err := g.DB.DB().Begin()
+	if err != nil {
+		return errors.Wrap(err, "Error starting transaction")
+	}
+	if err = updateVectorTileLayers(tx, table_name, z, layers, metadata); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err = tx.Exec(fmt.Sprintf(insertSQL, table_name), z, x, y, data); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, fmt.Sprintf("Error storing tile %d/%d/%d", z, x, y))
+	}
+	return tx.Commit()
+}
+
+// mergeVectorTileLayers merges the layers into merged, keeping a single
+// feature per layer with the first value of each property, enough for
+// updateVectorTileLayers to record the fields.
+func mergeVectorTileLayers(merged []*mvtLayer, layers []*mvtLayer) []*mvtLayer {
+	for _, l := range layers {
+		var m *mvtLayer
+		for _, ml := range merged {
+			if ml.Name == l.Name {
+				m = ml
+				break
+			}
+		}
+		if m == nil {
+			m = &mvtLayer{Name: l.Name, Features: []mvtFeature{{Properties: map[string]interface{}{}}}}
+			merged = append(merged, m)
+		}
+		props := m.Features[0].Properties
+		for _, f := range l.Features {
+			for k, v := range f.Properties {
+				if _, ok := props[k]; !ok {
+					props[k] = v
+				}
+			}
+		}
+	}
+	return merged
+}
+
+// storeVectorTiles stores tiles of zoom level z into table_name, and the
+// layers of their features, in a single transaction.
+func (g *GeoPackage) storeVectorTiles(table_name string, z int, tiles []*Tile, layers []*mvtLayer) error {
+	tx, err := g.DB.DB().Begin()
+	if err != nil {
+		return errors.Wrap(err, "Error starting transaction")
+	}
+	if err = updateVectorTileLayers(tx, table_name, z, layers, nil); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = storeTilesTx(tx, table_name, nextTile(tiles)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReadVectorTile decodes the tile z/x/y of table_name into a feature
+// collection per layer, with the geometries in the srs of the table. It
+// returns sql.ErrNoRows if there is no such tile.
+func (g *GeoPackage) ReadVectorTile(table_name string, z int, x int, y int) (map[string]*geom.FeatureCollection, error) {
+	data, err := g.GetTile(table_name, z, x, y)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	layers, err := decodeVectorTile(data)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error decoding vector tile %d/%d/%d", z, x, y))
+	}
+
+	tms := TileMatrixSet{}
+	if err := g.DB.Where("table_name = ?", table_name).First(&tms).Error; err != nil {
+		return nil, errors.Wrap(err, "Error reading tile matrix set of "+table_name)
+	}
+	if tms.MinX == nil || tms.MaxY == nil {
+		return nil, fmt.Errorf("tile matrix set of %v has no bounds", table_name)
+	}
+	tm, err := g.getTileMatrix(table_name, z)
+	if err != nil {
+		return nil, err
+	}
+	w, h := float64(tm.TileWidth)*tm.PixelXSize, float64(tm.TileHeight)*tm.PixelYSize
+	minx, maxy := *tms.MinX+float64(x)*w, *tms.MaxY-float64(y)*h
+
+	collections := make(map[string]*geom.FeatureCollection, len(layers))
+	for _, l := range layers {
+		extent := float64(l.Extent)
+		project := func(px float64, py float64) []float64 {
+			return []float64{minx + px/extent*w, maxy - py/extent*h}
+		}
+		fc := geom.NewFeatureCollection()
+		for _, f := range l.Features {
+			geometry, err := decodeMVTGeometry(f.Type, f.Geometry, project)
+			if err != nil {
+				return nil, errors.Wrap(err, "Error decoding feature of layer "+l.Name)
+			}
+			feature := geom.NewFeature(geometry)
+			if f.ID != nil {
+				feature.ID = int64(*f.ID)
+			}
+			feature.Properties = f.Properties
+			fc.Features = append(fc.Features, feature)
+		}
+		collections[l.Name] = fc
+	}
+	return collections, nil
+}
@@ -0,0 +1,106 @@
+package gpkg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/flywave/go-geom"
+	"github.com/flywave/go-geom/general"
+)
+
+func TestVectorTiles(t *testing.T) {
+	gpkg := Create("./test.gpkg")
+	defer os.Remove("./test.gpkg")
+	defer gpkg.Close()
+
+	grid := newCoverageTestGrid()
+	if err := gpkg.AddVectorTilesTable("vt", grid, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tile 1/0/0 is the top left quarter of the grid.
+	minx, maxy, size := grid.BBox.Min[0], grid.BBox.Max[1], (grid.BBox.Max[0]-grid.BBox.Min[0])/2
+	pixel := func(c []float64) [2]int64 {
+		return [2]int64{int64(math.Round((c[0] - minx) / size * 4096)), int64(math.Round((maxy - c[1]) / size * 4096))}
+	}
+	typ, cmds := encodeMVTGeometry(general.NewLineString([][]float64{{minx + size/4, maxy - size/4}, {minx + size/2, maxy - size/2}}), pixel)
+	data := encodeMVT([]*mvtLayer{{Name: "roads", Features: []mvtFeature{
+		{Type: typ, Geometry: cmds, Properties: map[string]interface{}{"name": "a", "lanes": 2}},
+	}}})
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+
+	if err := gpkg.StoreVectorTile("vt", 1, 0, 0, buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := gpkg.StoreVectorTile("vt", 2, 0, 0, data); err != nil {
+		t.Fatal(err)
+	}
+
+	layers, err := gpkg.GetVectorTileLayers("vt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 1 || layers[0].Name != "roads" || *layers[0].MinZoom != 1 || *layers[0].MaxZoom != 2 {
+		t.Fatal(layers)
+	}
+	fields, err := gpkg.GetVectorTileFields(layers[0].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 2 || fields[0].Name != "lanes" || fields[0].Type != VectorTileFieldNumber || fields[1].Type != VectorTileFieldString {
+		t.Fatal(fields)
+	}
+
+	fcs, err := gpkg.ReadVectorTile("vt", 1, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc := fcs["roads"]
+	if fc == nil || len(fc.Features) != 1 || fc.Features[0].Properties["name"] != "a" {
+		t.Fatal(fcs)
+	}
+	ls, ok := fc.Features[0].Geometry.(geom.LineString)
+	if !ok {
+		t.Fatal(fc.Features[0].Geometry)
+	}
+	if p := ls.Data()[1]; math.Abs(p[0]-(minx+size/2)) > size/4096 || math.Abs(p[1]-(maxy-size/2)) > size/4096 {
+		t.Fatal(p)
+	}
+
+	if _, err := gpkg.ReadVectorTile("vt", 1, 1, 1); err != sql.ErrNoRows {
+		t.Fatal(err)
+	}
+
+	attributes := "road_attributes"
+	metadata := VectorTileMetadata{
+		Layer:  VectorTileLayer{Name: "roads", Description: "road network", AttributesTableName: &attributes},
+		Fields: []VectorTileField{{Name: "lanes", Type: VectorTileFieldString}, {Name: "oneway", Type: VectorTileFieldBoolean}},
+	}
+	if err := gpkg.StoreVectorTile("vt", 0, 0, 0, data, metadata); err != nil {
+		t.Fatal(err)
+	}
+	layers, _ = gpkg.GetVectorTileLayers("vt")
+	if len(layers) != 1 || layers[0].Description != "road network" || *layers[0].AttributesTableName != attributes || *layers[0].MinZoom != 0 || *layers[0].MaxZoom != 2 {
+		t.Fatal(layers)
+	}
+	fields, _ = gpkg.GetVectorTileFields(layers[0].Id)
+	if len(fields) != 3 || fields[0].Name != "lanes" || fields[0].Type != VectorTileFieldString || fields[2].Name != "oneway" {
+		t.Fatal(fields)
+	}
+
+	// the layers of a tile that cannot be stored are not recorded
+	other := encodeMVT([]*mvtLayer{{Name: "rivers", Features: []mvtFeature{{Type: typ, Geometry: cmds}}}})
+	if err := gpkg.StoreVectorTile("missing", 1, 0, 0, other); err == nil {
+		t.FailNow()
+	}
+	if n, _ := gpkg.QueryInt(`SELECT count(*) FROM gpkgext_vt_layers WHERE name = 'rivers'`); n != 0 {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,527 @@
+package gpkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/flywave/go-geom"
+)
+
+// Layout is the coordinate dimension of an encoded geometry. Coordinates
+// hold the ordinates in layout order, so an XYM coordinate is [x, y, m].
+type Layout uint8
+
+const (
+	LayoutDefault Layout = iota // XY, or XYZ for three ordinates, or XYZM for four
+	LayoutXY
+	LayoutXYZ
+	LayoutXYM
+	LayoutXYZM
+)
+
+func (l Layout) Stride() int {
+	switch l {
+	case LayoutXYZ, LayoutXYM:
+		return 3
+	case LayoutXYZM:
+		return 4
+	default:
+		return 2
+	}
+}
+
+func (l Layout) EnvelopeType() envelopeType {
+	switch l {
+	case LayoutXYZ:
+		return EnvelopeTypeXYZ
+	case LayoutXYM:
+		return EnvelopeTypeXYM
+	case LayoutXYZM:
+		return EnvelopeTypeXYZM
+	default:
+		return EnvelopeTypeXY
+	}
+}
+
+func (l Layout) String() string {
+	switch l {
+	case LayoutXYZ:
+		return "XYZ"
+	case LayoutXYM:
+		return "XYM"
+	case LayoutXYZM:
+		return "XYZM"
+	default:
+		return "XY"
+	}
+}
+
+const (
+	wkbPoint              = 1
+	wkbLineString         = 2
+	wkbPolygon            = 3
+	wkbMultiPoint         = 4
+	wkbMultiLineString    = 5
+	wkbMultiPolygon       = 6
+	wkbGeometryCollection = 7
+
+	ewkbZ    = 0x80000000
+	ewkbM    = 0x40000000
+	ewkbSRID = 0x20000000
+)
+
+var wkbTypeCodes = map[geom.GeometryType]uint32{
+	geom.GeometryPoint:           wkbPoint,
+	geom.GeometryLineString:      wkbLineString,
+	geom.GeometryPolygon:         wkbPolygon,
+	geom.GeometryMultiPoint:      wkbMultiPoint,
+	geom.GeometryMultiLineString: wkbMultiLineString,
+	geom.GeometryMultiPolygon:    wkbMultiPolygon,
+	geom.GeometryCollection:      wkbGeometryCollection,
+}
+
+var multiGeometryTypes = map[uint32]geom.GeometryType{
+	wkbMultiPoint:      geom.GeometryMultiPoint,
+	wkbMultiLineString: geom.GeometryMultiLineString,
+	wkbMultiPolygon:    geom.GeometryMultiPolygon,
+}
+
+// geometryLayout infers the layout of g from the length of its first
+// coordinate.
+func geometryLayout(g *geom.GeometryData) Layout {
+	layout := LayoutXY
+	walkCoordinates(g, func(c []float64) bool {
+		switch len(c) {
+		case 3:
+			layout = LayoutXYZ
+		case 4:
+			layout = LayoutXYZM
+		}
+		return false
+	})
+	return layout
+}
+
+// walkCoordinates calls fn with every coordinate of g until it returns
+// false.
+func walkCoordinates(g *geom.GeometryData, fn func([]float64) bool) bool {
+	if g == nil {
+		return true
+	}
+	each := func(cs [][]float64) bool {
+		for _, c := range cs {
+			if !fn(c) {
+				return false
+			}
+		}
+		return true
+	}
+	switch g.Type {
+	case geom.GeometryPoint:
+		if len(g.Point) > 0 {
+			return fn(g.Point)
+		}
+	case geom.GeometryMultiPoint:
+		return each(g.MultiPoint)
+	case geom.GeometryLineString:
+		return each(g.LineString)
+	case geom.GeometryMultiLineString:
+		for _, l := range g.MultiLineString {
+			if !each(l) {
+				return false
+			}
+		}
+	case geom.GeometryPolygon:
+		for _, r := range g.Polygon {
+			if !each(r) {
+				return false
+			}
+		}
+	case geom.GeometryMultiPolygon:
+		for _, p := range g.MultiPolygon {
+			for _, r := range p {
+				if !each(r) {
+					return false
+				}
+			}
+		}
+	case geom.GeometryCollection:
+		for _, c := range g.Geometries {
+			if !walkCoordinates(c, fn) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// geometryEnvelope returns the envelope of g in GeoPackage header order
+// (minx, maxx, miny, maxy, then min and max of z and/or m), nil when g has
+// no coordinates.
+func geometryEnvelope(g *geom.GeometryData, layout Layout) []float64 {
+	stride := layout.Stride()
+	var env []float64
+	walkCoordinates(g, func(c []float64) bool {
+		if env == nil {
+			env = make([]float64, stride*2)
+			for i := 0; i < stride; i++ {
+				env[i*2], env[i*2+1] = math.Inf(1), math.Inf(-1)
+			}
+		}
+		for i := 0; i < stride && i < len(c); i++ {
+			env[i*2] = math.Min(env[i*2], c[i])
+			env[i*2+1] = math.Max(env[i*2+1], c[i])
+		}
+		return true
+	})
+	return env
+}
+
+type wkbWriter struct {
+	buf    *bytes.Buffer
+	order  binary.ByteOrder
+	layout Layout
+}
+
+// EncodeWKB writes g as ISO WKB in the given byte order and layout.
+func EncodeWKB(g *geom.GeometryData, order binary.ByteOrder, layout Layout, buf *bytes.Buffer) error {
+	if layout == LayoutDefault {
+		layout = geometryLayout(g)
+	}
+	w := &wkbWriter{buf: buf, order: order, layout: layout}
+	return w.geometry(g)
+}
+
+func (w *wkbWriter) uint32(v uint32) {
+	var b [4]byte
+	w.order.PutUint32(b[:], v)
+	w.buf.Write(b[:])
+}
+
+func (w *wkbWriter) float64(v float64) {
+	var b [8]byte
+	w.order.PutUint64(b[:], math.Float64bits(v))
+	w.buf.Write(b[:])
+}
+
+func (w *wkbWriter) header(code uint32) {
+	if w.order == binary.LittleEndian {
+		w.buf.WriteByte(1)
+	} else {
+		w.buf.WriteByte(0)
+	}
+	switch w.layout {
+	case LayoutXYZ:
+		code += 1000
+	case LayoutXYM:
+		code += 2000
+	case LayoutXYZM:
+		code += 3000
+	}
+	w.uint32(code)
+}
+
+func (w *wkbWriter) coord(c []float64) {
+	for i := 0; i < w.layout.Stride(); i++ {
+		if i < len(c) {
+			w.float64(c[i])
+		} else {
+			w.float64(0)
+		}
+	}
+}
+
+func (w *wkbWriter) coords(cs [][]float64) {
+	w.uint32(uint32(len(cs)))
+	for _, c := range cs {
+		w.coord(c)
+	}
+}
+
+func (w *wkbWriter) rings(rs [][][]float64) {
+	w.uint32(uint32(len(rs)))
+	for _, r := range rs {
+		w.coords(r)
+	}
+}
+
+func (w *wkbWriter) geometry(g *geom.GeometryData) error {
+	if g == nil {
+		w.header(wkbGeometryCollection)
+		w.uint32(0)
+		return nil
+	}
+	code, ok := wkbTypeCodes[g.Type]
+	if !ok {
+		return fmt.Errorf("unsupported geometry type %q", g.Type)
+	}
+	w.header(code)
+	switch g.Type {
+	case geom.GeometryPoint:
+		if len(g.Point) == 0 {
+			// Empty points are encoded with NaN ordinates.
+			for i := 0; i < w.layout.Stride(); i++ {
+				w.float64(math.NaN())
+			}
+		} else {
+			w.coord(g.Point)
+		}
+	case geom.GeometryLineString:
+		w.coords(g.LineString)
+	case geom.GeometryPolygon:
+		w.rings(g.Polygon)
+	case geom.GeometryMultiPoint:
+		w.uint32(uint32(len(g.MultiPoint)))
+		for _, p := range g.MultiPoint {
+			w.header(wkbPoint)
+			w.coord(p)
+		}
+	case geom.GeometryMultiLineString:
+		w.uint32(uint32(len(g.MultiLineString)))
+		for _, l := range g.MultiLineString {
+			w.header(wkbLineString)
+			w.coords(l)
+		}
+	case geom.GeometryMultiPolygon:
+		w.uint32(uint32(len(g.MultiPolygon)))
+		for _, p := range g.MultiPolygon {
+			w.header(wkbPolygon)
+			w.rings(p)
+		}
+	case geom.GeometryCollection:
+		w.uint32(uint32(len(g.Geometries)))
+		for _, c := range g.Geometries {
+			if err := w.geometry(c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type wkbReader struct {
+	data []byte
+	pos  int
+}
+
+var errWKBTooShort = errors.New("not enough bytes to decode geometry")
+
+// DecodeWKB reads an ISO WKB or EWKB geometry, in either byte order, and
+// returns it with its layout.
+func DecodeWKB(data []byte) (*geom.GeometryData, Layout, error) {
+	r := &wkbReader{data: data}
+	return r.geometry()
+}
+
+func (r *wkbReader) order() (binary.ByteOrder, error) {
+	if r.pos >= len(r.data) {
+		return nil, errWKBTooShort
+	}
+	b := r.data[r.pos]
+	r.pos++
+	switch b {
+	case 0:
+		return binary.BigEndian, nil
+	case 1:
+		return binary.LittleEndian, nil
+	default:
+		return nil, fmt.Errorf("invalid WKB byte order %d", b)
+	}
+}
+
+func (r *wkbReader) uint32(order binary.ByteOrder) (uint32, error) {
+	if r.pos+4 > len(r.data) {
+		return 0, errWKBTooShort
+	}
+	v := order.Uint32(r.data[r.pos:])
+	r.pos += 4
+	return v, nil
+}
+
+func (r *wkbReader) coord(order binary.ByteOrder, layout Layout) ([]float64, error) {
+	stride := layout.Stride()
+	if r.pos+stride*8 > len(r.data) {
+		return nil, errWKBTooShort
+	}
+	c := make([]float64, stride)
+	for i := range c {
+		c[i] = math.Float64frombits(order.Uint64(r.data[r.pos:]))
+		r.pos += 8
+	}
+	return c, nil
+}
+
+func (r *wkbReader) coords(order binary.ByteOrder, layout Layout) ([][]float64, error) {
+	n, err := r.uint32(order)
+	if err != nil {
+		return nil, err
+	}
+	if int(n) > (len(r.data)-r.pos)/(layout.Stride()*8) {
+		return nil, errWKBTooShort
+	}
+	cs := make([][]float64, 0, n)
+	for i := uint32(0); i < n; i++ {
+		c, err := r.coord(order, layout)
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+func (r *wkbReader) rings(order binary.ByteOrder, layout Layout) ([][][]float64, error) {
+	n, err := r.uint32(order)
+	if err != nil {
+		return nil, err
+	}
+	if int(n) > (len(r.data)-r.pos)/4 {
+		return nil, errWKBTooShort
+	}
+	rs := make([][][]float64, 0, n)
+	for i := uint32(0); i < n; i++ {
+		ring, err := r.coords(order, layout)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, ring)
+	}
+	return rs, nil
+}
+
+func (r *wkbReader) header() (binary.ByteOrder, uint32, Layout, error) {
+	order, err := r.order()
+	if err != nil {
+		return nil, 0, LayoutDefault, err
+	}
+	code, err := r.uint32(order)
+	if err != nil {
+		return nil, 0, LayoutDefault, err
+	}
+
+	z, m := code&ewkbZ != 0, code&ewkbM != 0
+	if code&ewkbSRID != 0 {
+		if _, err = r.uint32(order); err != nil {
+			return nil, 0, LayoutDefault, err
+		}
+	}
+	code &= 0x0FFFFFFF
+	switch code / 1000 {
+	case 1:
+		z = true
+	case 2:
+		m = true
+	case 3:
+		z, m = true, true
+	}
+
+	layout := LayoutXY
+	switch {
+	case z && m:
+		layout = LayoutXYZM
+	case z:
+		layout = LayoutXYZ
+	case m:
+		layout = LayoutXYM
+	}
+	return order, code % 1000, layout, nil
+}
+
+// part reads a member of a multi geometry, which must have type code.
+func (r *wkbReader) part(code uint32) (binary.ByteOrder, Layout, error) {
+	order, c, layout, err := r.header()
+	if err != nil {
+		return nil, layout, err
+	}
+	if c != code {
+		return nil, layout, fmt.Errorf("unexpected WKB geometry type %d, expected %d", c, code)
+	}
+	return order, layout, nil
+}
+
+func (r *wkbReader) geometry() (*geom.GeometryData, Layout, error) {
+	order, code, layout, err := r.header()
+	if err != nil {
+		return nil, layout, err
+	}
+
+	g := &geom.GeometryData{}
+	switch code {
+	case wkbPoint:
+		g.Type = geom.GeometryPoint
+		c, err := r.coord(order, layout)
+		if err != nil {
+			return nil, layout, err
+		}
+		if !math.IsNaN(c[0]) || !math.IsNaN(c[1]) {
+			g.Point = c
+		}
+	case wkbLineString:
+		g.Type = geom.GeometryLineString
+		if g.LineString, err = r.coords(order, layout); err != nil {
+			return nil, layout, err
+		}
+	case wkbPolygon:
+		g.Type = geom.GeometryPolygon
+		if g.Polygon, err = r.rings(order, layout); err != nil {
+			return nil, layout, err
+		}
+	case wkbMultiPoint, wkbMultiLineString, wkbMultiPolygon:
+		g.Type = multiGeometryTypes[code]
+		n, err := r.uint32(order)
+		if err != nil {
+			return nil, layout, err
+		}
+		if int(n) > (len(r.data)-r.pos)/5 {
+			return nil, layout, errWKBTooShort
+		}
+		for i := uint32(0); i < n; i++ {
+			porder, playout, err := r.part(code - 3)
+			if err != nil {
+				return nil, layout, err
+			}
+			switch code {
+			case wkbMultiPoint:
+				c, err := r.coord(porder, playout)
+				if err != nil {
+					return nil, layout, err
+				}
+				g.MultiPoint = append(g.MultiPoint, c)
+			case wkbMultiLineString:
+				l, err := r.coords(porder, playout)
+				if err != nil {
+					return nil, layout, err
+				}
+				g.MultiLineString = append(g.MultiLineString, l)
+			case wkbMultiPolygon:
+				p, err := r.rings(porder, playout)
+				if err != nil {
+					return nil, layout, err
+				}
+				g.MultiPolygon = append(g.MultiPolygon, p)
+			}
+		}
+	case wkbGeometryCollection:
+		g.Type = geom.GeometryCollection
+		n, err := r.uint32(order)
+		if err != nil {
+			return nil, layout, err
+		}
+		if int(n) > (len(r.data)-r.pos)/5 {
+			return nil, layout, errWKBTooShort
+		}
+		for i := uint32(0); i < n; i++ {
+			c, _, err := r.geometry()
+			if err != nil {
+				return nil, layout, err
+			}
+			g.Geometries = append(g.Geometries, c)
+		}
+	default:
+		return nil, layout, fmt.Errorf("unsupported WKB geometry type %d", code)
+	}
+	return g, layout, nil
+}